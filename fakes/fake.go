@@ -9,6 +9,8 @@ import (
 	sc "google/api/servicecontrol/v1"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // create a new builder
@@ -26,6 +28,30 @@ func NewCheckerBuilder(name string, err error) *checkerbuilder {
 	}
 }
 
+// NewSlowCheckerBuilder -- builds checkers that take delay to respond and ignore the context
+func NewSlowCheckerBuilder(name string, delay time.Duration) *checkerbuilder {
+	return &checkerbuilder{
+		name:  name,
+		delay: delay,
+	}
+}
+
+// NewBlockingCheckerBuilder -- BuildChecker blocks until release is closed
+func NewBlockingCheckerBuilder(name string, release chan struct{}) *checkerbuilder {
+	return &checkerbuilder{
+		name:    name,
+		release: release,
+	}
+}
+
+// NewDenyingCheckerBuilder -- builds checkers that deny every request with ce
+func NewDenyingCheckerBuilder(name string, ce *sc.CheckError) *checkerbuilder {
+	return &checkerbuilder{
+		name: name,
+		deny: ce,
+	}
+}
+
 func BuildPrefixAndHandler(prx string) *mixologist.PrefixAndHandler {
 	return &mixologist.PrefixAndHandler{
 		Prefix: prx,
@@ -39,8 +65,14 @@ func BuildPrefixAndHandler(prx string) *mixologist.PrefixAndHandler {
 // BuildChecker --
 func (s *checkerbuilder) BuildChecker(c interface{}) (mixologist.Checker, error) {
 	_ = c.(*checkerConfig)
+	atomic.AddInt32(&s.Builds, 1)
+	if s.release != nil {
+		<-s.release
+	}
 	s.Checker = &checker{
-		name: s.name,
+		name:  s.name,
+		delay: s.delay,
+		deny:  s.deny,
 	}
 	return s.Checker, s.err
 }
@@ -52,9 +84,19 @@ func (s *checkerbuilder) ValidateConfig(c interface{}) error {
 	return nil
 }
 
+func (s *builder) ConfigStruct() interface{} {
+	return &consumerConfig{}
+}
+
+func (s *builder) ValidateConfig(c interface{}) error {
+	return nil
+}
+
 // BuildConsumer --
-func (s *builder) BuildConsumer(c mixologist.Config) (mixologist.ReportConsumer, error) {
+func (s *builder) BuildConsumer(c mixologist.Config, params interface{}) (mixologist.ReportConsumer, error) {
+	s.Builds++
 	s.Consumer = &consumer{
+		Params:  params.(*consumerConfig),
 		name:    s.name,
 		Msgs:    list.New(),
 		handler: BuildPrefixAndHandler("fake-handler"),
@@ -72,12 +114,34 @@ func (s *consumer) GetName() string {
 func (s *consumer) Consume(reportMsg []*sc.ReportRequest) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	s.batches++
 	for _, v := range reportMsg {
 		s.Msgs.PushBack(v)
 	}
 	return nil
 }
 
+// GetBatches -- number of times Consume was called
+func (s *consumer) GetBatches() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.batches
+}
+
+// Close -- Closer#Close
+func (s *consumer) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+}
+
+// IsClosed -- true once Close was called
+func (s *consumer) IsClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closed
+}
+
 func UUID() string {
 	b := make([]byte, 16)
 	rand.Read(b)
@@ -111,12 +175,18 @@ func (c *checker) Name() string {
 }
 
 // Check -- Checker#Check
-func (c *checker) Check(*sc.CheckRequest) (serr *sc.CheckError, err error) {
-	return
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (serr *sc.CheckError, err error) {
+	atomic.AddInt32(&c.Calls, 1)
+	if c.delay > 0 {
+		time.Sleep(c.delay)
+	}
+	return c.deny, nil
 }
 
-// Unload -- Checker#Name
-func (c *checker) Unload() {}
+// Unload -- Checker#Unload
+func (c *checker) Unload() {
+	atomic.AddInt32(&c.Unloads, 1)
+}
 
 // Check implementation
 // Always return a success
@@ -5,6 +5,7 @@ import (
 	"github.com/cloudendpoints/mixologist/mixologist"
 	sc "google/api/servicecontrol/v1"
 	"sync"
+	"time"
 )
 
 type (
@@ -14,12 +15,18 @@ type (
 		Msgs    *list.List
 		handler *mixologist.PrefixAndHandler
 		lock    *sync.Mutex
+		batches int
+		closed  bool
+		// Params -- typed params the consumer was built with
+		Params *consumerConfig
 	}
 	builder struct {
 		name     string
 		err      error
 		meta     map[string]interface{}
 		Consumer *consumer
+		// Builds -- number of times BuildConsumer was called
+		Builds int
 	}
 
 	handler struct {
@@ -33,19 +40,34 @@ type (
 	}
 
 	checker struct {
-		name string
-		meta map[string]interface{}
-		Msgs *list.List
+		name  string
+		meta  map[string]interface{}
+		Msgs  *list.List
+		delay time.Duration
+		// deny -- returned by every Check, nil allows
+		deny *sc.CheckError
+		// Calls -- number of times Check was called
+		Calls int32
+		// Unloads -- number of times Unload was called
+		Unloads int32
 	}
 	checkerbuilder struct {
 		name    string
 		err     error
+		delay   time.Duration
+		deny    *sc.CheckError
 		meta    map[string]interface{}
+		release chan struct{}
 		Checker *checker
+		// Builds -- number of calls to BuildChecker
+		Builds int32
 	}
 	flist struct {
 		Wl string `yaml:",omitempty,required"`
 	}
+	consumerConfig struct {
+		Addr string `yaml:",omitempty"`
+	}
 	checkerConfig struct {
 		OnCall string `yaml:",omitempty,required"`
 		Flist  flist
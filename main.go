@@ -2,16 +2,33 @@ package main
 
 import (
 	"flag"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/cloudendpoints/mixologist/mixologist/cp/abuse"
 	"github.com/cloudendpoints/mixologist/mixologist/rc/statsd"
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 
 	// Needed for init()
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/activation"
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/apikey"
 	_ "github.com/cloudendpoints/mixologist/mixologist/cp/block"
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/clientfilter"
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/extauthz"
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/jwt"
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/loadshed"
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/policy"
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/quota"
+	_ "github.com/cloudendpoints/mixologist/mixologist/cp/schedule"
 	_ "github.com/cloudendpoints/mixologist/mixologist/cp/whitelist"
 	_ "github.com/cloudendpoints/mixologist/mixologist/rc/logsAdapter"
 	_ "github.com/cloudendpoints/mixologist/mixologist/rc/prometheus"
@@ -21,8 +38,12 @@ var (
 	config mixologist.Config
 
 	// Mixologist commandline flags
-	port       = flag.Int("port", mixologist.Port, "Port exposed for ServiceControl RPCs")
-	nConsumers = flag.Int("nConsumers", mixologist.NConsumers, "Number of consumers for request processing")
+	port          = flag.Int("port", mixologist.Port, "Port exposed for ServiceControl RPCs")
+	grpcPort      = flag.Int("grpc_port", mixologist.GRPCPort, "Port exposed for ServiceControl gRPC; 0 disables the grpc server")
+	adminAddr     = flag.String("admin_addr", mixologist.AdminAddr, "Address (host:port) of unauthenticated admin endpoints such as /abuse/bans; empty disables them")
+	nConsumers    = flag.Int("nConsumers", mixologist.NConsumers, "Number of consumers for request processing")
+	checkDeadline = flag.Duration("check_deadline", mixologist.DefaultCheckDeadline, "Upper bound on time spent in checkers per Check request; 0 disables")
+	drainTimeout  = flag.Duration("drain_timeout", mixologist.DefaultDrainTimeout, "Upper bound on graceful shutdown after SIGTERM/SIGINT")
 
 	// Metrics backend flags
 	reportConsumers = flag.String("report_consumers", "prometheus,statsd,mixologist.io/consumers/logsAdapter", "Comma-separated list of canonical names for report consumers")
@@ -42,32 +63,121 @@ func init() {
 }
 
 func main() {
+	var err error
 	flag.Parse()
 	config.ReportConsumers = strings.Split(*reportConsumers, ",")
 	config.Checkers = strings.Split(*checkers, ",")
 	config.Logging.Backends = strings.Split(*loggingBackends, ",")
 	osc := mixologist.ServicesConfig{}
-	var err error
 	var configMgr *mixologist.ConfigManager
-	checkerMgr, _ := mixologist.NewCheckerManager(mixologist.CheckerRegistry, &osc)
+	config.Decisions = mixologist.NewDecisionRecorder()
+	checkerMgr, _ := mixologist.NewCheckerManager(mixologist.CheckerRegistry, &osc,
+		mixologist.CheckDeadline(*checkDeadline), mixologist.RecordDecisions(config.Decisions))
 	if configMgr, err = mixologist.NewConfigManager(*configFile, *kubeconfig); err != nil {
 		glog.Exitf("Unable to start server " + err.Error())
 	}
+	controller := mixologist.NewControllerImpl(checkerMgr)
+	rcMgr := mixologist.NewReportConsumerManager(controller.ReportQueue(), mixologist.ReportConsumerRegistry, config)
 	configMgr.Register(checkerMgr)
+	configMgr.Register(rcMgr)
 	go configMgr.Loop()
 
-	controller := mixologist.NewControllerImpl(checkerMgr)
-	rcMgr := mixologist.NewReportConsumerManager(controller.ReportQueue(), mixologist.ReportConsumerRegistry, config)
-	handler := mixologist.NewHandler(controller, rcMgr.GetPrefixAndHandlers())
+	handler := mixologist.NewHandler(controller, nil, mixologist.ReportHandlersFrom(rcMgr.GetPrefixAndHandlers))
 	addr := ":" + strconv.Itoa(*port)
 	srv := http.Server{
 		Addr:    addr,
 		Handler: handler,
 	}
 	rcMgr.Start(*nConsumers)
+	var grpcSrv *grpc.Server
+	if *grpcPort != 0 {
+		grpcSrv = serveGRPC(controller, ":"+strconv.Itoa(*grpcPort))
+	}
+	var adminSrv *http.Server
+	if *adminAddr != "" {
+		adminSrv = serveAdmin(*adminAddr)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+		glog.Infof("Received %s, shutting down", <-sig)
+		shutdown(*drainTimeout, &srv, grpcSrv, adminSrv, controller, rcMgr, checkerMgr, configMgr)
+		close(stopped)
+	}()
+
 	glog.Info("Starting Server on " + addr)
-	err = srv.ListenAndServe()
-	if err != nil {
+	if err = srv.ListenAndServe(); err != http.ErrServerClosed {
 		glog.Exitf("Unable to start server " + err.Error())
 	}
+	<-stopped
+}
+
+// shutdown -- stop accepting requests, drain reports and unload adapters within timeout
+func shutdown(timeout time.Duration, srv *http.Server, grpcSrv *grpc.Server, adminSrv *http.Server, controller mixologist.Controller,
+	rcMgr *mixologist.ReportConsumerManagerImpl, checkerMgr *mixologist.CheckerManager, configMgr *mixologist.ConfigManager) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	defer glog.Flush()
+
+	configMgr.Close()
+	if adminSrv != nil {
+		adminSrv.Close()
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		glog.Warning("Unable to drain http server ", err)
+	}
+	if grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			glog.Warning("Unable to drain grpc server ", ctx.Err())
+			grpcSrv.Stop()
+		}
+	}
+	// handlers of a forced stop may still be running, they are refused
+	controller.Close()
+	if err := rcMgr.Drain(ctx); err != nil {
+		glog.Warning("Unable to drain report consumers ", err)
+	}
+	checkerMgr.Unload()
+	glog.Info("Shutdown complete")
+}
+
+func serveGRPC(controller mixologist.Controller, addr string) *grpc.Server {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		glog.Exitf("Unable to start grpc server " + err.Error())
+	}
+	srv := mixologist.NewGRPCServer(controller)
+	glog.Info("Starting gRPC Server on " + addr)
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			glog.Exitf("Unable to start grpc server " + err.Error())
+		}
+	}()
+	return srv
+}
+
+// serveAdmin -- endpoints that change server state, kept off the public port
+func serveAdmin(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(abuse.Prefix, abuse.Handler())
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	glog.Info("Starting admin Server on " + addr)
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			glog.Exitf("Unable to start admin server " + err.Error())
+		}
+	}()
+	return srv
 }
@@ -1,6 +1,7 @@
 package mixologist
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -19,9 +20,13 @@ var (
 	}
 )
 
+// ErrBatcherClosed -- returned by Consume once the batcher is closed
+var ErrBatcherClosed = errors.New("batcher closed")
+
 type batcher struct {
 	bufChan  chan *sc.ReportRequest
 	closing  chan struct{}
+	done     chan struct{}
 	consumer ReportConsumer
 }
 
@@ -30,6 +35,19 @@ type BatchingConfig struct {
 	BatchTimeout  time.Duration
 }
 
+// Enabled -- batching is enabled if either size or timeout is set
+func (p BatchParams) Enabled() bool {
+	return p.Size > 0 || p.TimeoutSec > 0
+}
+
+// BatchingConfig -- convert yaml friendly BatchParams to BatchingConfig
+func (p BatchParams) BatchingConfig() BatchingConfig {
+	return BatchingConfig{
+		MaxBatchCount: p.Size,
+		BatchTimeout:  time.Duration(p.TimeoutSec) * time.Second,
+	}
+}
+
 func (b *batcher) flush(reqs []*sc.ReportRequest) int {
 	if len(reqs) > 0 {
 		b.consumer.Consume(reqs)
@@ -47,21 +65,46 @@ func (b *batcher) GetPrefixAndHandler() *PrefixAndHandler {
 
 func (b *batcher) Consume(reqs []*sc.ReportRequest) error {
 	for _, req := range reqs {
-		b.bufChan <- req
+		select {
+		case <-b.closing:
+			return ErrBatcherClosed
+		default:
+		}
+		select {
+		case b.bufChan <- req:
+		case <-b.closing:
+			return ErrBatcherClosed
+		}
 	}
 	return nil
 }
 
-// TOOD: not yet a method on ReportConsumer, but we probably want to add it
+// Close -- flush buffered reports to the underlying consumer and close it.
+// Blocks until the final batch is delivered. Consume returns ErrBatcherClosed afterwards.
 func (b *batcher) Close() {
 	close(b.closing)
-	// TODO: should close bufChan? signal Consume to start reporting errors?
-	// close(b.bufChan)
+	<-b.done
+	if c, ok := b.consumer.(Closer); ok {
+		c.Close()
+	}
+}
+
+// drain -- append whatever is left in bufChan without blocking
+func (b *batcher) drain(reqs []*sc.ReportRequest) []*sc.ReportRequest {
+	for {
+		select {
+		case req := <-b.bufChan:
+			reqs = append(reqs, req)
+		default:
+			return reqs
+		}
+	}
 }
 
 func (b *batcher) batchLoop(max int, timeout time.Duration) {
 	t := time.NewTicker(timeout)
 	defer t.Stop()
+	defer close(b.done)
 
 	for {
 		var reqs []*sc.ReportRequest
@@ -76,7 +119,7 @@ func (b *batcher) batchLoop(max int, timeout time.Duration) {
 			case <-t.C:
 				batchFull = true
 			case <-b.closing:
-				b.flush(reqs)
+				b.flush(b.drain(reqs))
 				return
 			}
 		}
@@ -97,7 +140,8 @@ func BatchingConsumer(consumer ReportConsumer, c BatchingConfig) ReportConsumer
 	b := &batcher{
 		consumer: consumer,
 		bufChan:  make(chan *sc.ReportRequest, conf.MaxBatchCount),
-		closing:  make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
 	}
 
 	go b.batchLoop(conf.MaxBatchCount, conf.BatchTimeout)
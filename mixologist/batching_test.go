@@ -73,3 +73,37 @@ func TestConsume(t *testing.T) {
 		b.(*batcher).Close()
 	}
 }
+
+func TestClose(t *testing.T) {
+	f := &fakeAdapter{}
+	in := []*sc.ReportRequest{&sc.ReportRequest{ServiceName: "Test"}, &sc.ReportRequest{ServiceName: "Test 2"}}
+
+	f.done.Add(1)
+	b := BatchingConsumer(f, BatchingConfig{MaxBatchCount: 10, BatchTimeout: time.Hour})
+	b.Consume(in)
+	b.(*batcher).Close()
+
+	if len(f.reqs) != len(in) {
+		t.Errorf("bad num of reqs flushed on Close; got %d, want %d", len(f.reqs), len(in))
+	}
+	if f.numBatches != 1 {
+		t.Errorf("bad num of batches; got %d, want 1", f.numBatches)
+	}
+	if err := b.Consume(in); err != ErrBatcherClosed {
+		t.Errorf("Consume after Close; got %v, want %v", err, ErrBatcherClosed)
+	}
+}
+
+func TestBatchParamsBatchingConfig(t *testing.T) {
+	bp := BatchParams{Size: 20, TimeoutSec: 10}
+	if !bp.Enabled() {
+		t.Errorf("%v should be enabled", bp)
+	}
+	want := BatchingConfig{MaxBatchCount: 20, BatchTimeout: 10 * time.Second}
+	if got := bp.BatchingConfig(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if (BatchParams{}).Enabled() {
+		t.Errorf("zero BatchParams should not be enabled")
+	}
+}
@@ -0,0 +1,173 @@
+package mixologist
+
+import (
+	"container/list"
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCacheMaxEntries -- used when CacheParams.MaxEntries is not set
+	DefaultCacheMaxEntries = 10000
+
+	// Fields of CheckRequest that may form the cache key
+	CacheKeyServiceName   = "service_name"
+	CacheKeyConsumerID    = "consumer_id"
+	CacheKeyOperationName = "operation_name"
+)
+
+var (
+	defaultCacheKeyFields = []string{CacheKeyServiceName, CacheKeyConsumerID, CacheKeyOperationName}
+)
+
+type (
+	// checkCache -- LRU cache of check results for a single adapter
+	checkCache struct {
+		params CacheParams
+		fields []string
+
+		lock    sync.Mutex
+		entries map[string]*list.Element
+		lru     *list.List
+		now     func() time.Time
+	}
+
+	// cacheKey -- identifies the cache of a checker instance with given CacheParams
+	cacheKey struct {
+		instance instanceKey
+		params   string
+	}
+
+	cacheEntry struct {
+		key     string
+		ce      *sc.CheckError
+		expires time.Time
+	}
+)
+
+// Enabled -- caching is enabled if positive or negative results have a ttl
+func (p *CacheParams) Enabled() bool {
+	return p.TTLSec > 0 || p.NegativeTTLSec > 0
+}
+
+// Validate -- ensure all key fields are known
+func (p *CacheParams) Validate() error {
+	if p.TTLSec < 0 || p.NegativeTTLSec < 0 || p.MaxEntries < 0 {
+		return errors.New("CacheParams cannot be negative")
+	}
+	for _, f := range p.Fields {
+		switch f {
+		case CacheKeyServiceName, CacheKeyConsumerID, CacheKeyOperationName:
+		default:
+			return errors.New("Unknown cache key field '" + f + "'")
+		}
+	}
+	return nil
+}
+
+func newCheckCache(p CacheParams) *checkCache {
+	if p.MaxEntries == 0 {
+		p.MaxEntries = DefaultCacheMaxEntries
+	}
+	fields := p.Fields
+	if len(fields) == 0 {
+		fields = defaultCacheKeyFields
+	}
+	return &checkCache{
+		params:  p,
+		fields:  fields,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Key -- signature of the CheckRequest per configured fields and labels
+func (c *checkCache) Key(msg *sc.CheckRequest) string {
+	op := msg.GetOperation()
+	if op == nil {
+		op = &sc.Operation{}
+	}
+	parts := make([]string, 0, len(c.fields)+len(c.params.Labels))
+	for _, f := range c.fields {
+		switch f {
+		case CacheKeyServiceName:
+			parts = append(parts, msg.ServiceName)
+		case CacheKeyConsumerID:
+			parts = append(parts, op.ConsumerId)
+		case CacheKeyOperationName:
+			parts = append(parts, op.OperationName)
+		}
+	}
+	labels := op.Labels
+	for _, l := range c.params.Labels {
+		parts = append(parts, labels[l])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// Get -- return a cached result; found is false if absent or expired
+func (c *checkCache) Get(key string) (ce *sc.CheckError, found bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	el, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	if entry.ce == nil {
+		return nil, true
+	}
+	// callers own the result, the cached one is shared
+	return &sc.CheckError{Code: entry.ce.Code, Detail: entry.ce.Detail}, true
+}
+
+// Set -- cache a check result. A nil CheckError is an allow (positive) result
+func (c *checkCache) Set(key string, ce *sc.CheckError) {
+	ttl := c.params.TTLSec
+	if ce != nil {
+		ttl = c.params.NegativeTTLSec
+		ce = &sc.CheckError{Code: ce.Code, Detail: ce.Detail}
+	}
+	if ttl <= 0 {
+		return
+	}
+	entry := &cacheEntry{
+		key:     key,
+		ce:      ce,
+		expires: c.now().Add(time.Duration(ttl) * time.Second),
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, found := c.entries[key]; found {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.params.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Len -- number of cached results including expired ones not yet evicted
+func (c *checkCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
+
+// remove -- caller must hold the lock
+func (c *checkCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
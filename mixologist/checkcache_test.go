@@ -0,0 +1,142 @@
+package mixologist
+
+import (
+	sc "google/api/servicecontrol/v1"
+	"testing"
+	"time"
+)
+
+func cacheRequest(svc, consumer, oprn, ip string) *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: svc,
+		Operation: &sc.Operation{
+			ConsumerId:    consumer,
+			OperationName: oprn,
+			Labels:        map[string]string{"caller_ip": ip},
+		},
+	}
+}
+
+func TestCheckCacheKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		p      CacheParams
+		a, b   *sc.CheckRequest
+		wantEq bool
+	}{
+		{
+			name:   "default fields, same request",
+			a:      cacheRequest("svc", "api_key:a", "Get", "1.1.1.1"),
+			b:      cacheRequest("svc", "api_key:a", "Get", "2.2.2.2"),
+			wantEq: true,
+		},
+		{
+			name: "default fields, different consumer",
+			a:    cacheRequest("svc", "api_key:a", "Get", "1.1.1.1"),
+			b:    cacheRequest("svc", "api_key:b", "Get", "1.1.1.1"),
+		},
+		{
+			name:   "service only",
+			p:      CacheParams{Fields: []string{CacheKeyServiceName}},
+			a:      cacheRequest("svc", "api_key:a", "Get", "1.1.1.1"),
+			b:      cacheRequest("svc", "api_key:b", "List", "1.1.1.1"),
+			wantEq: true,
+		},
+		{
+			name: "with labels",
+			p:    CacheParams{Labels: []string{"caller_ip"}},
+			a:    cacheRequest("svc", "api_key:a", "Get", "1.1.1.1"),
+			b:    cacheRequest("svc", "api_key:a", "Get", "2.2.2.2"),
+		},
+	}
+	for _, v := range tests {
+		c := newCheckCache(v.p)
+		if eq := c.Key(v.a) == c.Key(v.b); eq != v.wantEq {
+			t.Errorf("%s: got equal keys %v, want %v", v.name, eq, v.wantEq)
+		}
+	}
+}
+
+func TestCheckCacheTTL(t *testing.T) {
+	now := time.Now()
+	c := newCheckCache(CacheParams{TTLSec: 10, NegativeTTLSec: 1})
+	c.now = func() time.Time { return now }
+	deny := &sc.CheckError{Code: sc.CheckError_IP_ADDRESS_BLOCKED}
+
+	c.Set("allow", nil)
+	c.Set("deny", deny)
+	if ce, found := c.Get("allow"); !found || ce != nil {
+		t.Errorf("allow: got %v %v, want nil true", ce, found)
+	}
+	if ce, found := c.Get("deny"); !found || ce == nil || ce.Code != deny.Code {
+		t.Errorf("deny: got %v %v, want %v true", ce, found, deny)
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, found := c.Get("deny"); found {
+		t.Errorf("deny: expected negative result to expire")
+	}
+	if _, found := c.Get("allow"); !found {
+		t.Errorf("allow: expected positive result to be cached")
+	}
+
+	now = now.Add(10 * time.Second)
+	if _, found := c.Get("allow"); found {
+		t.Errorf("allow: expected positive result to expire")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected expired entries to be evicted, got %d", c.Len())
+	}
+}
+
+func TestCheckCacheNoNegative(t *testing.T) {
+	c := newCheckCache(CacheParams{TTLSec: 10})
+	c.Set("deny", &sc.CheckError{Code: sc.CheckError_IP_ADDRESS_BLOCKED})
+	if _, found := c.Get("deny"); found {
+		t.Errorf("deny: negative results should not be cached")
+	}
+}
+
+func TestCheckCacheMaxEntries(t *testing.T) {
+	c := newCheckCache(CacheParams{TTLSec: 10, MaxEntries: 2})
+	c.Set("a", nil)
+	c.Set("b", nil)
+	// a is now most recently used
+	c.Get("a")
+	c.Set("c", nil)
+	if c.Len() != 2 {
+		t.Errorf("got %d entries, want 2", c.Len())
+	}
+	if _, found := c.Get("b"); found {
+		t.Errorf("b: expected least recently used entry to be evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, found := c.Get(k); !found {
+			t.Errorf("%s: expected entry to be cached", k)
+		}
+	}
+}
+
+func TestCacheParamsValidate(t *testing.T) {
+	if err := (&CacheParams{Fields: []string{CacheKeyConsumerID}}).Validate(); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if err := (&CacheParams{Fields: []string{"consumer"}}).Validate(); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+	if err := (&CacheParams{TTLSec: -1}).Validate(); err == nil {
+		t.Errorf("expected error for negative ttl")
+	}
+}
+
+func TestCheckCacheCopies(t *testing.T) {
+	c := newCheckCache(CacheParams{NegativeTTLSec: 10})
+	deny := &sc.CheckError{Code: sc.CheckError_IP_ADDRESS_BLOCKED, Detail: "blocked"}
+	c.Set("deny", deny)
+	deny.Detail = "changed by the caller"
+	ce, _ := c.Get("deny")
+	ce.Detail = "changed by a response"
+	if ce, _ = c.Get("deny"); ce.Detail != "blocked" {
+		t.Errorf("got %q, want cached results to be unaffected by callers", ce.Detail)
+	}
+}
@@ -2,50 +2,219 @@ package mixologist
 
 import (
 	sc "google/api/servicecontrol/v1"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 )
 
 // NewCheckerManager -- given a registry and a config object return a CheckerManager
-func NewCheckerManager(registry map[string]CheckerBuilder, cfg *ServicesConfig) (*CheckerManager, []error) {
+func NewCheckerManager(registry map[string]CheckerBuilder, cfg *ServicesConfig, opts ...func(*CheckerManager)) (*CheckerManager, []error) {
 	var erra []error
 	cm := &CheckerManager{
-		checkers: make(map[ConstructorParams]Checker),
+		checkers:  make(map[instanceKey]*checkerRef),
+		building:  make(map[instanceKey]*pendingChecker),
+		caches:    make(map[cacheKey]*checkCache),
+		deadline:  DefaultCheckDeadline,
+		decisions: NewDecisionRecorder(),
 	}
 	cm.cfg.Store(cfg)
+	cm.refs, cm.cacheRefs = references(cfg)
+	for _, opt := range opts {
+		opt(cm)
+	}
 
 	return cm, erra
 }
 
-// FindChecker -- given a checker kind and AdapterParams return a checker
-func (c *CheckerManager) FindChecker(kind string, ru *RuntimeAdapterState) (chk Checker, err error) {
-	key := ConstructorParams{
-		Kind:   kind,
-		Params: ru.TypedParams,
+// CheckDeadline -- bound the time a single Check may spend in checkers. default: DefaultCheckDeadline
+// A deadline <= 0 means checks are only bounded by the caller's context
+func CheckDeadline(d time.Duration) func(*CheckerManager) {
+	return func(c *CheckerManager) {
+		c.deadline = d
 	}
+}
+
+// RecordDecisions -- record decisions of staged checkers in r, ex: to export them as metrics.
+// default: a recorder of its own, see Decisions
+func RecordDecisions(r *DecisionRecorder) func(*CheckerManager) {
+	return func(c *CheckerManager) {
+		c.decisions = r
+	}
+}
+
+// Decisions -- snapshot of the decision counts of staged checkers
+func (c *CheckerManager) Decisions() map[DecisionKey]int64 {
+	return c.decisions.Decisions()
+}
+
+// acquire -- given a checker kind and AdapterParams return a held checker, release it once done
+// Checkers are shared by all AdapterParams with equal kind and params. A checker is built
+// once per key outside the lock, concurrent checks wait for that build until ctx is done.
+// A checker built for a request resolved against an older config is not kept, it is unloaded on release
+func (c *CheckerManager) acquire(ctx context.Context, kind string, ru *RuntimeAdapterState) (*checkerRef, error) {
+	key := ru.key
 	c.lock.RLock()
-	chk, found := c.checkers[key]
+	ref, found := c.checkers[key]
+	if found {
+		ref.hold()
+	}
 	c.lock.RUnlock()
 	if found {
-		return chk, nil
+		return ref, nil
 	}
 
 	c.lock.Lock()
-	defer c.lock.Unlock()
-
-	chk, found = c.checkers[key]
+	if ref, found = c.checkers[key]; found {
+		ref.hold()
+		c.lock.Unlock()
+		return ref, nil
+	}
+	b, found := c.building[key]
 	if !found {
-		if chk, err = ru.Builder.(CheckerBuilder).BuildChecker(ru.TypedParams); err != nil {
-			return nil, err
+		b = &pendingChecker{done: make(chan struct{})}
+		c.building[key] = b
+		go c.build(key, kind, ru, b)
+	}
+	b.waiters++
+	c.lock.Unlock()
+
+	select {
+	case <-b.done:
+		return b.ref, b.err
+	case <-ctx.Done():
+	}
+	c.lock.Lock()
+	published := b.published
+	if !published {
+		b.waiters--
+	}
+	c.lock.Unlock()
+	if published && b.err == nil {
+		// the build completed while giving up, the hold taken for us is returned
+		b.ref.release()
+	}
+	return nil, ctx.Err()
+}
+
+// build -- build the checker for key and publish it to the checks waiting for it
+func (c *CheckerManager) build(key instanceKey, kind string, ru *RuntimeAdapterState, b *pendingChecker) {
+	chk, err := ru.Builder.(CheckerBuilder).BuildChecker(ru.TypedParams)
+
+	c.lock.Lock()
+	delete(c.building, key)
+	b.published = true
+	b.err = err
+	var unload bool
+	if err == nil {
+		b.ref = &checkerRef{Checker: chk, inflight: b.waiters}
+		if c.refs[key] {
+			c.checkers[key] = b.ref
+		} else {
+			glog.V(1).Infof("%s built for a stale config", kind)
+			b.ref.retired = true
+			unload = b.waiters == 0
 		}
-		c.checkers[key] = chk
 	}
-	return chk, nil
+	c.lock.Unlock()
+	close(b.done)
+	if unload {
+		b.ref.unload()
+	}
+}
+
+// hold -- a check uses the checker
+func (r *checkerRef) hold() {
+	r.lock.Lock()
+	r.inflight++
+	r.lock.Unlock()
+}
+
+// release -- a check is done with the checker, unload it if it was retired
+func (r *checkerRef) release() {
+	r.lock.Lock()
+	r.inflight--
+	unload := r.retired && r.inflight == 0
+	r.lock.Unlock()
+	if unload {
+		r.unload()
+	}
+}
+
+// retire -- the checker is no longer referenced, unload it once checks using it are done
+func (r *checkerRef) retire() {
+	r.lock.Lock()
+	r.retired = true
+	unload := r.inflight == 0
+	r.lock.Unlock()
+	if unload {
+		r.unload()
+	}
+}
+
+func (r *checkerRef) unload() {
+	glog.V(1).Infof("Unloading %s", r.Name())
+	r.Unload()
+}
+
+// findCache -- the result cache of the checker instance for params, nil if caching is disabled.
+// Caches not referenced by the current config are not kept
+func (c *CheckerManager) findCache(ru *RuntimeAdapterState, params CacheParams) *checkCache {
+	if !params.Enabled() {
+		return nil
+	}
+	key := cacheKey{instance: ru.key, params: paramsKey(params)}
+	c.lock.RLock()
+	cache, found := c.caches[key]
+	referenced := c.cacheRefs[key]
+	c.lock.RUnlock()
+	if found || !referenced {
+		return cache
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cache, found = c.caches[key]; !found {
+		cache = newCheckCache(params)
+		c.caches[key] = cache
+	}
+	return cache
+}
+
+type checkResult struct {
+	ce  *sc.CheckError
+	err error
+}
+
+// runChecker -- run ref in its own goroutine so that a checker that
+// does not honor ctx is abandoned once ctx is done. ref is released once its Check returns
+func runChecker(ctx context.Context, ref *checkerRef, msg *sc.CheckRequest) (*sc.CheckError, error) {
+	res := make(chan checkResult, 1)
+	go func() {
+		ce, err := ref.Check(ctx, msg)
+		ref.release()
+		res <- checkResult{ce, err}
+	}()
+	select {
+	case r := <-res:
+		return r.ce, r.err
+	case <-ctx.Done():
+		glog.Warningf("%s abandoned: %s", ref.Name(), ctx.Err())
+		return nil, ctx.Err()
+	}
 }
 
 // Check -- Top level check mehod that runs thru all registered checkers
 func (c *CheckerManager) Check(ctx context.Context, msg *sc.CheckRequest) (*sc.CheckResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.deadline)
+		defer cancel()
+	}
 	cfg := c.cfg.Load().(*ServicesConfig)
 	checkers := cfg.Resolve(&ResolveKey{
 		Source:      msg.GetOperation().ConsumerId,
@@ -53,27 +222,71 @@ func (c *CheckerManager) Check(ctx context.Context, msg *sc.CheckRequest) (*sc.C
 		RpcMethod:   RPCCheck,
 	})
 	glog.V(2).Infof("Resolved: %d checkers %#v ==> %#v", len(checkers), *msg, checkers)
-	ce := []*sc.CheckError{}
-	for _, checker := range checkers {
+	// checkers run concurrently, results are kept in resolution order
+	results := make([]checkResult, len(checkers))
+	var wg sync.WaitGroup
+	for idx, checker := range checkers {
 		glog.V(1).Infof("Checking %s %s", checker.Kind, msg)
+		// failures to get a checker are subject to its FailurePolicy
 		ru, converted := checker.Params.(*RuntimeAdapterState)
 		if !converted {
 			glog.Warningf("%s was not converted", checker.Kind)
+			results[idx].err = ErrAdapterUnavailable(checker.Kind)
 			continue
 		}
 
-		chk, err := c.FindChecker(checker.Kind, ru)
+		var key string
+		cache := c.findCache(ru, checker.CacheParams)
+		if cache != nil {
+			key = cache.Key(msg)
+			if cer, found := cache.Get(key); found {
+				glog.V(2).Infof("%s cached result %v", checker.Kind, cer)
+				results[idx].ce = cer
+				continue
+			}
+		}
+
+		ref, err := c.acquire(ctx, checker.Kind, ru)
 		if err != nil {
 			glog.Warningf("%s Could not get checker %s", checker.Kind, err)
+			results[idx].err = err
 			continue
 		}
 
-		cer, er := chk.Check(msg)
-		if er != nil {
-			cer = &sc.CheckError{
-				Code:   sc.CheckError_PERMISSION_DENIED,
-				Detail: er.Error(),
+		wg.Add(1)
+		go func(idx int, ref *checkerRef, cache *checkCache, key string) {
+			defer wg.Done()
+			results[idx].ce, results[idx].err = runChecker(ctx, ref, msg)
+			// errors are never cached
+			if cache != nil && results[idx].err == nil {
+				cache.Set(key, results[idx].ce)
+			}
+		}(idx, ref, cache, key)
+	}
+	wg.Wait()
+
+	consumerID := msg.GetOperation().ConsumerId
+	ce := []*sc.CheckError{}
+	for idx, res := range results {
+		if rollout := checkers[idx].Rollout; rollout.Staged() {
+			key := DecisionKey{
+				Service:  service(checkers[idx]),
+				Kind:     checkers[idx].Kind,
+				ID:       checkers[idx].ID,
+				Mode:     ModeEnforced,
+				Decision: decision(res.ce, res.err),
+			}
+			if !rollout.Enforced(consumerID) {
+				key.Mode = ModeShadow
+				c.decisions.record(key)
+				glog.V(1).Infof("%s shadow decision %s for %s", checkers[idx].Kind, key.Decision, consumerID)
+				continue
 			}
+			c.decisions.record(key)
+		}
+		cer := res.ce
+		if res.err != nil {
+			cer = checkers[idx].FailurePolicy.CheckError(checkers[idx].Kind, res.err)
 		}
 		if cer != nil {
 			ce = append(ce, cer)
@@ -85,11 +298,64 @@ func (c *CheckerManager) Check(ctx context.Context, msg *sc.CheckRequest) (*sc.C
 	}, nil
 }
 
+// ConfigChange -- install cfg and unload checkers that it no longer references
+// once checks using them are done. Checkers and result caches with unchanged kind and params are reused.
 func (c *CheckerManager) ConfigChange(cfg *ServicesConfig) {
-	glog.V(1).Infof("ConfigChanged", *cfg)
+	glog.V(1).Infof("ConfigChanged %v", *cfg)
+	refs, cacheRefs := references(cfg)
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	c.cfg.Store(cfg)
+	c.refs = refs
+	c.cacheRefs = cacheRefs
+	for key := range c.caches {
+		if !cacheRefs[key] {
+			delete(c.caches, key)
+		}
+	}
+	for key, ref := range c.checkers {
+		if !refs[key] {
+			ref.retire()
+			delete(c.checkers, key)
+		}
+	}
 }
 
+// references -- checker instances and result caches referenced by cfg
+func references(cfg *ServicesConfig) (map[instanceKey]bool, map[cacheKey]bool) {
+	refs := make(map[instanceKey]bool)
+	cacheRefs := make(map[cacheKey]bool)
+	for _, ac := range cfg.AdapterConfigs() {
+		for _, ap := range validAdapterParams(&ResolveKey{RpcMethod: RPCCheck}, ac) {
+			key := ap.Params.(*RuntimeAdapterState).key
+			refs[key] = true
+			if ap.CacheParams.Enabled() {
+				cacheRefs[cacheKey{instance: key, params: paramsKey(ap.CacheParams)}] = true
+			}
+		}
+	}
+	return refs, cacheRefs
+}
+
+// Unload -- unload all cached checkers once checks using them are done. Used at shutdown
+// Checkers still being built are unloaded once published
+func (c *CheckerManager) Unload() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.refs = nil
+	for key, ref := range c.checkers {
+		ref.retire()
+		delete(c.checkers, key)
+	}
+}
+
+// Checkers -- live checkers, built and not yet unloaded
 func (c *CheckerManager) Checkers() []Checker {
-	return []Checker{}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	chks := make([]Checker, 0, len(c.checkers))
+	for _, ref := range c.checkers {
+		chks = append(chks, ref.Checker)
+	}
+	return chks
 }
@@ -1,11 +1,17 @@
 package mixologist_test
 
 import (
+	"errors"
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cloudendpoints/mixologist/fakes"
 	. "github.com/cloudendpoints/mixologist/mixologist"
 	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
 	"gopkg.in/yaml.v2"
 )
 
@@ -121,3 +127,399 @@ func TestCheckerManagerValidate3(t *testing.T) {
 	ve := erra[0].(*DecodeError)
 	g.Expect(ve.Error()).To(g.ContainSubstring("unconvertible type"))
 }
+
+func slowCheckerManager(delay time.Duration, opts ...func(*CheckerManager)) *CheckerManager {
+	cfg := ServicesConfig{}
+	yaml.Unmarshal([]byte(yamlStr+fakechecker), &cfg)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": fakes.NewSlowCheckerBuilder("fakechecker", delay),
+	}
+	cfg, erra := ConvertParams(cfg, reg)
+	g.Expect(erra).To(g.BeEmpty())
+	cm, _ := NewCheckerManager(reg, &cfg, opts...)
+	return cm
+}
+
+func TestCheckerManagerDeadline(t *testing.T) {
+	g.RegisterTestingT(t)
+	cm := slowCheckerManager(time.Minute, CheckDeadline(50*time.Millisecond))
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+
+	start := time.Now()
+	resp, err := cm.Check(context.Background(), req)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(time.Since(start)).To(g.BeNumerically("<", time.Second))
+	g.Expect(resp.CheckErrors).To(g.HaveLen(1))
+	g.Expect(resp.CheckErrors[0].Detail).To(g.Equal(context.DeadlineExceeded.Error()))
+}
+
+func TestCheckerManagerCallerCancel(t *testing.T) {
+	g.RegisterTestingT(t)
+	cm := slowCheckerManager(time.Minute, CheckDeadline(0))
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := cm.Check(ctx, req)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(resp.CheckErrors).To(g.HaveLen(1))
+}
+
+func TestCheckerManagerWithinDeadline(t *testing.T) {
+	g.RegisterTestingT(t)
+	cm := slowCheckerManager(10*time.Millisecond, CheckDeadline(time.Second))
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+
+	resp, err := cm.Check(context.Background(), req)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(resp.CheckErrors).To(g.BeEmpty())
+}
+
+func policyCheckerManager(policy string) (*CheckerManager, []error) {
+	cfg := ServicesConfig{}
+	yaml.Unmarshal([]byte(yamlStr+fakechecker+policy), &cfg)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": fakes.NewSlowCheckerBuilder("fakechecker", time.Minute),
+	}
+	cfg, erra := ConvertParams(cfg, reg)
+	cm, _ := NewCheckerManager(reg, &cfg, CheckDeadline(50*time.Millisecond))
+	return cm, erra
+}
+
+func TestCheckerManagerFailurePolicy(t *testing.T) {
+	g.RegisterTestingT(t)
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+	for _, tc := range []struct {
+		policy string
+		errors int
+		code   sc.CheckError_Code
+	}{
+		{"", 1, sc.CheckError_PERMISSION_DENIED},
+		{"\n      failurepolicy:\n          mode: closed\n          code: QUOTA_CHECK_UNAVAILABLE", 1, sc.CheckError_QUOTA_CHECK_UNAVAILABLE},
+		{"\n      failurepolicy:\n          mode: open", 0, 0},
+	} {
+		cm, erra := policyCheckerManager(tc.policy)
+		g.Expect(erra).To(g.BeEmpty())
+		resp, err := cm.Check(context.Background(), req)
+		g.Expect(err).To(g.BeNil())
+		g.Expect(resp.CheckErrors).To(g.HaveLen(tc.errors), tc.policy)
+		if tc.errors > 0 {
+			g.Expect(resp.CheckErrors[0].Code).To(g.Equal(tc.code), tc.policy)
+		}
+	}
+}
+
+func TestCheckerManagerFailurePolicyInvalid(t *testing.T) {
+	g.RegisterTestingT(t)
+	for _, policy := range []string{
+		"\n      failurepolicy:\n          mode: sometimes",
+		"\n      failurepolicy:\n          mode: skip",
+		"\n      failurepolicy:\n          code: NOT_A_CODE",
+	} {
+		_, erra := policyCheckerManager(policy)
+		g.Expect(erra).To(g.HaveLen(1), policy)
+	}
+}
+
+func TestCheckerManagerParallel(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := ServicesConfig{}
+	yaml.Unmarshal([]byte(yamlStr+fakechecker+fakechecker+fakechecker), &cfg)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": fakes.NewSlowCheckerBuilder("fakechecker", 200*time.Millisecond),
+	}
+	cfg, erra := ConvertParams(cfg, reg)
+	g.Expect(erra).To(g.BeEmpty())
+	g.Expect(cfg.Resolve(&ResolveKey{RpcMethod: RPCCheck})).To(g.HaveLen(3))
+	cm, _ := NewCheckerManager(reg, &cfg, CheckDeadline(time.Second))
+
+	start := time.Now()
+	resp, err := cm.Check(context.Background(), &sc.CheckRequest{Operation: &sc.Operation{}})
+	g.Expect(err).To(g.BeNil())
+	g.Expect(resp.CheckErrors).To(g.BeEmpty())
+	g.Expect(time.Since(start)).To(g.BeNumerically("<", 500*time.Millisecond))
+}
+
+func TestCheckerManagerCache(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := ServicesConfig{}
+	yaml.Unmarshal([]byte(yamlStr+fakechecker+"\n      cacheparams:\n          ttlsec: 60"), &cfg)
+	builder := fakes.NewCheckerBuilder("fakechecker", nil)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": builder,
+	}
+	cfg, erra := ConvertParams(cfg, reg)
+	g.Expect(erra).To(g.BeEmpty())
+	cm, _ := NewCheckerManager(reg, &cfg)
+
+	req := &sc.CheckRequest{ServiceName: "svc", Operation: &sc.Operation{ConsumerId: "api_key:a"}}
+	for i := 0; i < 3; i++ {
+		resp, err := cm.Check(context.Background(), req)
+		g.Expect(err).To(g.BeNil())
+		g.Expect(resp.CheckErrors).To(g.BeEmpty())
+	}
+	g.Expect(builder.Checker.Calls).To(g.Equal(int32(1)))
+
+	req.Operation.ConsumerId = "api_key:b"
+	cm.Check(context.Background(), req)
+	g.Expect(builder.Checker.Calls).To(g.Equal(int32(2)))
+
+	// results survive a reload that does not change the checker or its CacheParams
+	reload := func(cacheParams string) {
+		cfg := ServicesConfig{}
+		yaml.Unmarshal([]byte(yamlStr+fakechecker+cacheParams), &cfg)
+		cfg, erra := ConvertParams(cfg, reg)
+		g.Expect(erra).To(g.BeEmpty())
+		cm.ConfigChange(&cfg)
+	}
+	reload("\n      cacheparams:\n          ttlsec: 60")
+	cm.Check(context.Background(), req)
+	g.Expect(builder.Checker.Calls).To(g.Equal(int32(2)))
+
+	reload("\n      cacheparams:\n          ttlsec: 30")
+	cm.Check(context.Background(), req)
+	g.Expect(builder.Checker.Calls).To(g.Equal(int32(3)), "new CacheParams start with an empty cache")
+}
+
+func TestCheckerManagerUnload(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := ServicesConfig{}
+	yaml.Unmarshal([]byte(yamlStr+fakechecker), &cfg)
+	builder := fakes.NewCheckerBuilder("fakechecker", nil)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": builder,
+	}
+	cfg, erra := ConvertParams(cfg, reg)
+	g.Expect(erra).To(g.BeEmpty())
+	cm, _ := NewCheckerManager(reg, &cfg)
+
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+	cm.Check(context.Background(), req)
+	chk := builder.Checker
+	cm.Unload()
+	g.Expect(chk.Unloads).To(g.Equal(int32(1)))
+
+	// a subsequent check builds a fresh checker
+	cm.Check(context.Background(), req)
+	g.Expect(builder.Checker).NotTo(g.BeIdenticalTo(chk))
+	g.Expect(chk.Unloads).To(g.Equal(int32(1)))
+}
+
+func TestCheckerManagerConfigChange(t *testing.T) {
+	g.RegisterTestingT(t)
+	builder := fakes.NewCheckerBuilder("fakechecker", nil)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": builder,
+	}
+	newConfig := func(yml string) *ServicesConfig {
+		cfg := ServicesConfig{}
+		yaml.Unmarshal([]byte(yml), &cfg)
+		cfg, erra := ConvertParams(cfg, reg)
+		g.Expect(erra).To(g.BeEmpty())
+		return &cfg
+	}
+	cm, _ := NewCheckerManager(reg, newConfig(yamlStr+fakechecker))
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+	cm.Check(context.Background(), req)
+	chk := builder.Checker
+	g.Expect(cm.Checkers()).To(g.HaveLen(1))
+
+	// same params in a new config generation reuse the checker
+	cm.ConfigChange(newConfig(yamlStr + fakechecker))
+	cm.Check(context.Background(), req)
+	g.Expect(builder.Checker).To(g.BeIdenticalTo(chk))
+	g.Expect(chk.Unloads).To(g.Equal(int32(0)))
+	g.Expect(cm.Checkers()).To(g.HaveLen(1))
+
+	// checkers dropped from config are unloaded
+	cm.ConfigChange(newConfig(yamlStr))
+	g.Expect(chk.Unloads).To(g.Equal(int32(1)))
+	g.Expect(cm.Checkers()).To(g.BeEmpty())
+}
+
+func TestCheckerManagerConfigChangeInFlight(t *testing.T) {
+	g.RegisterTestingT(t)
+	builder := fakes.NewSlowCheckerBuilder("fakechecker", 100*time.Millisecond)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": builder,
+	}
+	newConfig := func(yml string) *ServicesConfig {
+		cfg := ServicesConfig{}
+		yaml.Unmarshal([]byte(yml), &cfg)
+		cfg, erra := ConvertParams(cfg, reg)
+		g.Expect(erra).To(g.BeEmpty())
+		return &cfg
+	}
+	cm, _ := NewCheckerManager(reg, newConfig(yamlStr+fakechecker), CheckDeadline(time.Second))
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+	done := make(chan struct{})
+	go func() {
+		cm.Check(context.Background(), req)
+		close(done)
+	}()
+	g.Eventually(cm.Checkers).Should(g.HaveLen(1))
+	chk := builder.Checker
+
+	// a checker dropped from config is unloaded once the check using it is done
+	cm.ConfigChange(newConfig(yamlStr))
+	g.Expect(cm.Checkers()).To(g.BeEmpty())
+	g.Expect(atomic.LoadInt32(&chk.Unloads)).To(g.Equal(int32(0)))
+	<-done
+	g.Expect(atomic.LoadInt32(&chk.Unloads)).To(g.Equal(int32(1)))
+}
+
+func TestCheckerManagerBuildOutsideLock(t *testing.T) {
+	g.RegisterTestingT(t)
+	release := make(chan struct{})
+	builder := fakes.NewBlockingCheckerBuilder("fakechecker", release)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": builder,
+	}
+	cfg := ServicesConfig{}
+	yaml.Unmarshal([]byte(yamlStr+fakechecker), &cfg)
+	cfg, erra := ConvertParams(cfg, reg)
+	g.Expect(erra).To(g.BeEmpty())
+	cm, _ := NewCheckerManager(reg, &cfg, CheckDeadline(50*time.Millisecond))
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+
+	// checks waiting for the build give up at their deadline
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		resp, err := cm.Check(context.Background(), req)
+		g.Expect(err).To(g.BeNil())
+		g.Expect(time.Since(start)).To(g.BeNumerically("<", time.Second))
+		g.Expect(resp.CheckErrors).To(g.HaveLen(1))
+		g.Expect(resp.CheckErrors[0].Detail).To(g.Equal(context.DeadlineExceeded.Error()))
+	}
+	// the manager is not locked during the build
+	g.Expect(cm.Checkers()).To(g.BeEmpty())
+	cm.ConfigChange(&cfg)
+
+	close(release)
+	g.Eventually(cm.Checkers).Should(g.HaveLen(1))
+	resp, _ := cm.Check(context.Background(), req)
+	g.Expect(resp.CheckErrors).To(g.BeEmpty())
+	g.Expect(atomic.LoadInt32(&builder.Builds)).To(g.Equal(int32(1)), "concurrent checks share a build")
+}
+
+func rolloutCheckerManager(rollout string, opts ...func(*CheckerManager)) (*CheckerManager, []error) {
+	cfg := ServicesConfig{}
+	yaml.Unmarshal([]byte(yamlStr+fakechecker+rollout), &cfg)
+	reg := map[string]CheckerBuilder{
+		"fakechecker": fakes.NewDenyingCheckerBuilder("fakechecker", &sc.CheckError{Code: sc.CheckError_IP_ADDRESS_BLOCKED}),
+	}
+	cfg, erra := ConvertParams(cfg, reg)
+	cm, _ := NewCheckerManager(reg, &cfg, opts...)
+	return cm, erra
+}
+
+func decisionCount(cm *CheckerManager, mode string, decision string) int64 {
+	return cm.Decisions()[DecisionKey{Service: EveryService, Kind: "fakechecker", Mode: mode, Decision: decision}]
+}
+
+func TestCheckerManagerShadow(t *testing.T) {
+	g.RegisterTestingT(t)
+	cm, erra := rolloutCheckerManager("\n      rollout:\n          shadow: true")
+	g.Expect(erra).To(g.BeEmpty())
+	for i := 0; i < 3; i++ {
+		// decisions are labeled by the configured service, not the requested one
+		req := &sc.CheckRequest{ServiceName: fmt.Sprintf("shadowsvc%d", i), Operation: &sc.Operation{ConsumerId: "api_key:a"}}
+		resp, err := cm.Check(context.Background(), req)
+		g.Expect(err).To(g.BeNil())
+		g.Expect(resp.CheckErrors).To(g.BeEmpty())
+	}
+	g.Expect(cm.Decisions()).To(g.HaveLen(1))
+	g.Expect(decisionCount(cm, ModeShadow, "IP_ADDRESS_BLOCKED")).To(g.Equal(int64(3)))
+
+	// decisions of checkers without rollout params are not recorded
+	recorder := NewDecisionRecorder()
+	cm, _ = rolloutCheckerManager("", RecordDecisions(recorder))
+	resp, _ := cm.Check(context.Background(), &sc.CheckRequest{ServiceName: "unstagedsvc", Operation: &sc.Operation{ConsumerId: "api_key:a"}})
+	g.Expect(resp.CheckErrors).To(g.HaveLen(1))
+	g.Expect(recorder.Decisions()).To(g.BeEmpty())
+}
+
+func TestCheckerManagerRolloutPercent(t *testing.T) {
+	g.RegisterTestingT(t)
+	cm, erra := rolloutCheckerManager("\n      rollout:\n          percent: 50")
+	g.Expect(erra).To(g.BeEmpty())
+	denied := 0
+	for i := 0; i < 200; i++ {
+		req := &sc.CheckRequest{ServiceName: "rampsvc", Operation: &sc.Operation{ConsumerId: fmt.Sprintf("api_key:%d", i)}}
+		resp, err := cm.Check(context.Background(), req)
+		g.Expect(err).To(g.BeNil())
+		// the decision is stable for a consumer
+		again, _ := cm.Check(context.Background(), req)
+		g.Expect(again.CheckErrors).To(g.HaveLen(len(resp.CheckErrors)))
+		denied += len(resp.CheckErrors)
+	}
+	g.Expect(denied).To(g.BeNumerically("~", 100, 30))
+	g.Expect(decisionCount(cm, ModeEnforced, "IP_ADDRESS_BLOCKED")).To(g.Equal(int64(2 * denied)))
+	g.Expect(decisionCount(cm, ModeShadow, "IP_ADDRESS_BLOCKED")).To(g.Equal(int64(2 * (200 - denied))))
+
+	// a ramp starts at 0, every decision is recorded and none enforced
+	cm, erra = rolloutCheckerManager("\n      rollout:\n          percent: 0")
+	g.Expect(erra).To(g.BeEmpty())
+	resp, _ := cm.Check(context.Background(), &sc.CheckRequest{ServiceName: "rampsvc", Operation: &sc.Operation{ConsumerId: "api_key:a"}})
+	g.Expect(resp.CheckErrors).To(g.BeEmpty())
+	g.Expect(decisionCount(cm, ModeShadow, "IP_ADDRESS_BLOCKED")).To(g.Equal(int64(1)))
+}
+
+func percent(p int) *int {
+	return &p
+}
+
+func TestRolloutEnforced(t *testing.T) {
+	g.RegisterTestingT(t)
+	g.Expect(RolloutParams{}.Enforced("api_key:a")).To(g.BeTrue())
+	g.Expect(RolloutParams{}.Staged()).To(g.BeFalse())
+	g.Expect(RolloutParams{Percent: percent(100)}.Enforced("api_key:a")).To(g.BeTrue())
+	g.Expect(RolloutParams{Percent: percent(0)}.Enforced("api_key:a")).To(g.BeFalse())
+	g.Expect(RolloutParams{Percent: percent(0)}.Staged()).To(g.BeTrue())
+	g.Expect(RolloutParams{Shadow: true, Percent: percent(100)}.Enforced("api_key:a")).To(g.BeFalse())
+	// consumers stay enforced as the ramp grows
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("project:%d", i)
+		if (RolloutParams{Percent: percent(10)}).Enforced(id) {
+			g.Expect(RolloutParams{Percent: percent(50)}.Enforced(id)).To(g.BeTrue(), id)
+		}
+	}
+}
+
+func TestCheckerManagerRolloutInvalid(t *testing.T) {
+	g.RegisterTestingT(t)
+	for _, rollout := range []string{
+		"\n      rollout:\n          percent: 150",
+		"\n      rollout:\n          percent: -1",
+	} {
+		_, erra := rolloutCheckerManager(rollout)
+		g.Expect(erra).To(g.HaveLen(1), rollout)
+	}
+}
+
+func TestCheckerManagerBuildFailure(t *testing.T) {
+	g.RegisterTestingT(t)
+	req := &sc.CheckRequest{Operation: &sc.Operation{OperationId: "oprn"}}
+	for _, tc := range []struct {
+		policy string
+		errors int
+	}{
+		{"", 1},
+		{"\n      failurepolicy:\n          mode: open", 0},
+	} {
+		cfg := ServicesConfig{}
+		yaml.Unmarshal([]byte(yamlStr+fakechecker+tc.policy), &cfg)
+		reg := map[string]CheckerBuilder{
+			"fakechecker": fakes.NewCheckerBuilder("fakechecker", errors.New("unable to build")),
+		}
+		cfg, erra := ConvertParams(cfg, reg)
+		g.Expect(erra).To(g.BeEmpty())
+		cm, _ := NewCheckerManager(reg, &cfg)
+		resp, err := cm.Check(context.Background(), req)
+		g.Expect(err).To(g.BeNil())
+		g.Expect(resp.CheckErrors).To(g.HaveLen(tc.errors), tc.policy)
+		if tc.errors > 0 {
+			g.Expect(resp.CheckErrors[0].Detail).To(g.Equal("unable to build"))
+		}
+	}
+}
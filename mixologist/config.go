@@ -2,6 +2,7 @@ package mixologist
 
 import (
 	"errors"
+	sc "google/api/servicecontrol/v1"
 	"reflect"
 	"strings"
 
@@ -18,7 +19,19 @@ type (
 	// CacheParams -- configure caching behaviour
 	// When adapter replies are cacheable, these params
 	// configure behavious of the cache
+	// These params should be used by the framework, *not* the adapter itself
 	CacheParams struct {
+		// TTLSec -- seconds an allow result is cached. 0 does not cache allow results
+		TTLSec int
+		// NegativeTTLSec -- seconds a deny (CheckError) result is cached. 0 does not cache denials
+		NegativeTTLSec int
+		// MaxEntries -- least recently used results are evicted beyond this. default: DefaultCacheMaxEntries
+		MaxEntries int
+		// Fields -- CheckRequest fields forming the cache key.
+		// service_name, consumer_id, operation_name. default: all of them
+		Fields []string `yaml:",omitempty"`
+		// Labels -- Operation.Labels that also form the cache key
+		Labels []string `yaml:",omitempty"`
 	}
 
 	// BatchParams -- configure batching behaviour of the adapter
@@ -27,6 +40,32 @@ type (
 		Size       int
 		TimeoutSec int
 	}
+	// FailureMode -- how an adapter error or timeout affects the request
+	FailureMode string
+
+	// FailurePolicy -- configure what the framework does when an adapter
+	// returns an error or does not respond in time.
+	// These params should be used by the framework, *not* the adapter itself
+	FailurePolicy struct {
+		// Mode -- FailClosed (default) or FailOpen
+		Mode FailureMode
+		// Code -- name of the CheckError_Code returned when failing closed
+		// ex: QUOTA_CHECK_UNAVAILABLE. default: PERMISSION_DENIED
+		Code string
+	}
+
+	// RolloutParams -- stage the enforcement of a checker
+	// Decisions of staged checkers are recorded, see DecisionRecorder.
+	// These params should be used by the framework, *not* the adapter itself
+	RolloutParams struct {
+		// Shadow -- evaluate and record every decision, enforce none
+		Shadow bool
+		// Percent -- percent of consumers, keyed by consumer id, the decision is enforced for.
+		// Decisions for the rest are shadowed, so a ramp may start at 0.
+		// default: unset, enforce for every consumer
+		Percent *int
+	}
+
 	// ConstructorParams -- 'Kind' is the adapter type
 	// And Params are passed to the Kind constructor
 	// This struct is sufficient to create a adapter
@@ -40,6 +79,8 @@ type (
 	AdapterParams struct {
 		// Identifier of this adapter
 		// should be unique within Kind, optional
+		// An adapter with an ID overrides the adapter of the same Kind and ID
+		// of a less specific scope, see ServicesConfig.Resolve
 		ID string
 		// ConstructorParams embedded
 		ConstructorParams `yaml:",omitempty,inline"`
@@ -49,6 +90,12 @@ type (
 
 		// batching params
 		BatchParams BatchParams `yaml:",omitempty"`
+
+		// failure policy
+		FailurePolicy FailurePolicy `yaml:",omitempty"`
+
+		// rollout params, only used by checkers
+		Rollout RolloutParams `yaml:",omitempty"`
 	}
 
 	// AdapterConfig -- in the given context
@@ -56,6 +103,8 @@ type (
 	AdapterConfig struct {
 		Checkers  []*AdapterParams `yaml:",omitempty"`
 		Reporters []*AdapterParams `yaml:",omitempty"`
+		// Disable -- IDs of adapters of less specific scopes that do not apply
+		Disable []string `yaml:",omitempty"`
 		// other functions
 	}
 	// BindingConfig -- same as adapter config + service
@@ -118,6 +167,45 @@ const (
 	RPCReport RPCMethod = "REPORT"
 )
 
+const (
+	// FailClosed -- deny the request with FailurePolicy.Code
+	FailClosed FailureMode = "closed"
+	// FailOpen -- allow the request; the failure is logged as a warning
+	FailOpen FailureMode = "open"
+)
+
+// Validate -- ensure mode and code are known
+func (p FailurePolicy) Validate() error {
+	switch p.Mode {
+	case "", FailClosed, FailOpen:
+	default:
+		return errors.New("Unknown failure mode '" + string(p.Mode) + "'")
+	}
+	if p.Code != "" {
+		if _, found := sc.CheckError_Code_value[p.Code]; !found {
+			return errors.New("Unknown CheckError code '" + p.Code + "'")
+		}
+	}
+	return nil
+}
+
+// CheckError -- apply the policy to an error returned by the adapter.
+// Returns nil if the request should be allowed to proceed
+func (p FailurePolicy) CheckError(kind string, err error) *sc.CheckError {
+	if p.Mode == FailOpen {
+		glog.Warningf("%s failed open: %s", kind, err)
+		return nil
+	}
+	code := sc.CheckError_PERMISSION_DENIED
+	if p.Code != "" {
+		code = sc.CheckError_Code(sc.CheckError_Code_value[p.Code])
+	}
+	return &sc.CheckError{
+		Code:   code,
+		Detail: err.Error(),
+	}
+}
+
 // Error -- conform to error interface
 func (e DecodeError) Error() string {
 	return e.err.Error()
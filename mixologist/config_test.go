@@ -178,3 +178,39 @@ var (
 		},
 	}
 )
+
+func TestConvertReporterParams(t *testing.T) {
+	data, _ := ioutil.ReadFile(path.Join(DirName, "config/config_test.yml"))
+	osc := ServicesConfig{}
+	if err := yaml.Unmarshal(data, &osc); err != nil {
+		t.Error("Unmarshal failed", err)
+	}
+	reg := map[string]ReportConsumerBuilder{
+		"statsd": fakes.NewBuilder("statsd", nil),
+	}
+	osc, erra := ConvertReporterParams(osc, reg)
+	for _, er := range erra {
+		if !strings.HasSuffix(er.Error(), "is not available") {
+			t.Errorf("Got errors while converting %#v", er)
+		}
+	}
+	reporters := osc[InventoryService].Self.Reporters
+	if len(reporters) != 1 {
+		t.Fatalf("Expected: [ 1 ] reporter\nGot: [ %v ]", len(reporters))
+	}
+	ru, converted := reporters[0].Params.(*RuntimeAdapterState)
+	if !converted {
+		t.Fatalf("Expected: *RuntimeAdapterState\nGot: [ %#v ]", reporters[0].Params)
+	}
+	if ru.Builder != reg["statsd"] {
+		t.Errorf("Expected: [ %v ]\nGot: [ %v ]", reg["statsd"], ru.Builder)
+	}
+	// unknown kinds are removed
+	if len(osc[EveryService].Ingress.Reporters) != 0 {
+		t.Errorf("Expected: unknown reporter removed\nGot: [ %#v ]", osc[EveryService].Ingress.Reporters)
+	}
+	// checkers are untouched
+	if _, converted := osc[InventoryService].Ingress.Checkers[0].Params.(*RuntimeAdapterState); converted {
+		t.Errorf("Expected: checkers not converted")
+	}
+}
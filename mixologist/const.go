@@ -1,12 +1,26 @@
 package mixologist
 
+import "time"
+
 const (
 	// Port -- Default server port
 	Port = 9092
+	// GRPCPort -- Default grpc server port
+	GRPCPort = 9093
+	// AdminAddr -- Default address of admin endpoints, loopback only
+	AdminAddr = "localhost:9094"
 	// NConsumers -- number of consumer threads
 	NConsumers = 2
+	// DefaultCheckDeadline -- default upper bound on time spent in checkers per Check
+	DefaultCheckDeadline = time.Second
+	// DefaultDrainTimeout -- default upper bound on graceful shutdown
+	DefaultDrainTimeout = 30 * time.Second
 	// CheckSuffix -- to identify a POST request as check
 	CheckSuffix = ":check"
 	// ReportSuffix -- to identify a POST request as report
 	ReportSuffix = ":report"
+	// ContentTypeJSON -- request and response bodies use the proto3 JSON mapping
+	ContentTypeJSON = "application/json"
+	// ContentTypeProtobuf -- request and response bodies use binary protobuf (default)
+	ContentTypeProtobuf = "application/x-protobuf"
 )
@@ -1,10 +1,15 @@
 package mixologist
 
 import (
+	"errors"
+
 	"golang.org/x/net/context"
 	sc "google/api/servicecontrol/v1"
 )
 
+// ErrControllerClosed -- returned by Report once the controller is closed
+var ErrControllerClosed = errors.New("controller closed")
+
 // Check implementation
 func (c *ControllerImpl) Check(ctx context.Context, msg *sc.CheckRequest) (*sc.CheckResponse, error) {
 	return c.checkerManager.Check(ctx, msg)
@@ -12,6 +17,11 @@ func (c *ControllerImpl) Check(ctx context.Context, msg *sc.CheckRequest) (*sc.C
 
 // Report into a log file
 func (c *ControllerImpl) Report(ctx context.Context, msg *sc.ReportRequest) (*sc.ReportResponse, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.closed {
+		return nil, ErrControllerClosed
+	}
 	c.reportQueue <- msg
 	resp := &sc.ReportResponse{}
 	return resp, nil
@@ -22,6 +32,17 @@ func (c *ControllerImpl) ReportQueue() chan *sc.ReportRequest {
 	return c.reportQueue
 }
 
+// Close -- reject further reports and close the report queue once reports
+// already being queued are delivered. Handlers may still be running.
+func (c *ControllerImpl) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.reportQueue)
+	}
+}
+
 // NewControllerImpl - return a newly created controller
 func NewControllerImpl(cm *CheckerManager) Controller {
 	return &ControllerImpl{
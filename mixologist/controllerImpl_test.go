@@ -48,6 +48,20 @@ var _ = gn.Describe("ControllerImpl", func() {
 			})
 		})
 	})
+	gn.Describe("Given: Close()", func() {
+		gn.Context("when: called", func() {
+			gn.It("then: closes the report queue and rejects further reports", func() {
+				ctrl := NewControllerImpl(checkerMgr)
+				ctrl.Close()
+				_, open := <-ctrl.ReportQueue()
+				g.Expect(open).To(g.BeFalse())
+
+				_, err := ctrl.Report(nil, &sc.ReportRequest{})
+				g.Expect(err).To(g.Equal(ErrControllerClosed))
+				ctrl.Close()
+			})
+		})
+	})
 	gn.Describe("Given: Check()", func() {
 		var (
 			operationID = "CHECK_OPRN"
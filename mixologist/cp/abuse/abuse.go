@@ -0,0 +1,111 @@
+package abuse
+
+import (
+	"errors"
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+	mixologist.RegisterReportConsumer(Name, new(consumerBuilder))
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+func (c *checker) Unload() {}
+
+// subjectID -- consumer id or caller ip of the operation
+func subjectID(op *sc.Operation, keyBy string) string {
+	if keyBy == KeyConsumerID {
+		return op.ConsumerId
+	}
+	return op.GetLabels()[ClientIPKey]
+}
+
+// abusive -- counts of subject exceed a threshold
+func (c *checker) abusive(s subject) bool {
+	requests, errors := c.tracker.window(s, c.cfg.WindowSec)
+	if c.cfg.MaxRequests > 0 && requests > c.cfg.MaxRequests {
+		glog.Warningf("%s %s=%s sent %d requests, more than %d", s.service, s.keyBy, s.id, requests, c.cfg.MaxRequests)
+		return true
+	}
+	if c.cfg.MaxErrorRate > 0 && requests >= c.cfg.MinRequests && requests > 0 &&
+		float64(errors)/float64(requests) > c.cfg.MaxErrorRate {
+		glog.Warningf("%s %s=%s error rate %d/%d exceeds %f", s.service, s.keyBy, s.id, errors, requests, c.cfg.MaxErrorRate)
+		return true
+	}
+	return false
+}
+
+// Check -- reject banned consumers and ips, ban those whose counts exceed a threshold
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	op := cr.GetOperation()
+	if op == nil {
+		return nil, nil
+	}
+	for _, keyBy := range c.cfg.KeyBy {
+		s := subject{service: cr.ServiceName, keyBy: keyBy, id: subjectID(op, keyBy)}
+		if s.id == "" || mixologist.MatchID(c.cfg.Exempt, s.id) {
+			continue
+		}
+		if c.tracker.banned(s) {
+			return AbuserDetectedCheckError, nil
+		}
+		if c.abusive(s) {
+			c.tracker.ban(s, time.Duration(c.cfg.BanSec)*time.Second)
+			return AbuserDetectedCheckError, nil
+		}
+	}
+	return nil, nil
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	return &checker{
+		cfg:     cfg.(*Config),
+		tracker: signals,
+	}, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		WindowSec:   DefaultWindowSec,
+		MinRequests: DefaultMinRequests,
+		BanSec:      DefaultBanSec,
+		KeyBy:       []string{KeyConsumerID, KeyCallerIP},
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	lcfg := cfg.(*Config)
+	switch {
+	case lcfg.WindowSec <= 0 || lcfg.WindowSec > MaxWindowSec:
+		return errors.New("WindowSec must be between 1 and 600")
+	case lcfg.MinRequests < 0 || lcfg.MaxRequests < 0:
+		return errors.New("MinRequests and MaxRequests cannot be negative")
+	case lcfg.MaxErrorRate < 0 || lcfg.MaxErrorRate > 1:
+		return errors.New("MaxErrorRate must be between 0 and 1")
+	case lcfg.MaxRequests == 0 && lcfg.MaxErrorRate == 0:
+		return errors.New("One of MaxRequests or MaxErrorRate is required")
+	case lcfg.BanSec <= 0:
+		return errors.New("BanSec must be positive")
+	case len(lcfg.KeyBy) == 0:
+		return errors.New("KeyBy cannot be empty")
+	}
+	for _, k := range lcfg.KeyBy {
+		if k != KeyConsumerID && k != KeyCallerIP {
+			return fmt.Errorf("invalid KeyBy %#v, must be %s or %s", k, KeyConsumerID, KeyCallerIP)
+		}
+	}
+	return nil
+}
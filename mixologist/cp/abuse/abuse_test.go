@@ -0,0 +1,246 @@
+package abuse
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// report -- requests of consumerID from ip answered with code
+func report(service string, consumerID string, ip string, requests int64, code string) *sc.ReportRequest {
+	return &sc.ReportRequest{
+		ServiceName: service,
+		Operations: []*sc.Operation{{
+			ConsumerId: consumerID,
+			Labels:     map[string]string{ClientIPKey: ip},
+			MetricValueSets: []*sc.MetricValueSet{
+				{
+					MetricName: mixologist.ProducerRequestCountByConsumer,
+					MetricValues: []*sc.MetricValue{{
+						Labels: map[string]string{mixologist.ResponseCode: code},
+						Value:  &sc.MetricValue_Int64Value{Int64Value: requests},
+					}},
+				},
+				{
+					// other metrics are ignored
+					MetricName: mixologist.ProducerRequestCount,
+					MetricValues: []*sc.MetricValue{
+						{Value: &sc.MetricValue_Int64Value{Int64Value: 1000}},
+					},
+				},
+			},
+		}},
+	}
+}
+
+func newTestTracker() (*tracker, *clock) {
+	clk := &clock{t: time.Unix(1475272930, 0)}
+	t := newTracker()
+	t.now = clk.now
+	return t, clk
+}
+
+func buildChecker(cfg *Config, t *tracker) *checker {
+	b := new(builder)
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	chk := c.(*checker)
+	chk.tracker = t
+	return chk
+}
+
+func checkRequest(service string, consumerID string, ip string) *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: service,
+		Operation: &sc.Operation{
+			ConsumerId: consumerID,
+			Labels:     map[string]string{ClientIPKey: ip},
+		},
+	}
+}
+
+func TestTrackerWindow(t *testing.T) {
+	g.RegisterTestingT(t)
+	tr, clk := newTestTracker()
+	tr.record(report("bookstore", "api_key:aaaa", "10.0.0.1", 90, "200"))
+	tr.record(report("bookstore", "api_key:aaaa", "10.0.0.2", 10, "403"))
+	clk.advance(30 * time.Second)
+	tr.record(report("bookstore", "api_key:aaaa", "10.0.0.1", 100, "503"))
+	tr.record(report("library", "api_key:aaaa", "10.0.0.1", 5, "404"))
+
+	consumer := subject{service: "bookstore", keyBy: KeyConsumerID, id: "api_key:aaaa"}
+	requests, errors := tr.window(consumer, 60)
+	g.Expect(requests).To(g.Equal(int64(200)))
+	g.Expect(errors).To(g.Equal(int64(110)))
+
+	requests, errors = tr.window(subject{service: "bookstore", keyBy: KeyCallerIP, id: "10.0.0.1"}, 60)
+	g.Expect(requests).To(g.Equal(int64(190)))
+	g.Expect(errors).To(g.Equal(int64(100)))
+
+	// the first bucket falls out of a 20 second window
+	requests, _ = tr.window(consumer, 20)
+	g.Expect(requests).To(g.Equal(int64(100)))
+
+	requests, _ = tr.window(subject{service: "library", keyBy: KeyConsumerID, id: "api_key:aaaa"}, 60)
+	g.Expect(requests).To(g.Equal(int64(5)))
+	requests, _ = tr.window(subject{service: "shop", keyBy: KeyConsumerID, id: "api_key:aaaa"}, 60)
+	g.Expect(requests).To(g.Equal(int64(0)))
+
+	// idle subjects are swept
+	clk.advance(MaxWindowSec * time.Second)
+	tr.record(report("bookstore", "api_key:bbbb", "10.0.0.3", 1, "200"))
+	g.Expect(tr.counts).To(g.HaveLen(2))
+}
+
+func TestResponseCodeClass(t *testing.T) {
+	g.RegisterTestingT(t)
+	tr, _ := newTestTracker()
+	rr := report("bookstore", "api_key:aaaa", "", 7, "")
+	rr.Operations[0].Labels[mixologist.ResponseCodeClass] = "4xx"
+	tr.record(rr)
+	requests, errors := tr.window(subject{service: "bookstore", keyBy: KeyConsumerID, id: "api_key:aaaa"}, 60)
+	g.Expect(requests).To(g.Equal(int64(7)))
+	g.Expect(errors).To(g.Equal(int64(7)))
+	g.Expect(tr.counts).To(g.HaveLen(1), "empty caller ip is not tracked")
+}
+
+func TestBanOnErrorRate(t *testing.T) {
+	g.RegisterTestingT(t)
+	tr, clk := newTestTracker()
+	cfg := new(builder).ConfigStruct().(*Config)
+	cfg.MaxErrorRate = 0.5
+	cfg.Exempt = []string{"project:internal-*"}
+	chk := buildChecker(cfg, tr)
+
+	tr.record(report("bookstore", "api_key:aaaa", "10.0.0.1", 60, "401"))
+	ce, err := chk.Check(context.Background(), checkRequest("bookstore", "api_key:aaaa", "10.0.0.9"))
+	g.Expect(err).To(g.BeNil())
+	g.Expect(ce).To(g.BeNil(), "too few requests to decide")
+
+	tr.record(report("bookstore", "api_key:aaaa", "10.0.0.1", 40, "200"))
+	tr.record(report("bookstore", "project:internal-tools", "10.0.0.2", 100, "500"))
+	ce, _ = chk.Check(context.Background(), checkRequest("bookstore", "api_key:aaaa", "10.0.0.9"))
+	g.Expect(ce).To(g.Equal(AbuserDetectedCheckError))
+	ce, _ = chk.Check(context.Background(), checkRequest("library", "api_key:aaaa", "10.0.0.9"))
+	g.Expect(ce).To(g.BeNil(), "other services are not affected")
+	ce, _ = chk.Check(context.Background(), checkRequest("bookstore", "project:internal-tools", ""))
+	g.Expect(ce).To(g.BeNil(), "exempt consumer")
+	// the caller ip of the abuser is banned as well
+	ce, _ = chk.Check(context.Background(), checkRequest("bookstore", "api_key:bbbb", "10.0.0.1"))
+	g.Expect(ce).To(g.Equal(AbuserDetectedCheckError))
+
+	// reports while banned are not counted
+	tr.record(report("bookstore", "api_key:aaaa", "10.0.0.9", 1000, "403"))
+	clk.advance(time.Duration(cfg.BanSec) * time.Second)
+	ce, _ = chk.Check(context.Background(), checkRequest("bookstore", "api_key:aaaa", "10.0.0.9"))
+	g.Expect(ce).To(g.BeNil(), "ban expired")
+	g.Expect(tr.list()).To(g.BeEmpty())
+}
+
+func TestBanOnRequests(t *testing.T) {
+	g.RegisterTestingT(t)
+	tr, _ := newTestTracker()
+	cfg := new(builder).ConfigStruct().(*Config)
+	cfg.MaxRequests = 50
+	cfg.KeyBy = []string{KeyCallerIP}
+	cfg.BanSec = 60
+	chk := buildChecker(cfg, tr)
+
+	tr.record(report("bookstore", "api_key:aaaa", "10.0.0.1", 50, "200"))
+	ce, _ := chk.Check(context.Background(), checkRequest("bookstore", "api_key:aaaa", "10.0.0.1"))
+	g.Expect(ce).To(g.BeNil())
+
+	tr.record(report("bookstore", "api_key:aaaa", "10.0.0.1", 1, "200"))
+	ce, _ = chk.Check(context.Background(), checkRequest("bookstore", "api_key:aaaa", "10.0.0.1"))
+	g.Expect(ce).To(g.Equal(AbuserDetectedCheckError))
+	ce, _ = chk.Check(context.Background(), checkRequest("bookstore", "api_key:aaaa", "10.0.0.2"))
+	g.Expect(ce).To(g.BeNil(), "only the caller ip is banned")
+
+	bans := tr.list()
+	g.Expect(bans).To(g.HaveLen(1))
+	g.Expect(bans[0].KeyBy).To(g.Equal(KeyCallerIP))
+	g.Expect(bans[0].ID).To(g.Equal("10.0.0.1"))
+	g.Expect(bans[0].Expires).To(g.Equal(tr.now().Add(60 * time.Second)))
+}
+
+func TestBanHandler(t *testing.T) {
+	g.RegisterTestingT(t)
+	tr, _ := newTestTracker()
+	h := &banHandler{tracker: tr}
+	g.Expect((&consumer{tracker: tr}).GetPrefixAndHandler()).To(g.BeNil(), "not served on the public port")
+
+	tr.ban(subject{service: "bookstore", keyBy: KeyConsumerID, id: "api_key:aaaa"}, time.Minute)
+	tr.ban(subject{service: "library", keyBy: KeyConsumerID, id: "api_key:aaaa"}, time.Minute)
+	tr.ban(subject{service: "bookstore", keyBy: KeyCallerIP, id: "10.0.0.1"}, time.Minute)
+
+	serve := func(method string, url string) (*httptest.ResponseRecorder, []Ban) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		var bans []Ban
+		if w.Code == http.StatusOK {
+			g.Expect(json.Unmarshal(w.Body.Bytes(), &bans)).To(g.Succeed())
+		}
+		return w, bans
+	}
+
+	w, bans := serve("GET", Prefix)
+	g.Expect(w.Code).To(g.Equal(http.StatusOK))
+	g.Expect(bans).To(g.HaveLen(3))
+	g.Expect(bans[0].Service).To(g.Equal("bookstore"))
+	g.Expect(bans[0].KeyBy).To(g.Equal(KeyCallerIP))
+
+	w, bans = serve("DELETE", Prefix+"?id=api_key:aaaa&service=library")
+	g.Expect(w.Code).To(g.Equal(http.StatusOK))
+	g.Expect(bans).To(g.HaveLen(1))
+	g.Expect(bans[0].Service).To(g.Equal("library"))
+
+	w, bans = serve("DELETE", Prefix+"?id=api_key:aaaa")
+	g.Expect(w.Code).To(g.Equal(http.StatusOK))
+	g.Expect(bans).To(g.HaveLen(1))
+
+	w, _ = serve("DELETE", Prefix+"?id=api_key:aaaa")
+	g.Expect(w.Code).To(g.Equal(http.StatusNotFound))
+	w, _ = serve("DELETE", Prefix)
+	g.Expect(w.Code).To(g.Equal(http.StatusBadRequest))
+	w, _ = serve("POST", Prefix)
+	g.Expect(w.Code).To(g.Equal(http.StatusMethodNotAllowed))
+
+	_, bans = serve("GET", Prefix)
+	g.Expect(bans).To(g.HaveLen(1))
+	g.Expect(bans[0].ID).To(g.Equal("10.0.0.1"))
+}
+
+func TestValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	for _, mod := range []func(*Config){
+		func(c *Config) { c.MaxRequests = 0 },
+		func(c *Config) { c.WindowSec = MaxWindowSec + 1 },
+		func(c *Config) { c.MaxErrorRate = 1.5 },
+		func(c *Config) { c.BanSec = 0 },
+		func(c *Config) { c.KeyBy = nil },
+		func(c *Config) { c.KeyBy = []string{"api_method"} },
+	} {
+		cfg := b.ConfigStruct().(*Config)
+		cfg.MaxRequests = 100
+		g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+		mod(cfg)
+		g.Expect(b.ValidateConfig(cfg)).NotTo(g.Succeed())
+	}
+}
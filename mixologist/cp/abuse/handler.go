@@ -0,0 +1,45 @@
+package abuse
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+// Handler -- serves Prefix for the bans of the process
+// It is mounted on the admin address whether abuse is configured by flag or YAML
+func Handler() http.Handler {
+	return &banHandler{tracker: signals}
+}
+
+// ServeHTTP -- GET lists active bans
+// DELETE ?id=<consumer id or ip>[&service=<name>][&key_by=consumer_id|caller_ip] lifts them
+func (h *banHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var bans []Ban
+	switch r.Method {
+	case http.MethodGet:
+		bans = h.tracker.list()
+	case http.MethodDelete:
+		q := r.URL.Query()
+		id := q.Get("id")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		bans = h.tracker.lift(q.Get("service"), q.Get("key_by"), id)
+		if len(bans) == 0 {
+			http.Error(w, "no active ban for "+id, http.StatusNotFound)
+			return
+		}
+		glog.Infof("Lifted bans %v", bans)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bans); err != nil {
+		glog.Warningf("Unable to write bans: %v", err)
+	}
+}
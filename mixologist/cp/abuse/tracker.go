@@ -0,0 +1,232 @@
+package abuse
+
+import (
+	sc "google/api/servicecontrol/v1"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+)
+
+func newTracker() *tracker {
+	return &tracker{
+		counts: make(map[subject]*counts),
+		bans:   make(map[subject]time.Time),
+		now:    time.Now,
+	}
+}
+
+// isError -- the response is a 4xx or 5xx
+func isError(mv *sc.MetricValue, op *sc.Operation) bool {
+	if code := mixologist.MetricLabel(mv, op, mixologist.ResponseCode); code != "" {
+		n, err := strconv.Atoi(code)
+		return err == nil && n >= 400
+	}
+	class := mixologist.MetricLabel(mv, op, mixologist.ResponseCodeClass)
+	return class == "4xx" || class == "5xx"
+}
+
+// bannedLocked -- subject has an active ban, expired bans are dropped
+// must be called with t.lock held
+func (t *tracker) bannedLocked(s subject, now time.Time) bool {
+	expires, found := t.bans[s]
+	if !found {
+		return false
+	}
+	if !now.Before(expires) {
+		delete(t.bans, s)
+		return false
+	}
+	return true
+}
+
+// add -- count requests of a subject
+// must be called with t.lock held
+func (t *tracker) add(s subject, sec int64, requests int64, errors int64) {
+	c, found := t.counts[s]
+	if !found {
+		c = &counts{}
+		t.counts[s] = c
+	}
+	start := sec - sec%BucketSec
+	b := &c.buckets[(start/BucketSec)%int64(len(c.buckets))]
+	if b.start != start {
+		*b = bucket{start: start}
+	}
+	b.requests += requests
+	b.errors += errors
+	c.last = sec
+}
+
+// sweep -- drop idle subjects and expired bans at most once per MaxWindowSec
+// must be called with t.lock held
+func (t *tracker) sweep(now time.Time) {
+	sec := now.Unix()
+	if sec-t.swept < MaxWindowSec {
+		return
+	}
+	t.swept = sec
+	for s, c := range t.counts {
+		if c.last <= sec-MaxWindowSec {
+			delete(t.counts, s)
+		}
+	}
+	for s := range t.bans {
+		t.bannedLocked(s, now)
+	}
+}
+
+// record -- add per consumer and per caller ip request and error counts of the report
+// Reports of banned subjects are not counted so that a ban expires into a clean window.
+func (t *tracker) record(rr *sc.ReportRequest) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	t.sweep(now)
+	for _, op := range rr.GetOperations() {
+		for _, mvs := range op.GetMetricValueSets() {
+			if mvs.MetricName != mixologist.ProducerRequestCountByConsumer {
+				continue
+			}
+			for _, mv := range mvs.GetMetricValues() {
+				requests := mv.GetInt64Value()
+				var errors int64
+				if isError(mv, op) {
+					errors = requests
+				}
+				consumerID := mixologist.MetricLabel(mv, op, mixologist.ConsumerID)
+				if consumerID == "" {
+					consumerID = op.ConsumerId
+				}
+				for _, s := range []subject{
+					{service: rr.ServiceName, keyBy: KeyConsumerID, id: consumerID},
+					{service: rr.ServiceName, keyBy: KeyCallerIP, id: mixologist.MetricLabel(mv, op, ClientIPKey)},
+				} {
+					if s.id == "" || t.bannedLocked(s, now) {
+						continue
+					}
+					t.add(s, now.Unix(), requests, errors)
+				}
+			}
+		}
+	}
+}
+
+// window -- requests and errors of subject over the last windowSec seconds
+func (t *tracker) window(s subject, windowSec int) (requests int64, errors int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	c, found := t.counts[s]
+	if !found {
+		return 0, 0
+	}
+	oldest := t.now().Unix() - int64(windowSec)
+	for i := range c.buckets {
+		b := &c.buckets[i]
+		// a bucket counts if any part of it is inside the window
+		if b.start+BucketSec <= oldest {
+			continue
+		}
+		requests += b.requests
+		errors += b.errors
+	}
+	return requests, errors
+}
+
+// banned -- subject has an active ban
+func (t *tracker) banned(s subject) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.bannedLocked(s, t.now())
+}
+
+// ban -- ban subject for d, its counts start over
+func (t *tracker) ban(s subject, d time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.bans[s] = t.now().Add(d)
+	delete(t.counts, s)
+}
+
+// list -- active bans ordered by service, keyBy and id
+func (t *tracker) list() []Ban {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	bans := make([]Ban, 0, len(t.bans))
+	for s, expires := range t.bans {
+		if t.bannedLocked(s, now) {
+			bans = append(bans, Ban{Service: s.service, KeyBy: s.keyBy, ID: s.id, Expires: expires})
+		}
+	}
+	sort.Sort(byBan(bans))
+	return bans
+}
+
+// lift -- remove active bans of id, an empty service or keyBy matches any
+func (t *tracker) lift(service string, keyBy string, id string) []Ban {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	lifted := []Ban{}
+	for s, expires := range t.bans {
+		if s.id != id || (service != "" && s.service != service) || (keyBy != "" && s.keyBy != keyBy) {
+			continue
+		}
+		if t.bannedLocked(s, now) {
+			lifted = append(lifted, Ban{Service: s.service, KeyBy: s.keyBy, ID: s.id, Expires: expires})
+			delete(t.bans, s)
+		}
+	}
+	sort.Sort(byBan(lifted))
+	return lifted
+}
+
+type byBan []Ban
+
+func (b byBan) Len() int      { return len(b) }
+func (b byBan) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byBan) Less(i, j int) bool {
+	if b[i].Service != b[j].Service {
+		return b[i].Service < b[j].Service
+	}
+	if b[i].KeyBy != b[j].KeyBy {
+		return b[i].KeyBy < b[j].KeyBy
+	}
+	return b[i].ID < b[j].ID
+}
+
+// GetName -- ReportConsumer#GetName
+func (c *consumer) GetName() string {
+	return Name
+}
+
+// Consume -- ReportConsumer#Consume
+func (c *consumer) Consume(reqs []*sc.ReportRequest) error {
+	for _, rr := range reqs {
+		c.tracker.record(rr)
+	}
+	return nil
+}
+
+// GetPrefixAndHandler -- ReportConsumer#GetPrefixAndHandler
+// bans are lifted through Handler on the admin address, not the public port
+func (c *consumer) GetPrefixAndHandler() *mixologist.PrefixAndHandler {
+	return nil
+}
+
+// BuildConsumer -- ReportConsumerBuilder#BuildConsumer
+func (b *consumerBuilder) BuildConsumer(c mixologist.Config, cfg interface{}) (mixologist.ReportConsumer, error) {
+	return &consumer{tracker: signals}, nil
+}
+
+// ConfigStruct -- return pointer to ConsumerConfig struct
+func (b *consumerBuilder) ConfigStruct() interface{} {
+	return &ConsumerConfig{}
+}
+
+// ValidateConfig -- nothing to validate
+func (b *consumerBuilder) ValidateConfig(cfg interface{}) error {
+	return nil
+}
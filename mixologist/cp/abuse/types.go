@@ -0,0 +1,127 @@
+package abuse
+
+import (
+	sc "google/api/servicecontrol/v1"
+	"sync"
+	"time"
+)
+
+const (
+	// Name -- name of this provider. Requests are counted per consumer and caller ip
+	// by the report consumer of this name, bans are issued by the checker.
+	Name = "abuse"
+	// Prefix -- admin endpoint listing (GET) and lifting (DELETE) active bans
+	Prefix = "/abuse/bans"
+	// ClientIPKey -- key used by service control to pass thru client ip
+	ClientIPKey = "servicecontrol.googleapis.com/caller_ip"
+
+	// KeyConsumerID -- ban by Operation.ConsumerId
+	KeyConsumerID = "consumer_id"
+	// KeyCallerIP -- ban by caller ip
+	KeyCallerIP = "caller_ip"
+
+	// MaxWindowSec -- longest window counts are kept for
+	MaxWindowSec = 600
+	// BucketSec -- granularity of the rolling counts
+	BucketSec = 10
+
+	// DefaultWindowSec -- window of the rolling counts
+	DefaultWindowSec = 60
+	// DefaultMinRequests -- error rates of windows with fewer requests are ignored
+	DefaultMinRequests = 100
+	// DefaultBanSec -- cool-down of a ban
+	DefaultBanSec = 300
+	// AbuserDetectedErrorMsg -- error msg while rejecting
+	AbuserDetectedErrorMsg = "Abusive traffic detected, temporarily banned"
+)
+
+type (
+	builder struct{}
+
+	checker struct {
+		cfg     *Config
+		tracker *tracker
+	}
+
+	consumerBuilder struct{}
+
+	// consumer -- feeds reports to the tracker
+	consumer struct {
+		tracker *tracker
+	}
+
+	// banHandler -- lists and lifts active bans
+	banHandler struct {
+		tracker *tracker
+	}
+
+	// ConsumerConfig -- the report consumer has no params
+	ConsumerConfig struct{}
+
+	// Config -- struct needed to configure this checker
+	// At least one of MaxRequests or MaxErrorRate must be set
+	Config struct {
+		// WindowSec -- window of the rolling counts, at most MaxWindowSec
+		WindowSec int `yaml:"windowsec"`
+		// MinRequests -- error rates of windows with fewer requests are ignored
+		MinRequests int64 `yaml:"minrequests"`
+		// MaxRequests -- ban when a consumer or ip sends more requests in the window, 0 disables
+		MaxRequests int64 `yaml:"maxrequests"`
+		// MaxErrorRate -- ban when the fraction of 4xx and 5xx responses exceeds this, 0 disables
+		MaxErrorRate float64 `yaml:"maxerrorrate"`
+		// BanSec -- cool-down of a ban
+		BanSec int `yaml:"bansec"`
+		// KeyBy -- consumer_id and/or caller_ip, defaults to both
+		KeyBy []string `yaml:"keyby"`
+		// Exempt -- consumer ids or ips that are never banned, a trailing * matches a prefix
+		Exempt []string `yaml:"exempt"`
+	}
+
+	// subject -- a consumer id or caller ip of a service
+	subject struct {
+		service string
+		keyBy   string
+		id      string
+	}
+
+	// bucket -- counts of BucketSec seconds
+	bucket struct {
+		start    int64
+		requests int64
+		errors   int64
+	}
+
+	// counts -- rolling counts of a subject
+	counts struct {
+		buckets [MaxWindowSec / BucketSec]bucket
+		last    int64
+	}
+
+	// Ban -- an active ban as listed by the http endpoint
+	Ban struct {
+		Service string    `json:"service"`
+		KeyBy   string    `json:"key_by"`
+		ID      string    `json:"id"`
+		Expires time.Time `json:"expires"`
+	}
+
+	// tracker -- rolling per subject counts derived from reports, and active bans
+	tracker struct {
+		lock   sync.Mutex
+		counts map[subject]*counts
+		bans   map[subject]time.Time
+		swept  int64
+		now    func() time.Time
+	}
+)
+
+var (
+	// signals -- counts and bans of the process, a ban issued through one binding applies to all
+	signals = newTracker()
+
+	// AbuserDetectedCheckError -- predefined val for returning an error
+	AbuserDetectedCheckError = &sc.CheckError{
+		Code:   sc.CheckError_ABUSER_DETECTED,
+		Detail: AbuserDetectedErrorMsg,
+	}
+)
@@ -0,0 +1,161 @@
+package activation
+
+import (
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"strings"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+)
+
+// registry -- typed atomic accessor for the registry, nil until the first fetch
+func (c *checker) registry() *registry {
+	reg, _ := c.atomicRegistry.Load().(*registry)
+	return reg
+}
+
+// setRegistry -- typed atomic setter for the registry
+func (c *checker) setRegistry(reg *registry) {
+	c.atomicRegistry.Store(reg)
+}
+
+// identified -- consumer ids that identify a project
+func identified(consumerID string) bool {
+	for _, prefix := range []string{ProjectPrefix, ProjectNumberPrefix, APIKeyPrefix} {
+		if strings.HasPrefix(consumerID, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProject -- check state, activation and billing of the consumer project
+func (reg *registry) checkProject(consumerID string, service string) *sc.CheckError {
+	p, found := reg.consumers[consumerID]
+	switch {
+	case !found:
+		return checkError(sc.CheckError_PROJECT_INVALID, ProjectInvalidErrorMsg, consumerID)
+	case p.state == StateDeleted:
+		return checkError(sc.CheckError_PROJECT_DELETED, ProjectDeletedErrorMsg, p.id)
+	case p.state != StateActive:
+		return checkError(sc.CheckError_PROJECT_INVALID, ProjectInvalidErrorMsg, p.id)
+	case !p.services[service]:
+		return checkError(sc.CheckError_SERVICE_NOT_ACTIVATED, ServiceNotActivatedErrorMsg, p.id)
+	case !p.billing:
+		return checkError(sc.CheckError_BILLING_DISABLED, BillingDisabledErrorMsg, p.id)
+	}
+	return nil
+}
+
+// Check -- Check if the consumer project is active and has the service enabled
+// Consumers that do not identify a project are not checked
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	op := cr.GetOperation()
+	if op == nil || !identified(op.ConsumerId) {
+		return nil, nil
+	}
+	reg := c.registry()
+	if reg == nil {
+		return nil, ErrRegistryNotLoaded
+	}
+	ce := reg.checkProject(op.ConsumerId, cr.ServiceName)
+	if ce != nil {
+		glog.V(1).Infof("%s rejected for %s: %s", op.ConsumerId, cr.ServiceName, ce.Detail)
+	}
+	return ce, nil
+}
+
+// load -- install the registry of a fetched CfgList
+func (c *checker) load(buf []byte) error {
+	pcfg := CfgList{}
+	if err := yaml.Unmarshal(buf, &pcfg); err != nil {
+		return err
+	}
+	c.setRegistry(buildRegistry(pcfg.Projects...))
+	return nil
+}
+
+// buildRegistry -- index projects by every consumer id that identifies them
+func buildRegistry(projects ...Project) *registry {
+	reg := &registry{
+		consumers: make(map[string]*project),
+	}
+	for _, pc := range projects {
+		if pc.ID == "" {
+			glog.Warningf("Skipping project without id %+v", pc)
+			continue
+		}
+		p := &project{
+			id:       pc.ID,
+			state:    pc.State,
+			billing:  pc.Billing == nil || *pc.Billing,
+			services: make(map[string]bool, len(pc.Services)),
+		}
+		switch p.state {
+		case "":
+			p.state = StateActive
+		case StateActive, StateDeleted, StateInvalid:
+		default:
+			glog.Warningf("Unknown state %s for project %s, treating as %s", pc.State, pc.ID, StateInvalid)
+			p.state = StateInvalid
+		}
+		for _, s := range pc.Services {
+			p.services[s] = true
+		}
+		reg.consumers[ProjectPrefix+pc.ID] = p
+		if pc.Number != "" {
+			reg.consumers[ProjectNumberPrefix+pc.Number] = p
+		}
+		for _, k := range pc.APIKeys {
+			reg.consumers[APIKeyPrefix+k] = p
+		}
+	}
+	glog.V(1).Infof("Loaded %d projects", len(projects))
+	return reg
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+func (c *checker) Unload() {
+	c.poller.Stop()
+}
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	acfg := cfg.(*Config)
+	chk := &checker{}
+	var err error
+	chk.poller, err = mixologist.NewPoller(acfg.ProviderURL, acfg.Kubeconfig,
+		time.Duration(acfg.RefreshIntervalSec)*time.Second, chk.load)
+	if err != nil {
+		return nil, err
+	}
+	chk.poller.Start()
+	return chk, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		RefreshIntervalSec: DefaultRefreshIntervalSec,
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	acfg := cfg.(*Config)
+	if acfg.RefreshIntervalSec <= 0 {
+		return errors.New("RefreshIntervalSec must be positive")
+	}
+	return mixologist.ValidateSourceURL(acfg.ProviderURL)
+}
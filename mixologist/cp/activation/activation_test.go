@@ -0,0 +1,133 @@
+package activation
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+)
+
+const registryYAML = `
+projects:
+- id: mixologist-142215
+  number: "1470410002014"
+  services: [bookstore, library]
+  apikeys: [aaaa]
+- id: no-billing
+  billing: false
+  services: [bookstore]
+- id: gone
+  state: deleted
+  services: [bookstore]
+- id: suspended
+  state: suspended
+  services: [bookstore]
+- id: broken
+  state: invalid
+`
+
+func checkRequest(consumerID string, service string) *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: service,
+		Operation: &sc.Operation{
+			ConsumerId: consumerID,
+		},
+	}
+}
+
+func TestActivation(t *testing.T) {
+	g.RegisterTestingT(t)
+	f, err := ioutil.TempFile("", "projects")
+	g.Expect(err).To(g.BeNil())
+	defer os.Remove(f.Name())
+	f.WriteString(registryYAML)
+	f.Close()
+
+	b := new(builder)
+	cfg := b.ConfigStruct().(*Config)
+	cfg.ProviderURL = f.Name()
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	defer c.Unload()
+	g.Eventually(func() *registry { return c.(*checker).registry() }).ShouldNot(g.BeNil())
+
+	for _, tc := range []struct {
+		consumer string
+		service  string
+		code     sc.CheckError_Code
+	}{
+		{"project:mixologist-142215", "bookstore", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+		{"project_number:1470410002014", "library", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+		{"api_key:aaaa", "bookstore", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+		{"project:mixologist-142215", "shop", sc.CheckError_SERVICE_NOT_ACTIVATED},
+		{"api_key:aaaa", "shop", sc.CheckError_SERVICE_NOT_ACTIVATED},
+		{"project:no-billing", "bookstore", sc.CheckError_BILLING_DISABLED},
+		{"project:no-billing", "shop", sc.CheckError_SERVICE_NOT_ACTIVATED},
+		{"project:gone", "bookstore", sc.CheckError_PROJECT_DELETED},
+		{"project:suspended", "bookstore", sc.CheckError_PROJECT_INVALID},
+		{"project:broken", "bookstore", sc.CheckError_PROJECT_INVALID},
+		{"project:unknown", "bookstore", sc.CheckError_PROJECT_INVALID},
+		{"api_key:zzzz", "bookstore", sc.CheckError_PROJECT_INVALID},
+		// not a project consumer
+		{"user:someone@example.com", "bookstore", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+		{"", "bookstore", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+	} {
+		ce, err := c.Check(context.Background(), checkRequest(tc.consumer, tc.service))
+		g.Expect(err).To(g.BeNil())
+		if tc.code == sc.CheckError_ERROR_CODE_UNSPECIFIED {
+			g.Expect(ce).To(g.BeNil(), tc.consumer+" "+tc.service)
+		} else {
+			g.Expect(ce).NotTo(g.BeNil(), tc.consumer+" "+tc.service)
+			g.Expect(ce.Code).To(g.Equal(tc.code), tc.consumer+" "+tc.service)
+		}
+	}
+}
+
+func TestRegistryUpdate(t *testing.T) {
+	g.RegisterTestingT(t)
+	f, err := ioutil.TempFile("", "projects")
+	g.Expect(err).To(g.BeNil())
+	defer os.Remove(f.Name())
+	g.Expect(ioutil.WriteFile(f.Name(), []byte(registryYAML), 0644)).To(g.Succeed())
+
+	chk := &checker{}
+	chk.poller, err = mixologist.NewPoller("file://"+f.Name(), "", time.Minute, chk.load)
+	g.Expect(err).To(g.BeNil())
+
+	g.Expect(chk.poller.Poll()).To(g.Succeed())
+	ce, _ := chk.Check(context.Background(), checkRequest("project:no-billing", "bookstore"))
+	g.Expect(ce.Code).To(g.Equal(sc.CheckError_BILLING_DISABLED))
+
+	// billing enabled
+	g.Expect(ioutil.WriteFile(f.Name(), []byte("projects:\n- id: no-billing\n  services: [bookstore]\n"), 0644)).To(g.Succeed())
+	g.Expect(chk.poller.Poll()).To(g.Succeed())
+	ce, _ = chk.Check(context.Background(), checkRequest("project:no-billing", "bookstore"))
+	g.Expect(ce).To(g.BeNil())
+
+	// a bad document keeps the last registry
+	g.Expect(ioutil.WriteFile(f.Name(), []byte("projects: {"), 0644)).To(g.Succeed())
+	g.Expect(chk.poller.Poll()).NotTo(g.Succeed())
+	ce, _ = chk.Check(context.Background(), checkRequest("project:no-billing", "bookstore"))
+	g.Expect(ce).To(g.BeNil())
+}
+
+func TestRegistryNotLoaded(t *testing.T) {
+	g.RegisterTestingT(t)
+	ce, err := (&checker{}).Check(context.Background(), checkRequest("project:mixologist-142215", "bookstore"))
+	g.Expect(err).To(g.Equal(ErrRegistryNotLoaded))
+	g.Expect(ce).To(g.BeNil())
+}
+
+func TestValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	g.Expect(b.ValidateConfig(&Config{ProviderURL: "configmap://mixologist/projects", RefreshIntervalSec: 5})).To(g.Succeed())
+	g.Expect(b.ValidateConfig(&Config{ProviderURL: "", RefreshIntervalSec: 5})).NotTo(g.Succeed())
+	g.Expect(b.ValidateConfig(&Config{ProviderURL: "https://example.com/projects"})).NotTo(g.Succeed())
+}
@@ -0,0 +1,100 @@
+package activation
+
+import (
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"sync/atomic"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+)
+
+const (
+	// Name -- name of this provider.
+	Name = "activation"
+	// DefaultRefreshIntervalSec -- interval between fetches of the ProviderURL
+	DefaultRefreshIntervalSec = 5
+
+	// Consumer id prefixes identifying a project
+	ProjectPrefix       = "project:"
+	ProjectNumberPrefix = "project_number:"
+	APIKeyPrefix        = "api_key:"
+
+	// StateActive -- project may be used
+	StateActive = "active"
+	// StateDeleted -- project was deleted
+	StateDeleted = "deleted"
+	// StateInvalid -- project is not usable
+	StateInvalid = "invalid"
+
+	// ProjectInvalidErrorMsg -- error msg while rejecting an unknown or invalid project
+	ProjectInvalidErrorMsg = "Project invalid: "
+	// ProjectDeletedErrorMsg -- error msg while rejecting a deleted project
+	ProjectDeletedErrorMsg = "Project deleted: "
+	// ServiceNotActivatedErrorMsg -- error msg while rejecting a project without the service
+	ServiceNotActivatedErrorMsg = "Service not activated for project: "
+	// BillingDisabledErrorMsg -- error msg while rejecting a project with billing disabled
+	BillingDisabledErrorMsg = "Billing disabled for project: "
+)
+
+type (
+	builder struct{}
+
+	checker struct {
+		poller *mixologist.Poller
+		// atomicRegistry holds value of type *registry
+		atomicRegistry atomic.Value
+	}
+
+	// Config -- struct needed to configure this checker
+	Config struct {
+		// ProviderURL -- http(s) url, file or configmap://namespace/name of a CfgList
+		ProviderURL string `yaml:"providerurl" required:"true"`
+		// RefreshIntervalSec -- interval between fetches of ProviderURL
+		RefreshIntervalSec int `yaml:"refreshintervalsec"`
+		// Kubeconfig -- used for configmap urls, defaults to the in cluster config
+		Kubeconfig string `yaml:"kubeconfig"`
+	}
+
+	// CfgList -- file format of the project registry
+	CfgList struct {
+		Projects []Project `yaml:"projects"`
+	}
+
+	// Project -- a consumer project
+	Project struct {
+		ID     string `yaml:"id" required:"true"`
+		Number string `yaml:"number"`
+		// State -- active, deleted or invalid. Defaults to active
+		State string `yaml:"state"`
+		// Billing -- billing is enabled unless set to false
+		Billing *bool `yaml:"billing"`
+		// Services -- names of the services enabled for the project
+		Services []string `yaml:"services"`
+		// APIKeys -- keys owned by the project
+		APIKeys []string `yaml:"apikeys"`
+	}
+
+	// registry -- project lookup by consumer id
+	registry struct {
+		consumers map[string]*project
+	}
+
+	project struct {
+		id       string
+		state    string
+		billing  bool
+		services map[string]bool
+	}
+)
+
+var (
+	// ErrRegistryNotLoaded -- Projects have not been fetched from the provider yet
+	ErrRegistryNotLoaded = errors.New("project registry not loaded")
+)
+
+func checkError(code sc.CheckError_Code, msg string, id string) *sc.CheckError {
+	return &sc.CheckError{
+		Code:   code,
+		Detail: msg + id,
+	}
+}
@@ -0,0 +1,166 @@
+package apikey
+
+import (
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"strings"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+)
+
+// keys -- typed atomic accessor for keys, nil until the first fetch
+func (c *checker) keys() map[string]*apiKey {
+	keys, _ := c.atomicKeys.Load().(map[string]*apiKey)
+	return keys
+}
+
+// setKeys -- typed atomic setter for keys
+func (c *checker) setKeys(keys map[string]*apiKey) {
+	c.atomicKeys.Store(keys)
+}
+
+func invalid(msg string, arg string) *sc.CheckError {
+	return &sc.CheckError{
+		Code:   sc.CheckError_API_KEY_INVALID,
+		Detail: msg + arg,
+	}
+}
+
+// checkKey -- validate key against the current list
+func (c *checker) checkKey(key string, service string, method string) (*sc.CheckError, error) {
+	keys := c.keys()
+	if keys == nil {
+		return nil, ErrKeysNotLoaded
+	}
+	k, found := keys[key]
+	if !found {
+		return KeyNotFoundCheckError, nil
+	}
+	switch {
+	case k.state == StateRevoked:
+		return KeyRevokedCheckError, nil
+	case k.state == StateExpired:
+		return KeyExpiredCheckError, nil
+	case !k.expires.IsZero() && c.now().After(k.expires):
+		return KeyExpiredCheckError, nil
+	case k.services != nil && !k.services[service]:
+		return invalid(ServiceNotAllowedErrorMsg, service), nil
+	case k.methods != nil && !k.methods[method]:
+		return invalid(MethodNotAllowedErrorMsg, method), nil
+	}
+	return nil, nil
+}
+
+// Check -- Check if the api key of the consumer is valid
+// Consumers that are not identified by an api key are not checked
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	op := cr.GetOperation()
+	if op == nil || !strings.HasPrefix(op.ConsumerId, ConsumerPrefix) {
+		return nil, nil
+	}
+	key := strings.TrimPrefix(op.ConsumerId, ConsumerPrefix)
+	ce, err := c.checkKey(key, cr.ServiceName, op.OperationName)
+	if ce != nil {
+		glog.V(1).Infof("%s rejected for %s/%s: %s", op.ConsumerId, cr.ServiceName, op.OperationName, ce.Detail)
+	}
+	return ce, err
+}
+
+// load -- install the keys of a fetched CfgList
+func (c *checker) load(buf []byte) error {
+	kcfg := CfgList{}
+	if err := yaml.Unmarshal(buf, &kcfg); err != nil {
+		return err
+	}
+	c.setKeys(buildKeys(kcfg.Keys...))
+	return nil
+}
+
+func set(vals []string) map[string]bool {
+	if len(vals) == 0 {
+		return nil
+	}
+	m := make(map[string]bool, len(vals))
+	for _, v := range vals {
+		m[v] = true
+	}
+	return m
+}
+
+// buildKeys -- convert key configs to a lookup map
+func buildKeys(keys ...KeyCfg) map[string]*apiKey {
+	km := make(map[string]*apiKey, len(keys))
+	for _, kc := range keys {
+		k := &apiKey{
+			state:    kc.State,
+			services: set(kc.Services),
+			methods:  set(kc.Methods),
+		}
+		switch k.state {
+		case "":
+			k.state = StateValid
+		case StateValid, StateExpired, StateRevoked:
+		default:
+			glog.Warningf("Unknown state %s for key %s, treating as %s", kc.State, kc.Key, StateRevoked)
+			k.state = StateRevoked
+		}
+		if kc.Expires != "" {
+			var err error
+			if k.expires, err = time.Parse(time.RFC3339, kc.Expires); err != nil {
+				glog.Warningf("Unable to parse expiry of key %s, treating as %s -- %v", kc.Key, StateExpired, err)
+				k.state = StateExpired
+			}
+		}
+		km[kc.Key] = k
+	}
+	glog.V(1).Infof("Loaded %d api keys", len(km))
+	return km
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+func (c *checker) Unload() {
+	c.poller.Stop()
+}
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	kcfg := cfg.(*Config)
+	chk := &checker{
+		now: time.Now,
+	}
+	var err error
+	chk.poller, err = mixologist.NewPoller(kcfg.ProviderURL, kcfg.Kubeconfig,
+		time.Duration(kcfg.RefreshIntervalSec)*time.Second, chk.load)
+	if err != nil {
+		return nil, err
+	}
+	chk.poller.Start()
+	return chk, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		RefreshIntervalSec: DefaultRefreshIntervalSec,
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	kcfg := cfg.(*Config)
+	if kcfg.RefreshIntervalSec <= 0 {
+		return errors.New("RefreshIntervalSec must be positive")
+	}
+	return mixologist.ValidateSourceURL(kcfg.ProviderURL)
+}
@@ -0,0 +1,162 @@
+package apikey
+
+import (
+	"github.com/cloudendpoints/mixologist/mixologist"
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+var testKeys = []KeyCfg{
+	{Key: "aaaa"},
+	{Key: "bbbb", State: StateExpired},
+	{Key: "cccc", State: StateRevoked},
+	{Key: "dddd", Expires: "2016-10-01T00:00:00Z"},
+	{Key: "eeee", Services: []string{"service1"}, Methods: []string{"ListShelves", "GetShelf"}},
+	{Key: "ffff", State: "suspended"},
+	{Key: "gggg", Expires: "tomorrow"},
+}
+
+func checkRequest(consumerID string, service string, method string) *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: service,
+		Operation: &sc.Operation{
+			ConsumerId:    consumerID,
+			OperationName: method,
+		},
+	}
+}
+
+func buildChecker(keys ...KeyCfg) *checker {
+	chk := &checker{
+		now: func() time.Time { return time.Date(2016, 10, 2, 0, 0, 0, 0, time.UTC) },
+	}
+	chk.setKeys(buildKeys(keys...))
+	return chk
+}
+
+func TestAPIKey(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(testKeys...)
+	for _, tc := range []struct {
+		consumer string
+		service  string
+		method   string
+		code     sc.CheckError_Code
+	}{
+		{"api_key:aaaa", "service1", "ListShelves", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+		{"api_key:zzzz", "service1", "ListShelves", sc.CheckError_API_KEY_NOT_FOUND},
+		{"api_key:", "service1", "ListShelves", sc.CheckError_API_KEY_NOT_FOUND},
+		{"api_key:bbbb", "service1", "ListShelves", sc.CheckError_API_KEY_EXPIRED},
+		{"api_key:cccc", "service1", "ListShelves", sc.CheckError_API_KEY_INVALID},
+		{"api_key:dddd", "service1", "ListShelves", sc.CheckError_API_KEY_EXPIRED},
+		{"api_key:eeee", "service1", "ListShelves", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+		{"api_key:eeee", "service2", "ListShelves", sc.CheckError_API_KEY_INVALID},
+		{"api_key:eeee", "service1", "DeleteShelf", sc.CheckError_API_KEY_INVALID},
+		{"api_key:ffff", "service1", "ListShelves", sc.CheckError_API_KEY_INVALID},
+		{"api_key:gggg", "service1", "ListShelves", sc.CheckError_API_KEY_EXPIRED},
+		// not an api key consumer
+		{"project:mixologist-142215", "service1", "ListShelves", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+		{"", "service1", "ListShelves", sc.CheckError_ERROR_CODE_UNSPECIFIED},
+	} {
+		ce, err := chk.Check(context.Background(), checkRequest(tc.consumer, tc.service, tc.method))
+		g.Expect(err).To(g.BeNil())
+		if tc.code == sc.CheckError_ERROR_CODE_UNSPECIFIED {
+			g.Expect(ce).To(g.BeNil(), tc.consumer+" should succeed")
+		} else {
+			g.Expect(ce).NotTo(g.BeNil(), tc.consumer+" should fail")
+			g.Expect(ce.Code).To(g.Equal(tc.code), tc.consumer)
+		}
+	}
+}
+
+func TestAPIKeyNotLoaded(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := &checker{}
+	ce, err := chk.Check(context.Background(), checkRequest("api_key:aaaa", "service1", "ListShelves"))
+	g.Expect(err).To(g.Equal(ErrKeysNotLoaded))
+	g.Expect(ce).To(g.BeNil())
+}
+
+func TestAPIKeyFetch(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := CfgList{Keys: []KeyCfg{{Key: "aaaa"}}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out, err := yaml.Marshal(cfg)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(out)
+	}))
+	defer ts.Close()
+
+	chk := &checker{now: time.Now}
+	var err error
+	chk.poller, err = mixologist.NewPoller(ts.URL, "", time.Minute, chk.load)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(chk.poller.Poll()).To(g.Succeed())
+	ce, _ := chk.checkKey("aaaa", "service1", "ListShelves")
+	g.Expect(ce).To(g.BeNil())
+
+	// revoke the key on the server
+	cfg.Keys[0].State = StateRevoked
+	g.Expect(chk.poller.Poll()).To(g.Succeed())
+	ce, _ = chk.checkKey("aaaa", "service1", "ListShelves")
+	g.Expect(ce).To(g.Equal(KeyRevokedCheckError))
+
+	// a failed fetch keeps the last list
+	ts.Close()
+	g.Expect(chk.poller.Poll()).NotTo(g.Succeed())
+	ce, _ = chk.checkKey("aaaa", "service1", "ListShelves")
+	g.Expect(ce).To(g.Equal(KeyRevokedCheckError))
+}
+
+func TestAPIKeyFile(t *testing.T) {
+	g.RegisterTestingT(t)
+	f, err := ioutil.TempFile("", "apikeys")
+	g.Expect(err).To(g.BeNil())
+	defer os.Remove(f.Name())
+	f.WriteString("keys:\n- key: aaaa\n  services: [service1]\n")
+	f.Close()
+
+	b := new(builder)
+	cfg := b.ConfigStruct().(*Config)
+	cfg.ProviderURL = "file://" + f.Name()
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	defer c.Unload()
+	g.Eventually(func() error {
+		_, err := c.Check(context.Background(), checkRequest("api_key:aaaa", "service1", "ListShelves"))
+		return err
+	}).Should(g.Succeed())
+	ce, _ := c.Check(context.Background(), checkRequest("api_key:aaaa", "service2", "ListShelves"))
+	g.Expect(ce.Code).To(g.Equal(sc.CheckError_API_KEY_INVALID))
+}
+
+func TestAPIKeyValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	withURL := func(u string) *Config {
+		cfg := b.ConfigStruct().(*Config)
+		cfg.ProviderURL = u
+		return cfg
+	}
+	g.Expect(b.ValidateConfig(withURL("https://example.com/keys"))).To(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("file:///etc/mixologist/keys.yml"))).To(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("configmap://default/apikeys"))).To(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL(""))).NotTo(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("https://"))).NotTo(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("file://"))).NotTo(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("configmap://default"))).NotTo(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("ftp://example.com/keys"))).NotTo(g.Succeed())
+	g.Expect(b.ValidateConfig(&Config{ProviderURL: "https://example.com/keys"})).NotTo(g.Succeed(), "RefreshIntervalSec is required")
+}
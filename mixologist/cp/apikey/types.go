@@ -0,0 +1,104 @@
+package apikey
+
+import (
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+)
+
+const (
+	// Name -- name of this provider.
+	Name = "apikey"
+	// ConsumerPrefix -- consumer_id prefix of api key consumers
+	ConsumerPrefix = "api_key:"
+
+	// StateValid -- key may be used
+	StateValid = "valid"
+	// StateExpired -- key has expired
+	StateExpired = "expired"
+	// StateRevoked -- key was revoked
+	StateRevoked = "revoked"
+
+	// KeyNotFoundErrorMsg -- error msg while rejecting an unknown key
+	KeyNotFoundErrorMsg = "API key not found"
+	// KeyExpiredErrorMsg -- error msg while rejecting an expired key
+	KeyExpiredErrorMsg = "API key expired"
+	// KeyRevokedErrorMsg -- error msg while rejecting a revoked key
+	KeyRevokedErrorMsg = "API key revoked"
+	// ServiceNotAllowedErrorMsg -- error msg while rejecting a key not valid for the service
+	ServiceNotAllowedErrorMsg = "API key not valid for service "
+	// MethodNotAllowedErrorMsg -- error msg while rejecting a key not valid for the method
+	MethodNotAllowedErrorMsg = "API key not valid for method "
+	// DefaultRefreshIntervalSec -- interval between fetches of the ProviderURL
+	DefaultRefreshIntervalSec = 5
+)
+
+type (
+	builder struct {
+	}
+
+	checker struct {
+		poller *mixologist.Poller
+		// atomicKeys holds value of type map[string]*apiKey
+		atomicKeys atomic.Value
+		now        func() time.Time
+	}
+
+	// Config -- struct needed to configure this checker
+	Config struct {
+		// ProviderURL -- http(s) url, file or configmap://namespace/name of the key list
+		ProviderURL string `yaml:"providerurl" required:"true"`
+		// RefreshIntervalSec -- interval between fetches of ProviderURL
+		RefreshIntervalSec int `yaml:"refreshintervalsec"`
+		// Kubeconfig -- used for configmap urls, defaults to the in cluster config
+		Kubeconfig string `yaml:"kubeconfig"`
+	}
+
+	// CfgList -- file format of the external file listing api keys
+	CfgList struct {
+		Keys []KeyCfg `yaml:"keys" required:"true"`
+	}
+
+	// KeyCfg -- a single api key
+	KeyCfg struct {
+		Key string `yaml:"key" required:"true"`
+		// State -- valid, expired or revoked. Defaults to valid
+		State string `yaml:"state"`
+		// Expires -- RFC3339 time after which the key is expired
+		Expires string `yaml:"expires"`
+		// Services -- if specified the key is only valid for these services
+		Services []string `yaml:"services"`
+		// Methods -- if specified the key is only valid for these api methods
+		Methods []string `yaml:"methods"`
+	}
+
+	apiKey struct {
+		state    string
+		expires  time.Time
+		services map[string]bool
+		methods  map[string]bool
+	}
+)
+
+var (
+	// KeyNotFoundCheckError -- predefined val for returning an error
+	KeyNotFoundCheckError = &sc.CheckError{
+		Code:   sc.CheckError_API_KEY_NOT_FOUND,
+		Detail: KeyNotFoundErrorMsg,
+	}
+	// KeyExpiredCheckError -- predefined val for returning an error
+	KeyExpiredCheckError = &sc.CheckError{
+		Code:   sc.CheckError_API_KEY_EXPIRED,
+		Detail: KeyExpiredErrorMsg,
+	}
+	// KeyRevokedCheckError -- predefined val for returning an error
+	KeyRevokedCheckError = &sc.CheckError{
+		Code:   sc.CheckError_API_KEY_INVALID,
+		Detail: KeyRevokedErrorMsg,
+	}
+	// ErrKeysNotLoaded -- Keys have not been fetched from the provider yet
+	ErrKeysNotLoaded = errors.New("api keys not loaded")
+)
@@ -1,14 +1,21 @@
 package block
 
 import (
+	"fmt"
 	sc "google/api/servicecontrol/v1"
 
 	"github.com/cloudendpoints/mixologist/mixologist"
+	"golang.org/x/net/context"
 )
 
 const (
 	Name           = "block"
 	DefaultMessage = "Access explicitly blocked"
+
+	// ModeAllow -- checkers with a mode block requests unless their condition holds
+	ModeAllow = "allow"
+	// ModeDeny -- checkers with a mode block requests when their condition holds
+	ModeDeny = "deny"
 )
 
 type (
@@ -21,13 +28,39 @@ type (
 	}
 )
 
-func checkError(message string) *sc.CheckError {
+// NewCheckError -- CheckError for checkers that block access with a configurable message
+func NewCheckError(code sc.CheckError_Code, message string) *sc.CheckError {
 	return &sc.CheckError{
-		Code:   sc.CheckError_CLIENT_APP_BLOCKED,
+		Code:   code,
 		Detail: message,
 	}
 }
 
+// ParseCode -- the CheckError_Code named name, ERROR_CODE_UNSPECIFIED is not a valid code
+func ParseCode(name string) (sc.CheckError_Code, error) {
+	code, found := sc.CheckError_Code_value[name]
+	if !found || code == int32(sc.CheckError_ERROR_CODE_UNSPECIFIED) {
+		return sc.CheckError_ERROR_CODE_UNSPECIFIED, fmt.Errorf("unknown code %q", name)
+	}
+	return sc.CheckError_Code(code), nil
+}
+
+// ParseMode -- true if mode is ModeDeny, an empty mode is defaultMode
+func ParseMode(mode string, defaultMode string) (bool, error) {
+	if mode == "" {
+		mode = defaultMode
+	}
+	switch mode {
+	case ModeAllow, ModeDeny:
+		return mode == ModeDeny, nil
+	}
+	return false, fmt.Errorf("unknown mode %q, expected %s or %s", mode, ModeAllow, ModeDeny)
+}
+
+func checkError(message string) *sc.CheckError {
+	return NewCheckError(sc.CheckError_CLIENT_APP_BLOCKED, message)
+}
+
 func init() {
 	mixologist.RegisterChecker(Name, new(builder))
 }
@@ -38,7 +71,7 @@ func (c *checker) Name() string {
 
 func (c *checker) Unload() {}
 
-func (c *checker) Check(cr *sc.CheckRequest) (*sc.CheckError, error) {
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
 	return checkError(c.cfg.Message), nil
 }
 
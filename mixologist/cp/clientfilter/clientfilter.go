@@ -0,0 +1,185 @@
+package clientfilter
+
+import (
+	"errors"
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+)
+
+// rules -- typed atomic accessor for rules, nil until the first fetch
+func (c *checker) rules() []*rule {
+	rules, _ := c.atomicRules.Load().([]*rule)
+	return rules
+}
+
+// setRules -- typed atomic setter for rules
+func (c *checker) setRules(rules []*rule) {
+	c.atomicRules.Store(rules)
+}
+
+func matchAny(res []*regexp.Regexp, val string) bool {
+	for _, re := range res {
+		if re.MatchString(val) {
+			return true
+		}
+	}
+	return false
+}
+
+// check -- return a CheckError if labels are blocked by the rule
+func (r *rule) check(labels map[string]string) *sc.CheckError {
+	val, found := labels[r.label]
+	blocked := found && matchAny(r.deny, val)
+	if !blocked && len(r.allow) > 0 {
+		blocked = !found || !matchAny(r.allow, val)
+	}
+	if !blocked {
+		return nil
+	}
+	return &sc.CheckError{
+		Code:   r.code,
+		Detail: r.msg + val,
+	}
+}
+
+// Check -- Check if referer and agents are allowed
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	rules := c.rules()
+	if rules == nil {
+		return nil, ErrRulesNotLoaded
+	}
+	labels := cr.GetOperation().GetLabels()
+	for _, r := range rules {
+		if ce := r.check(labels); ce != nil {
+			glog.V(1).Infof("%s %q blocked", r.label, labels[r.label])
+			return ce, nil
+		}
+	}
+	return nil, nil
+}
+
+// load -- install the filters of a fetched CfgList
+// The filters in use are kept if any pattern is invalid
+func (c *checker) load(buf []byte) error {
+	fcfg := CfgList{}
+	if err := yaml.Unmarshal(buf, &fcfg); err != nil {
+		return err
+	}
+	rules, err := buildRules(&fcfg)
+	if err != nil {
+		return err
+	}
+	c.setRules(rules)
+	return nil
+}
+
+// compile -- convert a glob or regex: pattern to an anchored regular expression
+// In globs * matches any sequence of characters and ? matches a single character
+func compile(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, RegexPrefix) {
+		return regexp.Compile("^(?:" + strings.TrimPrefix(pattern, RegexPrefix) + ")$")
+	}
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\*`, `.*`, -1)
+	re = strings.Replace(re, `\?`, `.`, -1)
+	return regexp.Compile("^" + re + "$")
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s -- %v", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// buildRules -- compile filters of every label, labels without patterns are skipped
+// An invalid pattern rejects all filters, dropping it could allow what it was meant to block
+func buildRules(cfg *CfgList) ([]*rule, error) {
+	rules := []*rule{}
+	for _, r := range []struct {
+		label string
+		code  sc.CheckError_Code
+		msg   string
+		f     Filter
+	}{
+		{RefererKey, sc.CheckError_REFERER_BLOCKED, RefererBlockedErrorMsg, cfg.Referer},
+		{UserAgentKey, sc.CheckError_CLIENT_APP_BLOCKED, ClientAppBlockedErrorMsg, cfg.UserAgent},
+		{ServiceAgentKey, sc.CheckError_CLIENT_APP_BLOCKED, ClientAppBlockedErrorMsg, cfg.ServiceAgent},
+	} {
+		if len(r.f.Allow) == 0 && len(r.f.Deny) == 0 {
+			continue
+		}
+		allow, err := compileAll(r.f.Allow)
+		if err != nil {
+			return nil, err
+		}
+		deny, err := compileAll(r.f.Deny)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule{
+			label: r.label,
+			code:  r.code,
+			msg:   r.msg,
+			allow: allow,
+			deny:  deny,
+		})
+	}
+	glog.V(1).Infof("New client filters %+v", cfg)
+	return rules, nil
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+func (c *checker) Unload() {
+	c.poller.Stop()
+}
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	fcfg := cfg.(*Config)
+	chk := &checker{}
+	var err error
+	chk.poller, err = mixologist.NewPoller(fcfg.ProviderURL, fcfg.Kubeconfig,
+		time.Duration(fcfg.RefreshIntervalSec)*time.Second, chk.load)
+	if err != nil {
+		return nil, err
+	}
+	chk.poller.Start()
+	return chk, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		RefreshIntervalSec: DefaultRefreshIntervalSec,
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	fcfg := cfg.(*Config)
+	if fcfg.RefreshIntervalSec <= 0 {
+		return errors.New("RefreshIntervalSec must be positive")
+	}
+	return mixologist.ValidateSourceURL(fcfg.ProviderURL)
+}
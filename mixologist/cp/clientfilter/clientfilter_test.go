@@ -0,0 +1,165 @@
+package clientfilter
+
+import (
+	"github.com/cloudendpoints/mixologist/mixologist"
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func checkRequest(labels map[string]string) *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: "testservice",
+		Operation: &sc.Operation{
+			Labels: labels,
+		},
+	}
+}
+
+func buildChecker(cfg *CfgList) *checker {
+	rules, err := buildRules(cfg)
+	g.Expect(err).To(g.BeNil())
+	chk := &checker{}
+	chk.setRules(rules)
+	return chk
+}
+
+func testcase(chk *checker, labels map[string]string, code sc.CheckError_Code, msg string) {
+	ce, err := chk.Check(context.Background(), checkRequest(labels))
+	g.Expect(err).To(g.BeNil())
+	if code == sc.CheckError_ERROR_CODE_UNSPECIFIED {
+		g.Expect(ce).To(g.BeNil(), msg)
+		return
+	}
+	g.Expect(ce).NotTo(g.BeNil(), msg)
+	g.Expect(ce.Code).To(g.Equal(code), msg)
+}
+
+func TestCompile(t *testing.T) {
+	g.RegisterTestingT(t)
+	for _, tc := range []struct {
+		pattern string
+		val     string
+		match   bool
+	}{
+		{"*.example.com/*", "https://www.example.com/index.html", true},
+		{"*.example.com/*", "https://example.org/www.example.com", false},
+		{"*.example.com/*", "https://wwwxexample.com/", false},
+		{"https://example.com/?", "https://example.com/a", true},
+		{"https://example.com/?", "https://example.com/ab", false},
+		{"ESP/0.3.*", "ESP/0.3.7", true},
+		{"regex:curl/.*", "curl/7.50.1", true},
+		{"regex:curl/.*", "Mozilla/5.0 curl/7.50.1", false},
+		// regular expressions are anchored like globs
+		{"regex:https://(www\\.)?example\\.com/.*", "https://example.com/index.html", true},
+		{"regex:example\\.com", "evil-example.com.attacker.net", false},
+		{"regex:a|b", "ab", false},
+		{"regex:(?i)ESP/.*", "esp/0.3.7", true},
+	} {
+		re, err := compile(tc.pattern)
+		g.Expect(err).To(g.BeNil())
+		g.Expect(re.MatchString(tc.val)).To(g.Equal(tc.match), tc.pattern+" "+tc.val)
+	}
+	_, err := compile("regex:(")
+	g.Expect(err).NotTo(g.BeNil())
+}
+
+func TestReferer(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(&CfgList{
+		Referer: Filter{
+			Allow: []string{"*.example.com/*", "regex:https://example\\.org/.*"},
+			Deny:  []string{"*.example.com/admin/*"},
+		},
+	})
+	testcase(chk, map[string]string{RefererKey: "https://www.example.com/shelves"}, sc.CheckError_ERROR_CODE_UNSPECIFIED, "allowed by glob")
+	testcase(chk, map[string]string{RefererKey: "https://example.org/shelves"}, sc.CheckError_ERROR_CODE_UNSPECIFIED, "allowed by regex")
+	testcase(chk, map[string]string{RefererKey: "https://www.example.com/admin/users"}, sc.CheckError_REFERER_BLOCKED, "deny wins over allow")
+	testcase(chk, map[string]string{RefererKey: "https://evil.com/"}, sc.CheckError_REFERER_BLOCKED, "not allowed")
+	testcase(chk, map[string]string{}, sc.CheckError_REFERER_BLOCKED, "missing referer with allow list")
+}
+
+func TestAgents(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(&CfgList{
+		UserAgent:    Filter{Deny: []string{"regex:(?i).*bot.*"}},
+		ServiceAgent: Filter{Allow: []string{"ESP/*"}},
+	})
+	labels := func(ua, sa string) map[string]string {
+		return map[string]string{UserAgentKey: ua, ServiceAgentKey: sa}
+	}
+	testcase(chk, labels("ESP", "ESP/0.3.7"), sc.CheckError_ERROR_CODE_UNSPECIFIED, "allowed agents")
+	testcase(chk, labels("GoogleBot/2.1", "ESP/0.3.7"), sc.CheckError_CLIENT_APP_BLOCKED, "denied user agent")
+	testcase(chk, labels("ESP", "nginx/1.10"), sc.CheckError_CLIENT_APP_BLOCKED, "service agent not allowed")
+	// no referer filter, deny only user agent filter
+	testcase(chk, map[string]string{ServiceAgentKey: "ESP/0.3.7"}, sc.CheckError_ERROR_CODE_UNSPECIFIED, "missing user agent")
+}
+
+func TestNotLoaded(t *testing.T) {
+	g.RegisterTestingT(t)
+	ce, err := (&checker{}).Check(context.Background(), checkRequest(nil))
+	g.Expect(err).To(g.Equal(ErrRulesNotLoaded))
+	g.Expect(ce).To(g.BeNil())
+
+	// an empty list allows everything
+	testcase(buildChecker(&CfgList{}), nil, sc.CheckError_ERROR_CODE_UNSPECIFIED, "empty filters")
+}
+
+func TestFetch(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := CfgList{Referer: Filter{Deny: []string{"*evil*"}}}
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out, err := yaml.Marshal(cfg)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(out)
+	}))
+	defer ts.Close()
+
+	chk := &checker{}
+	var err error
+	chk.poller, err = mixologist.NewPoller(ts.URL, "", time.Minute, chk.load)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(chk.poller.Poll()).To(g.Succeed())
+	testcase(chk, map[string]string{RefererKey: "https://evil.com/"}, sc.CheckError_REFERER_BLOCKED, "denied")
+
+	cfg.Referer.Deny = []string{"*wicked*"}
+	g.Expect(chk.poller.Poll()).To(g.Succeed())
+	testcase(chk, map[string]string{RefererKey: "https://evil.com/"}, sc.CheckError_ERROR_CODE_UNSPECIFIED, "list changed")
+
+	// failed fetches and invalid patterns keep the filters in use
+	cfg.Referer.Deny = []string{"*evil*"}
+	status = http.StatusNotFound
+	g.Expect(chk.poller.Poll()).NotTo(g.Succeed())
+	testcase(chk, map[string]string{RefererKey: "https://wicked.com/"}, sc.CheckError_REFERER_BLOCKED, "kept after 404")
+
+	status = http.StatusOK
+	cfg.Referer.Deny = []string{"*evil*", "regex:("}
+	g.Expect(chk.poller.Poll()).NotTo(g.Succeed())
+	testcase(chk, map[string]string{RefererKey: "https://wicked.com/"}, sc.CheckError_REFERER_BLOCKED, "kept after invalid pattern")
+	testcase(chk, map[string]string{RefererKey: "https://evil.com/"}, sc.CheckError_ERROR_CODE_UNSPECIFIED, "partial filters are not installed")
+}
+
+func TestValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	withURL := func(u string) *Config {
+		cfg := b.ConfigStruct().(*Config)
+		cfg.ProviderURL = u
+		return cfg
+	}
+	g.Expect(b.ValidateConfig(withURL("https://example.com/filters"))).To(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("/etc/filters.yml"))).To(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("https:///filters"))).NotTo(g.Succeed())
+	g.Expect(b.ValidateConfig(withURL("ftp://example.com/filters"))).NotTo(g.Succeed())
+	g.Expect(b.ValidateConfig(&Config{ProviderURL: "https://example.com/filters"})).NotTo(g.Succeed(), "RefreshIntervalSec is required")
+}
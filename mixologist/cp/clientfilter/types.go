@@ -0,0 +1,81 @@
+package clientfilter
+
+import (
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+)
+
+const (
+	// Name -- name of this provider.
+	Name = "clientfilter"
+	// RefererKey -- key used by service control to pass thru the http referer
+	RefererKey = "servicecontrol.googleapis.com/referer"
+	// UserAgentKey -- key used by service control to pass thru the user agent
+	UserAgentKey = "servicecontrol.googleapis.com/user_agent"
+	// ServiceAgentKey -- key used by service control to pass thru the service agent
+	ServiceAgentKey = "servicecontrol.googleapis.com/service_agent"
+	// RegexPrefix -- patterns starting with this prefix are regular expressions, others are globs.
+	// Both must match the whole value
+	RegexPrefix = "regex:"
+	// DefaultRefreshIntervalSec -- interval between fetches of the ProviderURL
+	DefaultRefreshIntervalSec = 5
+
+	// RefererBlockedErrorMsg -- error msg while rejecting a referer
+	RefererBlockedErrorMsg = "Referer blocked: "
+	// ClientAppBlockedErrorMsg -- error msg while rejecting a user or service agent
+	ClientAppBlockedErrorMsg = "Client application blocked: "
+)
+
+type (
+	builder struct {
+	}
+
+	checker struct {
+		poller *mixologist.Poller
+		// atomicRules holds value of type []*rule
+		atomicRules atomic.Value
+	}
+
+	// Config -- struct needed to configure this checker
+	Config struct {
+		// ProviderURL -- http(s) url, file or configmap://namespace/name of a CfgList
+		ProviderURL string `yaml:"providerurl" required:"true"`
+		// RefreshIntervalSec -- interval between fetches of ProviderURL
+		RefreshIntervalSec int `yaml:"refreshintervalsec"`
+		// Kubeconfig -- used for configmap urls, defaults to the in cluster config
+		Kubeconfig string `yaml:"kubeconfig"`
+	}
+
+	// CfgList -- file format of the external file denoting the filters
+	CfgList struct {
+		Referer      Filter `yaml:"referer"`
+		UserAgent    Filter `yaml:"useragent"`
+		ServiceAgent Filter `yaml:"serviceagent"`
+	}
+
+	// Filter -- allow and deny patterns of a label
+	// A label matching a deny pattern is blocked.
+	// If allow patterns are given, a label that is missing or matches none of them is blocked.
+	Filter struct {
+		Allow []string `yaml:"allow"`
+		Deny  []string `yaml:"deny"`
+	}
+
+	// rule -- compiled Filter of a label
+	rule struct {
+		label string
+		code  sc.CheckError_Code
+		msg   string
+		allow []*regexp.Regexp
+		deny  []*regexp.Regexp
+	}
+)
+
+var (
+	// ErrRulesNotLoaded -- Filters have not been fetched from the provider yet
+	ErrRulesNotLoaded = errors.New("client filters not loaded")
+)
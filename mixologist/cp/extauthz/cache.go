@@ -0,0 +1,104 @@
+package extauthz
+
+import (
+	"container/list"
+	sc "google/api/servicecontrol/v1"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+)
+
+type (
+	// decisionCache -- LRU cache of decisions that carry a ttl
+	decisionCache struct {
+		maxEntries int
+
+		lock    sync.Mutex
+		entries map[string]*list.Element
+		lru     *list.List
+		now     func() time.Time
+	}
+
+	cacheEntry struct {
+		key     string
+		ce      *sc.CheckError
+		expires time.Time
+	}
+)
+
+func newDecisionCache(maxEntries int) *decisionCache {
+	return &decisionCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// cacheKey -- the request without the fields that differ between repeated operations
+func cacheKey(cr *sc.CheckRequest) (string, error) {
+	key := *cr
+	if cr.Operation != nil {
+		op := *cr.Operation
+		op.OperationId = ""
+		op.StartTime = nil
+		op.EndTime = nil
+		key.Operation = &op
+	}
+	return (&jsonpb.Marshaler{}).MarshalToString(&key)
+}
+
+// Get -- return a cached decision; found is false if absent or expired
+func (c *decisionCache) Get(key string) (ce *sc.CheckError, found bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	el, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	if entry.ce == nil {
+		return nil, true
+	}
+	// callers own the result, the cached one is shared
+	return &sc.CheckError{Code: entry.ce.Code, Detail: entry.ce.Detail}, true
+}
+
+// Set -- cache a decision for ttlSec. A nil CheckError is an allow decision
+func (c *decisionCache) Set(key string, ce *sc.CheckError, ttlSec int) {
+	if ttlSec <= 0 {
+		return
+	}
+	if ce != nil {
+		ce = &sc.CheckError{Code: ce.Code, Detail: ce.Detail}
+	}
+	entry := &cacheEntry{
+		key:     key,
+		ce:      ce,
+		expires: c.now().Add(time.Duration(ttlSec) * time.Second),
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, found := c.entries[key]; found {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove -- caller must hold the lock
+func (c *decisionCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,155 @@
+package extauthz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/cloudendpoints/mixologist/mixologist/cp/block"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+)
+
+func (c *checker) Name() string {
+	return Name
+}
+
+// Unload -- close pooled connections
+func (c *checker) Unload() {
+	c.transport.CloseIdleConnections()
+}
+
+// checkError -- convert a deny Decision
+func (d *Decision) checkError() *sc.CheckError {
+	code := d.Code
+	if code == "" {
+		code = DefaultCode
+	}
+	val, err := block.ParseCode(code)
+	if err != nil {
+		glog.Warningf("%s in decision, using %s", err, DefaultCode)
+		val, _ = block.ParseCode(DefaultCode)
+	}
+	return block.NewCheckError(val, d.Detail)
+}
+
+// Check -- reuse a cached decision or ask the policy service
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	key, err := cacheKey(cr)
+	if err != nil {
+		return nil, err
+	}
+	if ce, found := c.cache.Get(key); found {
+		return ce, nil
+	}
+	d, err := c.decide(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+	var ce *sc.CheckError
+	if !d.Allow {
+		ce = d.checkError()
+	}
+	c.cache.Set(key, ce, d.TTL)
+	return ce, nil
+}
+
+// decide -- ask the policy service for a decision
+// Transport errors and unexpected responses are returned as errors
+// so that the binding's failure policy applies
+func (c *checker) decide(ctx context.Context, cr *sc.CheckRequest) (*Decision, error) {
+	buf := &bytes.Buffer{}
+	if err := (&jsonpb.Marshaler{}).Marshal(buf, cr); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, buf)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("Accept", ContentType)
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.clnt.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// drain so that the connection is reused
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", c.url, resp.Status)
+	}
+	d := &Decision{}
+	if err := json.NewDecoder(resp.Body).Decode(d); err != nil {
+		return nil, fmt.Errorf("%s responded with an invalid decision: %s", c.url, err)
+	}
+	return d, nil
+}
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	ecfg := cfg.(*Config)
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: ecfg.MaxIdleConns,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &checker{
+		url:     ecfg.URL,
+		headers: ecfg.Headers,
+		clnt: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(ecfg.TimeoutMs) * time.Millisecond,
+		},
+		transport: transport,
+		cache:     newDecisionCache(ecfg.MaxCacheEntries),
+	}, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		TimeoutMs:       DefaultTimeoutMs,
+		MaxIdleConns:    DefaultMaxIdleConns,
+		MaxCacheEntries: DefaultMaxCacheEntries,
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	ecfg := cfg.(*Config)
+	u, err := url.Parse(ecfg.URL)
+	if err != nil {
+		return err
+	}
+	switch {
+	case (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		return errors.New("URL must be an http or https url")
+	case ecfg.TimeoutMs <= 0:
+		return errors.New("TimeoutMs must be positive")
+	case ecfg.MaxIdleConns <= 0:
+		return errors.New("MaxIdleConns must be positive")
+	case ecfg.MaxCacheEntries <= 0:
+		return errors.New("MaxCacheEntries must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package extauthz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+)
+
+// policyServer -- allows api_key:good, denies api_key:bad with a code,
+// caches decisions for api_key:cached, stalls for api_key:slow and fails for anything else
+func policyServer(conns *int32, requests *int32) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		cr := &sc.CheckRequest{}
+		if r.Header.Get("Content-Type") != ContentType || r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := jsonpb.Unmarshal(r.Body, cr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var d interface{}
+		switch cr.Operation.ConsumerId {
+		case "api_key:good":
+			d = Decision{Allow: true}
+		case "api_key:bad":
+			d = Decision{Code: "API_KEY_INVALID", Detail: "go away " + cr.ServiceName}
+		case "api_key:cached":
+			d = Decision{Code: "API_KEY_INVALID", TTL: 60}
+		case "api_key:nocode":
+			d = Decision{Detail: "denied"}
+		case "api_key:badcode":
+			d = Decision{Code: "NOPE"}
+		case "api_key:garbage":
+			d = "allow"
+		case "api_key:slow":
+			time.Sleep(200 * time.Millisecond)
+			d = Decision{Allow: true}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(d)
+	}))
+	ts.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(conns, 1)
+		}
+	}
+	ts.Start()
+	return ts
+}
+
+func buildChecker(url string, timeoutMs int) *checker {
+	b := new(builder)
+	cfg := b.ConfigStruct().(*Config)
+	cfg.URL = url
+	cfg.TimeoutMs = timeoutMs
+	cfg.Headers = map[string]string{"Authorization": "Bearer t0ken"}
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	return c.(*checker)
+}
+
+func checkRequest(consumer string) *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: "bookstore",
+		Operation: &sc.Operation{
+			OperationId:   "c37d4302-66bd-4f34-8ed7-07b36d941fcd",
+			OperationName: "ListShelves",
+			ConsumerId:    consumer,
+			Labels:        map[string]string{"servicecontrol.googleapis.com/caller_ip": "10.128.0.2"},
+		},
+	}
+}
+
+func TestDecisions(t *testing.T) {
+	g.RegisterTestingT(t)
+	var conns, requests int32
+	ts := policyServer(&conns, &requests)
+	defer ts.Close()
+	chk := buildChecker(ts.URL, DefaultTimeoutMs)
+	defer chk.Unload()
+
+	for _, tc := range []struct {
+		consumer string
+		ce       *sc.CheckError
+		err      bool
+	}{
+		{"api_key:good", nil, false},
+		{"api_key:bad", &sc.CheckError{Code: sc.CheckError_API_KEY_INVALID, Detail: "go away bookstore"}, false},
+		{"api_key:nocode", &sc.CheckError{Code: sc.CheckError_PERMISSION_DENIED, Detail: "denied"}, false},
+		{"api_key:badcode", &sc.CheckError{Code: sc.CheckError_PERMISSION_DENIED}, false},
+		{"api_key:garbage", nil, true},
+		{"api_key:unknown", nil, true},
+	} {
+		ce, err := chk.Check(context.Background(), checkRequest(tc.consumer))
+		g.Expect(err != nil).To(g.Equal(tc.err), tc.consumer)
+		g.Expect(ce).To(g.Equal(tc.ce), tc.consumer)
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	g.RegisterTestingT(t)
+	var conns, requests int32
+	ts := policyServer(&conns, &requests)
+	defer ts.Close()
+	chk := buildChecker(ts.URL, DefaultTimeoutMs)
+	defer chk.Unload()
+
+	for i := 0; i < 20; i++ {
+		ce, err := chk.Check(context.Background(), checkRequest("api_key:bad"))
+		g.Expect(err).To(g.BeNil())
+		g.Expect(ce).NotTo(g.BeNil())
+	}
+	g.Expect(atomic.LoadInt32(&conns)).To(g.Equal(int32(1)), "connection should be reused")
+}
+
+func TestDecisionTTL(t *testing.T) {
+	g.RegisterTestingT(t)
+	var conns, requests int32
+	ts := policyServer(&conns, &requests)
+	defer ts.Close()
+	chk := buildChecker(ts.URL, DefaultTimeoutMs)
+	defer chk.Unload()
+	now := time.Unix(1475272930, 0)
+	chk.cache.now = func() time.Time { return now }
+
+	want := &sc.CheckError{Code: sc.CheckError_API_KEY_INVALID}
+	for i := 0; i < 3; i++ {
+		cr := checkRequest("api_key:cached")
+		cr.Operation.OperationId = fmt.Sprintf("op-%d", i)
+		ce, err := chk.Check(context.Background(), cr)
+		g.Expect(err).To(g.BeNil())
+		g.Expect(ce).To(g.Equal(want))
+	}
+	g.Expect(atomic.LoadInt32(&requests)).To(g.Equal(int32(1)), "identical requests are answered from the cache")
+
+	cr := checkRequest("api_key:cached")
+	cr.Operation.OperationName = "GetShelf"
+	chk.Check(context.Background(), cr)
+	g.Expect(atomic.LoadInt32(&requests)).To(g.Equal(int32(2)), "a different operation is not")
+
+	for i := 0; i < 2; i++ {
+		chk.Check(context.Background(), checkRequest("api_key:good"))
+	}
+	g.Expect(atomic.LoadInt32(&requests)).To(g.Equal(int32(4)), "decisions without a ttl are not cached")
+
+	now = now.Add(61 * time.Second)
+	chk.Check(context.Background(), checkRequest("api_key:cached"))
+	g.Expect(atomic.LoadInt32(&requests)).To(g.Equal(int32(5)), "the ttl expired")
+}
+
+func TestTimeouts(t *testing.T) {
+	g.RegisterTestingT(t)
+	var conns, requests int32
+	ts := policyServer(&conns, &requests)
+	defer ts.Close()
+
+	chk := buildChecker(ts.URL, 50)
+	_, err := chk.Check(context.Background(), checkRequest("api_key:slow"))
+	g.Expect(err).NotTo(g.BeNil(), "client timeout")
+
+	chk = buildChecker(ts.URL, DefaultTimeoutMs)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = chk.Check(ctx, checkRequest("api_key:slow"))
+	g.Expect(err).NotTo(g.BeNil(), "check deadline")
+	g.Expect(time.Since(start)).To(g.BeNumerically("<", 150*time.Millisecond))
+
+	ts.Close()
+	_, err = chk.Check(context.Background(), checkRequest("api_key:good"))
+	g.Expect(err).NotTo(g.BeNil(), "server down")
+}
+
+func TestValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	for _, cfg := range []*Config{
+		{URL: "", TimeoutMs: 1, MaxIdleConns: 1, MaxCacheEntries: 1},
+		{URL: "policy:8080/check", TimeoutMs: 1, MaxIdleConns: 1, MaxCacheEntries: 1},
+		{URL: "ftp://policy/check", TimeoutMs: 1, MaxIdleConns: 1, MaxCacheEntries: 1},
+		{URL: "http://policy/check", TimeoutMs: 0, MaxIdleConns: 1, MaxCacheEntries: 1},
+		{URL: "http://policy/check", TimeoutMs: 1, MaxIdleConns: 0, MaxCacheEntries: 1},
+		{URL: "http://policy/check", TimeoutMs: 1, MaxIdleConns: 1},
+	} {
+		g.Expect(b.ValidateConfig(cfg)).NotTo(g.Succeed(), "%#v", cfg)
+	}
+	g.Expect(b.ValidateConfig(&Config{URL: "https://policy/check", TimeoutMs: 1, MaxIdleConns: 1, MaxCacheEntries: 1})).To(g.Succeed())
+}
@@ -0,0 +1,61 @@
+// Package extauthz -- delegate check decisions to an external HTTP policy service.
+//
+// The CheckRequest is POSTed to the configured url using the proto3 JSON mapping,
+// the service responds with a Decision. A Decision with a ttl is reused for
+// identical requests, ignoring operation id and times, until it expires.
+package extauthz
+
+import (
+	"net/http"
+)
+
+const (
+	// Name -- name of this provider.
+	Name = "extauthz"
+	// DefaultTimeoutMs -- upper bound on a call to the policy service
+	DefaultTimeoutMs = 500
+	// DefaultMaxIdleConns -- idle connections kept open to the policy service
+	DefaultMaxIdleConns = 32
+	// DefaultMaxCacheEntries -- decisions with a ttl kept by a checker
+	DefaultMaxCacheEntries = 10000
+	// DefaultCode -- code of a deny Decision that does not specify one
+	DefaultCode = "PERMISSION_DENIED"
+	// ContentType -- of requests and responses
+	ContentType = "application/json"
+)
+
+type (
+	builder struct{}
+
+	checker struct {
+		url       string
+		headers   map[string]string
+		clnt      *http.Client
+		transport *http.Transport
+		cache     *decisionCache
+	}
+
+	// Config -- struct needed to configure this checker
+	Config struct {
+		// URL -- policy service endpoint
+		URL string `yaml:"url" required:"true"`
+		// TimeoutMs -- upper bound on a call, the check deadline also applies
+		TimeoutMs int `yaml:"timeoutms"`
+		// MaxIdleConns -- size of the connection pool
+		MaxIdleConns int `yaml:"maxidleconns"`
+		// Headers -- added to every request ex: Authorization
+		Headers map[string]string `yaml:"headers"`
+		// MaxCacheEntries -- least recently used decisions are evicted beyond this
+		MaxCacheEntries int `yaml:"maxcacheentries"`
+	}
+
+	// Decision -- response of the policy service
+	Decision struct {
+		Allow bool `json:"allow"`
+		// Code -- name of a CheckError code, defaults to DefaultCode
+		Code   string `json:"code,omitempty"`
+		Detail string `json:"detail,omitempty"`
+		// TTL -- seconds the decision applies to identical requests, 0 disables caching
+		TTL int `json:"ttl,omitempty"`
+	}
+)
@@ -0,0 +1,262 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"strings"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// keys -- typed atomic accessor for keys
+func (c *checker) keys() []*key {
+	keys, _ := c.atomicKeys.Load().([]*key)
+	return keys
+}
+
+// setKeys -- install static keys followed by fetched keys
+func (c *checker) setKeys(fetched []*key) {
+	keys := make([]*key, 0, len(c.static)+len(fetched))
+	keys = append(keys, c.static...)
+	c.atomicKeys.Store(append(keys, fetched...))
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errMalformed
+	}
+	if v == nil {
+		return nil
+	}
+	if json.Unmarshal(buf, v) != nil {
+		return errMalformed
+	}
+	return nil
+}
+
+// verify -- verify the signature and the registered claims of token
+func (c *checker) verify(token string) (claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformed
+	}
+	hdr := header{}
+	cl := claims{}
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, err
+	}
+	if err := decodeSegment(parts[1], &cl); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	keys := c.keys()
+	if len(keys) == 0 {
+		return nil, ErrKeysNotLoaded
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	err = errUnsupported
+	for _, k := range keys {
+		if hdr.Kid != "" && k.kid != "" && hdr.Kid != k.kid {
+			continue
+		}
+		kerr := k.verify(hdr.Alg, signed, sig)
+		if kerr == nil {
+			return cl, c.validate(cl)
+		}
+		if kerr != errUnsupported {
+			err = kerr
+		}
+	}
+	return nil, err
+}
+
+// numericDate -- value of a NumericDate claim
+func (cl claims) numericDate(name string) (time.Time, bool) {
+	v, ok := cl[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// validate -- check exp, nbf, iat, iss and aud claims
+func (c *checker) validate(cl claims) error {
+	now := c.now()
+	exp, ok := cl.numericDate("exp")
+	if !ok || now.After(exp.Add(c.skew)) {
+		return errExpired
+	}
+	for _, name := range []string{"nbf", "iat"} {
+		if t, ok := cl.numericDate(name); ok && t.After(now.Add(c.skew)) {
+			return errNotYetValid
+		}
+	}
+	if c.cfg.Issuer != "" && cl["iss"] != c.cfg.Issuer {
+		return errIssuer
+	}
+	if len(c.cfg.Audiences) > 0 {
+		for _, aud := range c.cfg.Audiences {
+			if contains(cl["aud"], aud) {
+				return nil
+			}
+		}
+		return errAudience
+	}
+	return nil
+}
+
+// contains -- claim value v is want, or contains want as an
+// array element or a space separated word
+func contains(v interface{}, want string) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case string:
+		if v == want {
+			return true
+		}
+		for _, w := range strings.Fields(v) {
+			if w == want {
+				return true
+			}
+		}
+		return false
+	case []interface{}:
+		for _, e := range v {
+			if fmt.Sprint(e) == want {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(v) == want
+}
+
+// checkClaims -- ensure claims required by method are present
+func (c *checker) checkClaims(cl claims, method string) *sc.CheckError {
+	for _, m := range []string{AnyMethod, method} {
+		for name, want := range c.cfg.MethodClaims[m] {
+			if !contains(cl[name], want) {
+				return permissionDenied(fmt.Sprintf("claim %s must contain %s for %s", name, want, method))
+			}
+		}
+	}
+	return nil
+}
+
+// Check -- verify the token carried by the configured label
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	op := cr.GetOperation()
+	if op == nil {
+		return permissionDenied(errMissing.Error()), nil
+	}
+	token := strings.TrimPrefix(op.Labels[c.cfg.Label], BearerPrefix)
+	if token == "" {
+		return permissionDenied(errMissing.Error()), nil
+	}
+	cl, err := c.verify(token)
+	if err == ErrKeysNotLoaded {
+		return nil, err
+	}
+	if err != nil {
+		glog.V(1).Infof("Rejected token for %s: %v", op.OperationName, err)
+		return permissionDenied(err.Error()), nil
+	}
+	return c.checkClaims(cl, op.OperationName), nil
+}
+
+// load -- install the keys of a fetched JWKS document
+func (c *checker) load(buf []byte) error {
+	keys, err := parseJWKS(buf)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Loaded %d keys from %s", len(keys), c.poller)
+	c.setKeys(keys)
+	return nil
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+func (c *checker) Unload() {
+	if c.poller != nil {
+		c.poller.Stop()
+	}
+}
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	jcfg := cfg.(*Config)
+	chk := &checker{
+		cfg:  jcfg,
+		skew: time.Duration(jcfg.ClockSkewSec) * time.Second,
+		now:  time.Now,
+	}
+	for _, k := range jcfg.Keys {
+		pk, err := parseKey(k)
+		if err != nil {
+			return nil, err
+		}
+		chk.static = append(chk.static, pk)
+	}
+	chk.setKeys(nil)
+	if jcfg.JWKSURL != "" {
+		var err error
+		chk.poller, err = mixologist.NewPoller(jcfg.JWKSURL, jcfg.Kubeconfig,
+			time.Duration(jcfg.RefreshIntervalSec)*time.Second, chk.load)
+		if err != nil {
+			return nil, err
+		}
+		chk.poller.Start()
+	}
+	return chk, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		RefreshIntervalSec: DefaultRefreshIntervalSec,
+		ClockSkewSec:       DefaultClockSkewSec,
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	jcfg := cfg.(*Config)
+	switch {
+	case jcfg.Label == "":
+		return errors.New("Label is required")
+	case len(jcfg.Keys) == 0 && jcfg.JWKSURL == "":
+		return errors.New("One of Keys or JWKSURL is required")
+	case jcfg.JWKSURL != "" && jcfg.RefreshIntervalSec <= 0:
+		return errors.New("RefreshIntervalSec must be positive")
+	case jcfg.ClockSkewSec < 0:
+		return errors.New("ClockSkewSec cannot be negative")
+	}
+	for i, k := range jcfg.Keys {
+		if _, err := parseKey(k); err != nil {
+			return fmt.Errorf("key %d: %s", i, err)
+		}
+	}
+	if jcfg.JWKSURL != "" {
+		return mixologist.ValidateSourceURL(jcfg.JWKSURL)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+)
+
+// testLabel -- label carrying the token in tests
+const testLabel = "authorization"
+
+var (
+	now    = time.Unix(1475272937, 0)
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	secret = []byte("s3cr3t")
+)
+
+func init() {
+	var err error
+	if rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	if ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		panic(err)
+	}
+}
+
+func enc(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func sign(alg string, kid string, cl claims) string {
+	hdr, _ := json.Marshal(header{Alg: alg, Kid: kid})
+	payload, _ := json.Marshal(cl)
+	signed := enc(hdr) + "." + enc(payload)
+	var sig []byte
+	switch alg {
+	case "RS256":
+		h := crypto.SHA256.New()
+		h.Write([]byte(signed))
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, h.Sum(nil))
+	case "ES256":
+		h := crypto.SHA256.New()
+		h.Write([]byte(signed))
+		r, s, _ := ecdsa.Sign(rand.Reader, ecKey, h.Sum(nil))
+		sig = append(pad(r, 32), pad(s, 32)...)
+	case "HS256":
+		mac := hmac.New(crypto.SHA256.New, secret)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	return signed + "." + enc(sig)
+}
+
+func pad(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func pemKey(pub interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	g.Expect(err).To(g.BeNil())
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func validClaims() claims {
+	return claims{
+		"iss":   "https://issuer.example.com",
+		"aud":   []string{"bookstore", "other"},
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"scope": "read write",
+	}
+}
+
+func buildChecker(cfg *Config) *checker {
+	b := new(builder)
+	dflt := b.ConfigStruct().(*Config)
+	cfg.Label, cfg.RefreshIntervalSec, cfg.ClockSkewSec = testLabel, dflt.RefreshIntervalSec, dflt.ClockSkewSec
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	chk := c.(*checker)
+	chk.now = func() time.Time { return now }
+	return chk
+}
+
+func checkRequest(method string, token string) *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: "bookstore",
+		Operation: &sc.Operation{
+			OperationName: method,
+			Labels:        map[string]string{testLabel: token},
+		},
+	}
+}
+
+func expectDenied(chk *checker, method string, token string, msg string) {
+	ce, err := chk.Check(context.Background(), checkRequest(method, token))
+	g.Expect(err).To(g.BeNil(), msg)
+	g.Expect(ce).NotTo(g.BeNil(), msg)
+	g.Expect(ce.Code).To(g.Equal(sc.CheckError_PERMISSION_DENIED), msg)
+}
+
+func expectAllowed(chk *checker, method string, token string, msg string) {
+	ce, err := chk.Check(context.Background(), checkRequest(method, token))
+	g.Expect(err).To(g.BeNil(), msg)
+	g.Expect(ce).To(g.BeNil(), msg)
+}
+
+func TestStaticKeys(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(&Config{
+		Issuer:    "https://issuer.example.com",
+		Audiences: []string{"bookstore"},
+		Keys: []Key{
+			{KID: "rsa", PEM: pemKey(&rsaKey.PublicKey)},
+			{PEM: pemKey(&ecKey.PublicKey)},
+			{KID: "hmac", Secret: string(secret)},
+		},
+	})
+	for _, alg := range []string{"RS256", "ES256", "HS256"} {
+		expectAllowed(chk, "ListShelves", sign(alg, "", validClaims()), alg)
+		expectAllowed(chk, "ListShelves", BearerPrefix+sign(alg, "", validClaims()), alg+" bearer")
+	}
+	expectAllowed(chk, "ListShelves", sign("RS256", "rsa", validClaims()), "matching kid")
+	expectDenied(chk, "ListShelves", sign("RS256", "hmac", validClaims()), "kid of another key")
+	expectDenied(chk, "ListShelves", sign("none", "", validClaims()), "alg none")
+
+	tampered := sign("RS256", "", validClaims())
+	cl := validClaims()
+	cl["scope"] = "admin"
+	forged := sign("RS256", "", cl)
+	expectDenied(chk, "ListShelves", tampered[:len(tampered)-4]+"AAAA", "bad signature")
+	expectDenied(chk, "ListShelves", forged[:len(forged)-10]+tampered[len(tampered)-10:], "mixed signature")
+	expectDenied(chk, "ListShelves", "not.a.token", "malformed")
+	expectDenied(chk, "ListShelves", "", "missing")
+}
+
+func TestRegisteredClaims(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(&Config{
+		Issuer:    "https://issuer.example.com",
+		Audiences: []string{"bookstore"},
+		Keys:      []Key{{Secret: string(secret)}},
+	})
+	for name, mod := range map[string]func(claims){
+		"expired":        func(cl claims) { cl["exp"] = now.Add(-2 * time.Minute).Unix() },
+		"no exp":         func(cl claims) { delete(cl, "exp") },
+		"not yet valid":  func(cl claims) { cl["nbf"] = now.Add(2 * time.Minute).Unix() },
+		"issued later":   func(cl claims) { cl["iat"] = now.Add(2 * time.Minute).Unix() },
+		"wrong issuer":   func(cl claims) { cl["iss"] = "https://evil.com" },
+		"wrong audience": func(cl claims) { cl["aud"] = "other" },
+	} {
+		cl := validClaims()
+		mod(cl)
+		expectDenied(chk, "ListShelves", sign("HS256", "", cl), name)
+	}
+	// within clock skew
+	cl := validClaims()
+	cl["exp"] = now.Add(-30 * time.Second).Unix()
+	cl["aud"] = "bookstore"
+	expectAllowed(chk, "ListShelves", sign("HS256", "", cl), "skew")
+}
+
+func TestMethodClaims(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(&Config{
+		Keys: []Key{{Secret: string(secret)}},
+		MethodClaims: map[string]map[string]string{
+			AnyMethod:     {"scope": "read"},
+			"DeleteShelf": {"scope": "admin", "email_verified": "true"},
+		},
+	})
+	expectAllowed(chk, "ListShelves", sign("HS256", "", validClaims()), "read scope")
+	expectDenied(chk, "DeleteShelf", sign("HS256", "", validClaims()), "admin scope missing")
+	cl := validClaims()
+	cl["scope"] = []string{"read", "admin"}
+	cl["email_verified"] = true
+	expectAllowed(chk, "DeleteShelf", sign("HS256", "", cl), "admin scope")
+	delete(cl, "scope")
+	expectDenied(chk, "ListShelves", sign("HS256", "", cl), "every method requires read")
+}
+
+func jwkOf(kid string, pub interface{}) jwk {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return jwk{Kty: "RSA", Kid: kid, N: enc(pub.N.Bytes()), E: enc(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return jwk{Kty: "EC", Kid: kid, Crv: "P-256", X: enc(pub.X.Bytes()), Y: enc(pub.Y.Bytes())}
+	}
+	return jwk{Kty: "oct", Kid: kid, K: enc(secret)}
+}
+
+func TestJWKS(t *testing.T) {
+	g.RegisterTestingT(t)
+	doc := jwks{Keys: []jwk{
+		jwkOf("rsa", &rsaKey.PublicKey),
+		{Kty: "RSA", Kid: "enc", Use: "enc"},
+		{Kty: "EC", Kid: "bad", Crv: "P-256", X: "AA", Y: "AA"},
+	}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(doc)
+	}))
+	defer ts.Close()
+
+	chk := buildChecker(&Config{JWKSURL: ts.URL})
+	defer chk.Unload()
+	g.Eventually(func() int { return len(chk.keys()) }).Should(g.Equal(1))
+	expectAllowed(chk, "ListShelves", sign("RS256", "rsa", validClaims()), "jwks rsa key")
+	expectDenied(chk, "ListShelves", sign("ES256", "ec", validClaims()), "unknown key")
+
+	// key rotation
+	doc.Keys = []jwk{jwkOf("ec", &ecKey.PublicKey), jwkOf("hmac", nil)}
+	g.Expect(chk.poller.Poll()).To(g.Succeed())
+	expectAllowed(chk, "ListShelves", sign("ES256", "ec", validClaims()), "rotated ec key")
+	expectAllowed(chk, "ListShelves", sign("HS256", "hmac", validClaims()), "rotated oct key")
+	expectDenied(chk, "ListShelves", sign("RS256", "rsa", validClaims()), "rotated out")
+}
+
+func TestKeysNotLoaded(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := &checker{cfg: &Config{Label: testLabel}, now: time.Now}
+	ce, err := chk.Check(context.Background(), checkRequest("ListShelves", sign("RS256", "", validClaims())))
+	g.Expect(err).To(g.Equal(ErrKeysNotLoaded))
+	g.Expect(ce).To(g.BeNil())
+}
+
+func TestValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	for _, cfg := range []*Config{
+		{Label: testLabel},
+		{Label: "", Keys: []Key{{Secret: "x"}}},
+		{Label: testLabel, Keys: []Key{{}}},
+		{Label: testLabel, Keys: []Key{{PEM: "garbage"}}},
+		{Label: testLabel, Keys: []Key{{Secret: "x", PEM: pemKey(&rsaKey.PublicKey)}}},
+		{Label: testLabel, JWKSURL: "ftp://example.com/jwks", RefreshIntervalSec: 1},
+		{Label: testLabel, JWKSURL: "https://example.com/jwks"},
+		{Label: testLabel, Keys: []Key{{Secret: "x"}}, ClockSkewSec: -1},
+	} {
+		g.Expect(b.ValidateConfig(cfg)).NotTo(g.Succeed(), "%#v", cfg)
+	}
+	cfg := b.ConfigStruct().(*Config)
+	cfg.JWKSURL = "https://example.com/jwks"
+	g.Expect(b.ValidateConfig(cfg)).NotTo(g.Succeed(), "Label has no default")
+	cfg.Label = testLabel
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+}
@@ -0,0 +1,175 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // hashes used by RS256, ES256 ...
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang/glog"
+)
+
+var (
+	hashes = map[string]crypto.Hash{
+		"256": crypto.SHA256,
+		"384": crypto.SHA384,
+		"512": crypto.SHA512,
+	}
+	curves = map[string]elliptic.Curve{
+		"P-256": elliptic.P256(),
+		"P-384": elliptic.P384(),
+		"P-521": elliptic.P521(),
+	}
+)
+
+// parseKey -- convert a static Key
+func parseKey(k Key) (*key, error) {
+	if k.Secret != "" {
+		if k.PEM != "" {
+			return nil, errors.New("key cannot have both pem and secret")
+		}
+		return &key{kid: k.KID, secret: []byte(k.Secret)}, nil
+	}
+	block, _ := pem.Decode([]byte(k.PEM))
+	if block == nil {
+		return nil, errors.New("key requires a pem encoded public key or a secret")
+	}
+	var pub interface{}
+	var err error
+	if block.Type == "CERTIFICATE" {
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	} else {
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+	return &key{kid: k.KID, pub: pub}, nil
+}
+
+func decodeInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+// parseJWK -- convert a JSON Web Key
+func parseJWK(j jwk) (*key, error) {
+	k := &key{kid: j.Kid}
+	switch j.Kty {
+	case "RSA":
+		n, e := decodeInt(j.N), decodeInt(j.E)
+		if n == nil || e == nil {
+			return nil, errors.New("invalid RSA key")
+		}
+		k.pub = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		crv, x, y := curves[j.Crv], decodeInt(j.X), decodeInt(j.Y)
+		if crv == nil || x == nil || y == nil || !crv.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC key")
+		}
+		k.pub = &ecdsa.PublicKey{Curve: crv, X: x, Y: y}
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(j.K)
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("invalid oct key")
+		}
+		k.secret = secret
+	default:
+		return nil, fmt.Errorf("unsupported kty %q", j.Kty)
+	}
+	return k, nil
+}
+
+// parseJWKS -- convert a JWKS document, unusable keys are skipped
+func parseJWKS(buf []byte) ([]*key, error) {
+	doc := jwks{}
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, err
+	}
+	keys := make([]*key, 0, len(doc.Keys))
+	for _, j := range doc.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := parseJWK(j)
+		if err != nil {
+			glog.Warningf("Skipping key %q -- %v", j.Kid, err)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// verify -- verify signature of signed with algorithm alg
+// returns errUnsupported if the key cannot be used with alg
+func (k *key) verify(alg string, signed []byte, sig []byte) error {
+	if len(alg) != 5 {
+		return errUnsupported
+	}
+	hash, found := hashes[alg[2:]]
+	if !found {
+		return errUnsupported
+	}
+	h := hash.New()
+	switch alg[:2] {
+	case "HS":
+		if k.secret == nil {
+			return errUnsupported
+		}
+		mac := hmac.New(hash.New, k.secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errSignature
+		}
+		return nil
+	case "RS":
+		pub, ok := k.pub.(*rsa.PublicKey)
+		if !ok {
+			return errUnsupported
+		}
+		h.Write(signed)
+		if rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig) != nil {
+			return errSignature
+		}
+		return nil
+	case "ES":
+		pub, ok := k.pub.(*ecdsa.PublicKey)
+		if !ok {
+			return errUnsupported
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errSignature
+		}
+		h.Write(signed)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return errSignature
+		}
+		return nil
+	}
+	return errUnsupported
+}
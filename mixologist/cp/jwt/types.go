@@ -0,0 +1,127 @@
+package jwt
+
+import (
+	"crypto"
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+)
+
+const (
+	// Name -- name of this provider.
+	Name = "jwt"
+	// BearerPrefix -- optional prefix of the token
+	BearerPrefix = "Bearer "
+	// DefaultRefreshIntervalSec -- interval between fetches of the JWKS document
+	DefaultRefreshIntervalSec = 300
+	// DefaultClockSkewSec -- allowed clock skew for exp, nbf and iat
+	DefaultClockSkewSec = 60
+	// AnyMethod -- MethodClaims key applying to every API method
+	AnyMethod = "*"
+)
+
+type (
+	builder struct{}
+
+	checker struct {
+		cfg    *Config
+		skew   time.Duration
+		static []*key
+		// poller -- nil without JWKSURL
+		poller *mixologist.Poller
+		// atomicKeys holds value of type []*key, static keys followed by fetched keys
+		atomicKeys atomic.Value
+		now        func() time.Time
+	}
+
+	// Config -- struct needed to configure this checker
+	// At least one of Keys or JWKSURL must be given
+	Config struct {
+		// Label -- operation label carrying the token, there is no default
+		// as ESP does not report the Authorization header under a fixed label
+		Label string `yaml:"label" required:"true"`
+		// Issuer -- required iss claim, not checked if empty
+		Issuer string `yaml:"issuer"`
+		// Audiences -- the aud claim must contain one of these, not checked if empty
+		Audiences []string `yaml:"audiences"`
+		// Keys -- static verification keys
+		Keys []Key `yaml:"keys"`
+		// JWKSURL -- http(s) url, file or configmap://namespace/name of a JWKS document
+		JWKSURL string `yaml:"jwksurl"`
+		// RefreshIntervalSec -- interval between fetches of JWKSURL
+		RefreshIntervalSec int `yaml:"refreshintervalsec"`
+		// Kubeconfig -- used for configmap urls, defaults to the in cluster config
+		Kubeconfig string `yaml:"kubeconfig"`
+		// ClockSkewSec -- allowed clock skew for exp, nbf and iat
+		ClockSkewSec int `yaml:"clockskewsec"`
+		// MethodClaims -- claims required per API method, AnyMethod applies to every method.
+		// A claim matches if it is equal to the value, or contains it
+		// as an array element or as a space separated word ex: scope
+		MethodClaims map[string]map[string]string `yaml:"methodclaims"`
+	}
+
+	// Key -- static verification key
+	Key struct {
+		// KID -- matched against the kid header if both are present
+		KID string `yaml:"kid"`
+		// PEM -- RSA or EC public key or certificate
+		PEM string `yaml:"pem"`
+		// Secret -- HMAC secret
+		Secret string `yaml:"secret"`
+	}
+
+	// key -- parsed verification key
+	key struct {
+		kid    string
+		pub    crypto.PublicKey
+		secret []byte
+	}
+
+	// jwks -- JSON Web Key Set document
+	jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		K   string `json:"k"`
+	}
+
+	header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	claims map[string]interface{}
+)
+
+var (
+	// ErrKeysNotLoaded -- JWKS has not been fetched and there are no static keys
+	ErrKeysNotLoaded = errors.New("jwt verification keys not loaded")
+
+	errMalformed   = errors.New("malformed token")
+	errUnsupported = errors.New("unsupported algorithm")
+	errSignature   = errors.New("invalid signature")
+	errExpired     = errors.New("token expired")
+	errNotYetValid = errors.New("token not yet valid")
+	errIssuer      = errors.New("invalid issuer")
+	errAudience    = errors.New("invalid audience")
+	errMissing     = errors.New("token missing")
+)
+
+func permissionDenied(detail string) *sc.CheckError {
+	return &sc.CheckError{
+		Code:   sc.CheckError_PERMISSION_DENIED,
+		Detail: detail,
+	}
+}
@@ -0,0 +1,98 @@
+package loadshed
+
+import (
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"math/rand"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+	mixologist.RegisterReportConsumer(Name, new(consumerBuilder))
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+func (c *checker) Unload() {}
+
+// lowPriority -- consumer may be shed
+func (c *checker) lowPriority(consumerID string) bool {
+	if mixologist.MatchID(c.cfg.HighPriority, consumerID) {
+		return false
+	}
+	return len(c.cfg.LowPriority) == 0 || mixologist.MatchID(c.cfg.LowPriority, consumerID)
+}
+
+// overloaded -- signals of the service exceed a threshold
+func (c *checker) overloaded(service string) bool {
+	s := c.tracker.window(service, c.cfg.WindowSec)
+	if s.requests < c.cfg.MinRequests {
+		return false
+	}
+	if c.cfg.MaxErrorRate > 0 && float64(s.errors)/float64(s.requests) > c.cfg.MaxErrorRate {
+		glog.V(1).Infof("%s error rate %d/%d exceeds %f", service, s.errors, s.requests, c.cfg.MaxErrorRate)
+		return true
+	}
+	if c.cfg.MaxBackendLatencyMs > 0 && s.latencyMs > c.cfg.MaxBackendLatencyMs {
+		glog.V(1).Infof("%s backend latency %fms exceeds %fms", service, s.latencyMs, c.cfg.MaxBackendLatencyMs)
+		return true
+	}
+	return false
+}
+
+// Check -- shed a fraction of low priority traffic while the service is overloaded
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	consumerID := ""
+	if op := cr.GetOperation(); op != nil {
+		consumerID = op.ConsumerId
+	}
+	if !c.lowPriority(consumerID) || !c.overloaded(cr.ServiceName) {
+		return nil, nil
+	}
+	if c.random() < c.cfg.ShedFraction {
+		return LoadSheddingCheckError, nil
+	}
+	return nil, nil
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	return &checker{
+		cfg:     cfg.(*Config),
+		tracker: signals,
+		random:  rand.Float64,
+	}, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		WindowSec:    DefaultWindowSec,
+		MinRequests:  DefaultMinRequests,
+		ShedFraction: DefaultShedFraction,
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	lcfg := cfg.(*Config)
+	switch {
+	case lcfg.WindowSec <= 0 || lcfg.WindowSec > MaxWindowSec:
+		return errors.New("WindowSec must be between 1 and 600")
+	case lcfg.MinRequests < 0:
+		return errors.New("MinRequests cannot be negative")
+	case lcfg.MaxBackendLatencyMs < 0 || lcfg.MaxErrorRate < 0 || lcfg.MaxErrorRate > 1:
+		return errors.New("MaxBackendLatencyMs must not be negative and MaxErrorRate must be between 0 and 1")
+	case lcfg.MaxBackendLatencyMs == 0 && lcfg.MaxErrorRate == 0:
+		return errors.New("One of MaxBackendLatencyMs or MaxErrorRate is required")
+	case lcfg.ShedFraction <= 0 || lcfg.ShedFraction > 1:
+		return errors.New("ShedFraction must be in (0, 1]")
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package loadshed
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+)
+
+// report -- requests responses of class, with the given mean backend latency in seconds
+func report(service string, requests int64, class string, latency float64) *sc.ReportRequest {
+	return &sc.ReportRequest{
+		ServiceName: service,
+		Operations: []*sc.Operation{{
+			Labels: map[string]string{mixologist.ResponseCodeClass: class},
+			MetricValueSets: []*sc.MetricValueSet{
+				{
+					MetricName: mixologist.ProducerRequestCount,
+					MetricValues: []*sc.MetricValue{
+						{Value: &sc.MetricValue_Int64Value{Int64Value: requests}},
+					},
+				},
+				{
+					MetricName: mixologist.ProducerBackendLatencies,
+					MetricValues: []*sc.MetricValue{
+						{Value: &sc.MetricValue_DistributionValue{DistributionValue: &sc.Distribution{Count: requests, Mean: latency}}},
+					},
+				},
+			},
+		}},
+	}
+}
+
+// testTracker -- tracker reading the time from now
+func testTracker(now *time.Time) *tracker {
+	t := newTracker()
+	t.now = func() time.Time { return *now }
+	return t
+}
+
+// check -- ask chk about consumerID of service
+func check(chk mixologist.Checker, service string, consumerID string) *sc.CheckError {
+	ce, err := chk.Check(context.Background(), &sc.CheckRequest{
+		ServiceName: service,
+		Operation:   &sc.Operation{ConsumerId: consumerID},
+	})
+	g.Expect(err).To(g.BeNil())
+	return ce
+}
+
+func TestTrackerWindow(t *testing.T) {
+	g.RegisterTestingT(t)
+	now := time.Unix(1475272937, 0)
+	tr := testTracker(&now)
+	tr.record(report("bookstore", 90, "2xx", 0.010))
+	tr.record(report("bookstore", 10, ServerErrorClass, 0.110))
+	now = now.Add(30 * time.Second)
+	tr.record(report("bookstore", 100, "2xx", 0.010))
+	tr.record(report("library", 5, ServerErrorClass, 1))
+
+	s := tr.window("bookstore", 60)
+	g.Expect(s.requests).To(g.Equal(int64(200)))
+	g.Expect(s.errors).To(g.Equal(int64(10)))
+	g.Expect(s.latencyMs).To(g.BeNumerically("~", 15, 1e-9))
+
+	// the first second falls out of a 30 second window
+	s = tr.window("bookstore", 30)
+	g.Expect(s.requests).To(g.Equal(int64(100)))
+	g.Expect(s.errors).To(g.Equal(int64(0)))
+
+	g.Expect(tr.window("library", 60).errors).To(g.Equal(int64(5)))
+	g.Expect(tr.window("shop", 60)).To(g.Equal(stats{}))
+
+	// buckets are reused after MaxWindowSec
+	now = now.Add(MaxWindowSec * time.Second)
+	tr.record(report("bookstore", 1, "2xx", 0.010))
+	g.Expect(tr.window("bookstore", MaxWindowSec).requests).To(g.Equal(int64(1)))
+
+	// idle services are swept
+	g.Expect(tr.services).To(g.HaveLen(1))
+	g.Expect(tr.window("library", MaxWindowSec)).To(g.Equal(stats{}))
+}
+
+func TestShedOnErrorRate(t *testing.T) {
+	g.RegisterTestingT(t)
+	now := time.Unix(1475272937, 0)
+	shed := 0.4
+	cfg := new(builder).ConfigStruct().(*Config)
+	cfg.MaxErrorRate = 0.05
+	cfg.HighPriority = []string{"project:internal-*"}
+	g.Expect(new(builder).ValidateConfig(cfg)).To(g.Succeed())
+	chk := &checker{cfg: cfg, tracker: testTracker(&now), random: func() float64 { return shed }}
+
+	chk.tracker.record(report("bookstore", 50, ServerErrorClass, 0.010))
+	g.Expect(check(chk, "bookstore", "api_key:aaaa")).To(g.BeNil(), "too few requests to decide")
+
+	chk.tracker.record(report("bookstore", 100, "2xx", 0.010))
+	g.Expect(check(chk, "bookstore", "api_key:aaaa")).To(g.Equal(LoadSheddingCheckError))
+	g.Expect(check(chk, "library", "api_key:aaaa")).To(g.BeNil(), "other services are not affected")
+	g.Expect(check(chk, "bookstore", "project:internal-tools")).To(g.BeNil(), "high priority consumer")
+
+	shed = 0.6
+	g.Expect(check(chk, "bookstore", "api_key:aaaa")).To(g.BeNil(), "only ShedFraction of traffic is shed")
+
+	shed = 0.4
+	now = now.Add(time.Duration(cfg.WindowSec) * time.Second)
+	chk.tracker.record(report("bookstore", 200, "2xx", 0.010))
+	g.Expect(check(chk, "bookstore", "api_key:aaaa")).To(g.BeNil(), "recovered once errors leave the window")
+}
+
+func TestShedOnLatency(t *testing.T) {
+	g.RegisterTestingT(t)
+	now := time.Unix(1475272937, 0)
+	cfg := new(builder).ConfigStruct().(*Config)
+	cfg.MaxBackendLatencyMs = 200
+	cfg.LowPriority = []string{"api_key:free-*"}
+	cfg.ShedFraction = 1
+	g.Expect(new(builder).ValidateConfig(cfg)).To(g.Succeed())
+	chk := &checker{cfg: cfg, tracker: testTracker(&now), random: rand.Float64}
+
+	chk.tracker.record(report("bookstore", 100, "2xx", 0.150))
+	g.Expect(check(chk, "bookstore", "api_key:free-1")).To(g.BeNil())
+
+	chk.tracker.record(report("bookstore", 100, "2xx", 0.350))
+	g.Expect(check(chk, "bookstore", "api_key:free-1")).To(g.Equal(LoadSheddingCheckError))
+	g.Expect(check(chk, "bookstore", "api_key:paid-1")).To(g.BeNil(), "not low priority")
+}
+
+func TestConsumerFeedsChecker(t *testing.T) {
+	g.RegisterTestingT(t)
+	rc, err := new(consumerBuilder).BuildConsumer(mixologist.Config{}, &ConsumerConfig{})
+	g.Expect(err).To(g.BeNil())
+	cfg := new(builder).ConfigStruct().(*Config)
+	cfg.MaxErrorRate = 0.5
+	cfg.ShedFraction = 1
+	c, err := new(builder).BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+
+	// shared package tracker
+	g.Expect(rc.Consume([]*sc.ReportRequest{report("consumer-feeds-checker", 200, ServerErrorClass, 0.010)})).To(g.Succeed())
+	g.Expect(check(c, "consumer-feeds-checker", "api_key:aaaa")).To(g.Equal(LoadSheddingCheckError))
+	g.Expect(mixologist.ReportConsumerRegistry).To(g.HaveKey(Name))
+	g.Expect(mixologist.CheckerRegistry).To(g.HaveKey(Name))
+}
+
+func TestValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	valid := func(mod func(*Config)) *Config {
+		cfg := b.ConfigStruct().(*Config)
+		cfg.MaxErrorRate = 0.1
+		mod(cfg)
+		return cfg
+	}
+	g.Expect(b.ValidateConfig(valid(func(*Config) {}))).To(g.Succeed())
+	for _, cfg := range []*Config{
+		valid(func(c *Config) { c.MaxErrorRate = 0 }),
+		valid(func(c *Config) { c.MaxErrorRate = 1.5 }),
+		valid(func(c *Config) { c.MaxBackendLatencyMs = -1 }),
+		valid(func(c *Config) { c.WindowSec = 0 }),
+		valid(func(c *Config) { c.WindowSec = MaxWindowSec + 1 }),
+		valid(func(c *Config) { c.ShedFraction = 0 }),
+		valid(func(c *Config) { c.MinRequests = -1 }),
+	} {
+		g.Expect(b.ValidateConfig(cfg)).NotTo(g.Succeed(), "%#v", cfg)
+	}
+}
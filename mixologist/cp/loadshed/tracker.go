@@ -0,0 +1,144 @@
+package loadshed
+
+import (
+	sc "google/api/servicecontrol/v1"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+)
+
+func newTracker() *tracker {
+	return &tracker{
+		services: make(map[string]*[MaxWindowSec]bucket),
+		now:      time.Now,
+	}
+}
+
+// current -- bucket of the current second for service
+// must be called with t.lock held
+func (t *tracker) current(service string) *bucket {
+	buckets, found := t.services[service]
+	if !found {
+		buckets = &[MaxWindowSec]bucket{}
+		t.services[service] = buckets
+	}
+	sec := t.now().Unix()
+	b := &buckets[sec%MaxWindowSec]
+	if b.sec != sec {
+		*b = bucket{sec: sec}
+	}
+	return b
+}
+
+// sweep -- drop services without reports in MaxWindowSec, at most once per MaxWindowSec
+// must be called with t.lock held
+func (t *tracker) sweep(sec int64) {
+	if sec-t.swept < MaxWindowSec {
+		return
+	}
+	t.swept = sec
+	for service, buckets := range t.services {
+		idle := true
+		for i := range buckets {
+			if buckets[i].sec > sec-MaxWindowSec {
+				idle = false
+				break
+			}
+		}
+		if idle {
+			delete(t.services, service)
+		}
+	}
+}
+
+// record -- add request counts, 5xx counts and backend latencies of the report
+func (t *tracker) record(rr *sc.ReportRequest) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.sweep(t.now().Unix())
+	var b *bucket
+	for _, op := range rr.GetOperations() {
+		for _, mvs := range op.GetMetricValueSets() {
+			for _, mv := range mvs.GetMetricValues() {
+				if b == nil {
+					b = t.current(rr.ServiceName)
+				}
+				switch mvs.MetricName {
+				case mixologist.ProducerRequestCount:
+					n := mv.GetInt64Value()
+					b.requests += n
+					if mixologist.MetricLabel(mv, op, mixologist.ResponseCodeClass) == ServerErrorClass {
+						b.errors += n
+					}
+				case mixologist.ProducerBackendLatencies:
+					if d := mv.GetDistributionValue(); d != nil && d.Count > 0 {
+						b.latencySum += d.Mean * float64(d.Count)
+						b.latencyCount += d.Count
+					}
+				}
+			}
+		}
+	}
+}
+
+// window -- signals of service over the last windowSec seconds
+func (t *tracker) window(service string, windowSec int) stats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var s stats
+	buckets, found := t.services[service]
+	if !found {
+		return s
+	}
+	var latencySum float64
+	var latencyCount int64
+	oldest := t.now().Unix() - int64(windowSec)
+	for i := range buckets {
+		b := &buckets[i]
+		if b.sec <= oldest {
+			continue
+		}
+		s.requests += b.requests
+		s.errors += b.errors
+		latencySum += b.latencySum
+		latencyCount += b.latencyCount
+	}
+	if latencyCount > 0 {
+		// latencies are reported in seconds
+		s.latencyMs = latencySum / float64(latencyCount) * 1000
+	}
+	return s
+}
+
+// GetName -- ReportConsumer#GetName
+func (c *consumer) GetName() string {
+	return Name
+}
+
+// Consume -- ReportConsumer#Consume
+func (c *consumer) Consume(reqs []*sc.ReportRequest) error {
+	for _, rr := range reqs {
+		c.tracker.record(rr)
+	}
+	return nil
+}
+
+// GetPrefixAndHandler -- ReportConsumer#GetPrefixAndHandler
+func (c *consumer) GetPrefixAndHandler() *mixologist.PrefixAndHandler {
+	return nil
+}
+
+// BuildConsumer -- ReportConsumerBuilder#BuildConsumer
+func (b *consumerBuilder) BuildConsumer(c mixologist.Config, cfg interface{}) (mixologist.ReportConsumer, error) {
+	return &consumer{tracker: signals}, nil
+}
+
+// ConfigStruct -- return pointer to ConsumerConfig struct
+func (b *consumerBuilder) ConfigStruct() interface{} {
+	return &ConsumerConfig{}
+}
+
+// ValidateConfig -- nothing to validate
+func (b *consumerBuilder) ValidateConfig(cfg interface{}) error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package loadshed
+
+import (
+	sc "google/api/servicecontrol/v1"
+	"sync"
+	"time"
+)
+
+const (
+	// Name -- name of this provider. It registers a checker and a report consumer;
+	// without the consumer no signals are recorded and nothing is shed.
+	Name = "loadshed"
+	// MaxWindowSec -- longest window signals are kept for
+	MaxWindowSec = 600
+	// ServerErrorClass -- ResponseCodeClass of server errors
+	ServerErrorClass = "5xx"
+
+	// DefaultWindowSec -- window of the rolling view
+	DefaultWindowSec = 60
+	// DefaultMinRequests -- signals of windows with fewer requests are ignored
+	DefaultMinRequests = 100
+	// DefaultShedFraction -- fraction of low priority traffic rejected while shedding
+	DefaultShedFraction = 0.5
+	// LoadSheddingErrorMsg -- error msg while rejecting
+	LoadSheddingErrorMsg = "Service overloaded, request shed"
+)
+
+type (
+	builder struct{}
+
+	checker struct {
+		cfg     *Config
+		tracker *tracker
+		random  func() float64
+	}
+
+	consumerBuilder struct{}
+
+	// consumer -- feeds reports to the tracker
+	consumer struct {
+		tracker *tracker
+	}
+
+	// ConsumerConfig -- the report consumer has no params
+	ConsumerConfig struct{}
+
+	// Config -- struct needed to configure this checker
+	// At least one of MaxBackendLatencyMs or MaxErrorRate must be set
+	Config struct {
+		// WindowSec -- window of the rolling view, at most MaxWindowSec
+		WindowSec int `yaml:"windowsec"`
+		// MinRequests -- signals of windows with fewer requests are ignored
+		MinRequests int64 `yaml:"minrequests"`
+		// MaxBackendLatencyMs -- shed when the mean backend latency exceeds this, 0 disables
+		MaxBackendLatencyMs float64 `yaml:"maxbackendlatencyms"`
+		// MaxErrorRate -- shed when the fraction of 5xx responses exceeds this, 0 disables
+		MaxErrorRate float64 `yaml:"maxerrorrate"`
+		// ShedFraction -- fraction of low priority traffic rejected while shedding
+		ShedFraction float64 `yaml:"shedfraction"`
+		// LowPriority -- consumer ids that may be shed, a trailing * matches a prefix.
+		// If empty every consumer not in HighPriority may be shed
+		LowPriority []string `yaml:"lowpriority"`
+		// HighPriority -- consumer ids that are never shed, a trailing * matches a prefix
+		HighPriority []string `yaml:"highpriority"`
+	}
+
+	// bucket -- signals of one second
+	bucket struct {
+		sec          int64
+		requests     int64
+		errors       int64
+		latencySum   float64
+		latencyCount int64
+	}
+
+	// stats -- signals of a window
+	stats struct {
+		requests  int64
+		errors    int64
+		latencyMs float64
+	}
+
+	// tracker -- rolling per service signals derived from reports
+	tracker struct {
+		lock     sync.Mutex
+		services map[string]*[MaxWindowSec]bucket
+		swept    int64
+		now      func() time.Time
+	}
+)
+
+var (
+	// signals -- per service windows, fed by every loadshed consumer and read by every loadshed checker
+	signals = newTracker()
+
+	// LoadSheddingCheckError -- predefined val for returning an error
+	LoadSheddingCheckError = &sc.CheckError{
+		Code:   sc.CheckError_LOAD_SHEDDING,
+		Detail: LoadSheddingErrorMsg,
+	}
+)
@@ -0,0 +1,455 @@
+package policy
+
+import (
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression grammar
+//
+//	expr       := and { ("or" | "||") and }
+//	and        := unary { ("and" | "&&") unary }
+//	unary      := ("not" | "!") unary | "(" expr ")" | "true" | "false" | comparison
+//	comparison := operand ( cmp operand
+//	                      | ["not"] "in" list
+//	                      | ("matches" | "=~") string
+//	                      | "in_cidr" (string | list) )
+//	cmp        := "==" | "!=" | "<" | "<=" | ">" | ">="
+//	operand    := field | "labels" "[" string "]" | string | number
+//	field      := "service_name" | "operation_id" | "operation_name" | "consumer_id"
+//	list       := "[" [ literal { "," literal } ] "]"
+//
+// Strings are single or double quoted. Only \\ and the quote are escapes, so regular
+// expressions such as "^api_key:\d+$" read as written. A missing label is the empty string.
+// Ordering comparisons are numeric if both sides are numbers.
+
+const (
+	tEOF = iota
+	tIdent
+	tString
+	tNumber
+	tPunct
+)
+
+type (
+	token struct {
+		kind int
+		text string
+		pos  int
+	}
+
+	// node -- compiled boolean expression
+	node interface {
+		eval(cr *sc.CheckRequest) bool
+	}
+
+	// operand -- a field, a label or a literal
+	operand struct {
+		field   string
+		label   string
+		literal string
+		isField bool
+	}
+
+	constNode bool
+	notNode   struct{ n node }
+	andNode   struct{ l, r node }
+	orNode    struct{ l, r node }
+	cmpNode   struct {
+		op   string
+		l, r *operand
+	}
+	inNode struct {
+		o   *operand
+		set map[string]bool
+	}
+	matchNode struct {
+		o  *operand
+		re *regexp.Regexp
+	}
+	cidrNode struct {
+		o    *operand
+		nets []*net.IPNet
+	}
+
+	parser struct {
+		src  string
+		toks []token
+		i    int
+	}
+)
+
+var (
+	fields = map[string]func(*sc.CheckRequest, *sc.Operation) string{
+		"service_name":   func(cr *sc.CheckRequest, op *sc.Operation) string { return cr.ServiceName },
+		"operation_id":   func(cr *sc.CheckRequest, op *sc.Operation) string { return op.OperationId },
+		"operation_name": func(cr *sc.CheckRequest, op *sc.Operation) string { return op.OperationName },
+		"consumer_id":    func(cr *sc.CheckRequest, op *sc.Operation) string { return op.ConsumerId },
+	}
+	puncts = []string{"==", "!=", "<=", ">=", "=~", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","}
+)
+
+// compile -- parse src into an expression tree
+func compile(src string) (node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return n, nil
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s at %d", err, i)
+			}
+			toks = append(toks, token{tString, s, i})
+			i += n
+		case c == '-' || unicode.IsDigit(c):
+			j := i + 1
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			if _, err := strconv.ParseFloat(src[i:j], 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", src[i:j], i)
+			}
+			toks = append(toks, token{tNumber, src[i:j], i})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, token{tIdent, src[i:j], i})
+			i = j
+		default:
+			found := false
+			for _, p := range puncts {
+				if strings.HasPrefix(src[i:], p) {
+					toks = append(toks, token{tPunct, p, i})
+					i += len(p)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+		}
+	}
+	return append(toks, token{tEOF, "end of expression", len(src)}), nil
+}
+
+// lexString -- unquote the string at the start of src, returns the consumed length
+func lexString(src string) (string, int, error) {
+	quote := src[0]
+	var sb []byte
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case quote:
+			return string(sb), i + 1, nil
+		case '\\':
+			// other escapes are kept for regular expressions
+			if i+1 < len(src) && (src[i+1] == quote || src[i+1] == '\\') {
+				i++
+			}
+		}
+		sb = append(sb, src[i])
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept -- consume the next token if it is one of texts
+func (p *parser) accept(texts ...string) bool {
+	t := p.peek()
+	if t.kind != tIdent && t.kind != tPunct {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.i++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return p.errorf(t, "expected %q, found %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("%s at %d", fmt.Sprintf(format, args...), t.pos)
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	for err == nil && p.accept("or", "||") {
+		var r node
+		if r, err = p.parseAnd(); err == nil {
+			l = &orNode{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseUnary()
+	for err == nil && p.accept("and", "&&") {
+		var r node
+		if r, err = p.parseUnary(); err == nil {
+			l = &andNode{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch {
+	case p.accept("not", "!"):
+		n, err := p.parseUnary()
+		return &notNode{n}, err
+	case p.accept("("):
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case p.accept("true"):
+		return constNode(true), nil
+	case p.accept("false"):
+		return constNode(false), nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if t.kind != tIdent && t.kind != tPunct {
+		return nil, p.errorf(t, "expected operator, found %q", t.text)
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		r, err := p.parseOperand()
+		return &cmpNode{op: t.text, l: l, r: r}, err
+	case "in":
+		set, err := p.parseList()
+		return &inNode{l, set}, err
+	case "not":
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		set, err := p.parseList()
+		return &notNode{&inNode{l, set}}, err
+	case "matches", "=~":
+		s := p.next()
+		if s.kind != tString {
+			return nil, p.errorf(s, "expected regular expression string, found %q", s.text)
+		}
+		re, err := regexp.Compile(s.text)
+		if err != nil {
+			return nil, p.errorf(s, "%s", err)
+		}
+		return &matchNode{l, re}, nil
+	case "in_cidr":
+		return p.parseCIDRs(l)
+	}
+	return nil, p.errorf(t, "expected operator, found %q", t.text)
+}
+
+func (p *parser) parseOperand() (*operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tString, tNumber:
+		return &operand{literal: t.text}, nil
+	case tIdent:
+		if t.text == "labels" {
+			if err := p.expect("["); err != nil {
+				return nil, err
+			}
+			s := p.next()
+			if s.kind != tString {
+				return nil, p.errorf(s, "expected label name string, found %q", s.text)
+			}
+			return &operand{label: s.text, isField: true}, p.expect("]")
+		}
+		if _, found := fields[t.text]; found {
+			return &operand{field: t.text, isField: true}, nil
+		}
+		return nil, p.errorf(t, "unknown field %q", t.text)
+	}
+	return nil, p.errorf(t, "expected field or literal, found %q", t.text)
+}
+
+// parseLiterals -- a list of literals or a single string
+func (p *parser) parseLiterals() ([]token, error) {
+	if t := p.peek(); t.kind == tString {
+		return []token{p.next()}, nil
+	}
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	var lits []token
+	for !p.accept("]") {
+		if len(lits) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		t := p.next()
+		if t.kind != tString && t.kind != tNumber {
+			return nil, p.errorf(t, "expected literal, found %q", t.text)
+		}
+		lits = append(lits, t)
+	}
+	return lits, nil
+}
+
+func (p *parser) parseList() (map[string]bool, error) {
+	if t := p.peek(); t.text != "[" {
+		return nil, p.errorf(t, "expected list, found %q", t.text)
+	}
+	lits, err := p.parseLiterals()
+	set := make(map[string]bool, len(lits))
+	for _, t := range lits {
+		set[t.text] = true
+	}
+	return set, err
+}
+
+func (p *parser) parseCIDRs(o *operand) (node, error) {
+	lits, err := p.parseLiterals()
+	if err != nil {
+		return nil, err
+	}
+	n := &cidrNode{o: o}
+	for _, t := range lits {
+		cidr := t.text
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() == nil {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, p.errorf(t, "%s", err)
+		}
+		n.nets = append(n.nets, ipnet)
+	}
+	return n, nil
+}
+
+func (o *operand) value(cr *sc.CheckRequest) string {
+	if !o.isField {
+		return o.literal
+	}
+	op := cr.GetOperation()
+	if op == nil {
+		op = &sc.Operation{}
+	}
+	if o.field != "" {
+		return fields[o.field](cr, op)
+	}
+	return op.Labels[o.label]
+}
+
+func (n constNode) eval(cr *sc.CheckRequest) bool { return bool(n) }
+func (n *notNode) eval(cr *sc.CheckRequest) bool  { return !n.n.eval(cr) }
+func (n *andNode) eval(cr *sc.CheckRequest) bool  { return n.l.eval(cr) && n.r.eval(cr) }
+func (n *orNode) eval(cr *sc.CheckRequest) bool   { return n.l.eval(cr) || n.r.eval(cr) }
+
+func (n *inNode) eval(cr *sc.CheckRequest) bool {
+	return n.set[n.o.value(cr)]
+}
+
+func (n *matchNode) eval(cr *sc.CheckRequest) bool {
+	return n.re.MatchString(n.o.value(cr))
+}
+
+func (n *cidrNode) eval(cr *sc.CheckRequest) bool {
+	ip := net.ParseIP(n.o.value(cr))
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range n.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare -- numerically if both are numbers, lexically otherwise
+func compare(l string, r string) int {
+	lf, lerr := strconv.ParseFloat(l, 64)
+	rf, rerr := strconv.ParseFloat(r, 64)
+	switch {
+	case lerr != nil || rerr != nil:
+		return strings.Compare(l, r)
+	case lf < rf:
+		return -1
+	case lf > rf:
+		return 1
+	}
+	return 0
+}
+
+func (n *cmpNode) eval(cr *sc.CheckRequest) bool {
+	l, r := n.l.value(cr), n.r.value(cr)
+	switch n.op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return compare(l, r) < 0
+	case "<=":
+		return compare(l, r) <= 0
+	case ">":
+		return compare(l, r) > 0
+	}
+	return compare(l, r) >= 0
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"testing"
+
+	g "github.com/onsi/gomega"
+	sc "google/api/servicecontrol/v1"
+)
+
+const callerIP = "servicecontrol.googleapis.com/caller_ip"
+
+func request() *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: "bookstore",
+		Operation: &sc.Operation{
+			OperationId:   "c37d4302",
+			OperationName: "DeleteShelf",
+			ConsumerId:    "api_key:aaaa",
+			Labels: map[string]string{
+				callerIP: "10.128.0.2",
+				"servicecontrol.googleapis.com/user_agent": "ESP",
+				"x-shard": "12",
+			},
+		},
+	}
+}
+
+func TestEval(t *testing.T) {
+	g.RegisterTestingT(t)
+	for _, tc := range []struct {
+		expr   string
+		result bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`operation_name == "DeleteShelf"`, true},
+		{`operation_name != 'DeleteShelf'`, false},
+		{`service_name == "bookstore" and operation_id == "c37d4302"`, true},
+		{`operation_name == "DeleteShelf" and consumer_id not in ["api_key:bbbb", "api_key:cccc"]`, true},
+		{`operation_name == "DeleteShelf" && consumer_id in ["api_key:aaaa"]`, true},
+		{`not consumer_id in ["api_key:aaaa"]`, false},
+		{`!(operation_name == "ListShelves" || operation_name == "GetShelf")`, true},
+		{`false or true and false`, false},
+		{`(false or true) and true`, true},
+		{`operation_name matches "^Delete"`, true},
+		{`operation_name =~ "^List"`, false},
+		{`labels["servicecontrol.googleapis.com/user_agent"] matches "(?i)^esp"`, true},
+		{`labels["` + callerIP + `"] in_cidr "10.0.0.0/8"`, true},
+		{`labels["` + callerIP + `"] in_cidr ["192.168.0.0/16", "10.128.0.2"]`, true},
+		{`labels["` + callerIP + `"] in_cidr ["2001:db8::/32"]`, false},
+		{`labels["missing"] in_cidr "0.0.0.0/0"`, false},
+		{`labels["missing"] == ""`, true},
+		{`labels["x-shard"] > 9`, true},
+		{`labels["x-shard"] <= 12.0`, true},
+		{`labels["x-shard"] < "9"`, false},
+		{`operation_name >= "Delete"`, true},
+		{`"DeleteShelf" == operation_name`, true},
+		{`operation_name == "Delete\"Shelf"`, false},
+		{`consumer_id matches "^api_key:\w+$"`, true},
+		{`consumer_id matches '^api_key:\d+$'`, false},
+		{`labels["` + callerIP + `"] matches "^10\.128\.0\.\d$"`, true},
+		{`labels["` + callerIP + `"] matches "^10\.128\.0\.\D$"`, false},
+		{`"a\\b" == 'a\b'`, true},
+	} {
+		n, err := compile(tc.expr)
+		g.Expect(err).To(g.BeNil(), tc.expr)
+		g.Expect(n.eval(request())).To(g.Equal(tc.result), tc.expr)
+	}
+}
+
+func TestEvalEmptyRequest(t *testing.T) {
+	g.RegisterTestingT(t)
+	n, err := compile(`consumer_id == "" and labels["` + callerIP + `"] == ""`)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(n.eval(&sc.CheckRequest{})).To(g.BeTrue())
+}
+
+func TestCompileErrors(t *testing.T) {
+	g.RegisterTestingT(t)
+	for _, tc := range []struct {
+		expr string
+		err  string
+	}{
+		{``, "expected field or literal"},
+		{`operation_name`, "expected operator"},
+		{`consumer_id "==" "x"`, "expected operator"},
+		{`consumer_id "in" ["x"]`, "expected operator"},
+		{`operation == "x"`, `unknown field "operation"`},
+		{`operation_name = "x"`, "unexpected character"},
+		{`operation_name == "x`, "unterminated string"},
+		{`operation_name == "x" and`, "expected field or literal"},
+		{`operation_name == "x" operation_name`, "unexpected"},
+		{`(operation_name == "x"`, `expected ")"`},
+		{`consumer_id in "x"`, "expected list"},
+		{`consumer_id in ["x" "y"]`, `expected ","`},
+		{`consumer_id not ["x"]`, `expected "in"`},
+		{`consumer_id matches "("`, "error parsing regexp"},
+		{`consumer_id matches 5`, "expected regular expression string"},
+		{`labels["` + callerIP + `"] in_cidr ["10.0.0.0/33"]`, "invalid CIDR"},
+		{`labels[ip] == ""`, "expected label name string"},
+		{`labels["ip" == ""`, `expected "]"`},
+		{`labels["x-shard"] > 1.2.3`, "invalid number"},
+	} {
+		_, err := compile(tc.expr)
+		g.Expect(err).NotTo(g.BeNil(), tc.expr)
+		g.Expect(err.Error()).To(g.ContainSubstring(tc.err), tc.expr)
+	}
+}
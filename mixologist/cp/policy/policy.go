@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/cloudendpoints/mixologist/mixologist/cp/block"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+func (c *checker) Unload() {}
+
+// Check -- evaluate the compiled expression
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	if c.expr.eval(cr) == c.allow {
+		return nil, nil
+	}
+	glog.V(1).Infof("%s %s blocked by policy", cr.ServiceName, cr.GetOperation())
+	return c.ce, nil
+}
+
+// build -- compile Config into a checker
+func build(cfg *Config) (*checker, error) {
+	deny, err := block.ParseMode(cfg.Mode, DefaultMode)
+	if err != nil {
+		return nil, err
+	}
+	code, err := block.ParseCode(cfg.Code)
+	if err != nil {
+		return nil, err
+	}
+	chk := &checker{
+		allow: !deny,
+		ce:    block.NewCheckError(code, cfg.Message),
+	}
+	if chk.expr, err = compile(cfg.Expression); err != nil {
+		return nil, fmt.Errorf("expression %q: %s", cfg.Expression, err)
+	}
+	return chk, nil
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	chk, err := build(cfg.(*Config))
+	if err != nil {
+		return nil, err
+	}
+	return chk, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		Mode:    DefaultMode,
+		Code:    DefaultCode,
+		Message: DefaultMessage,
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	_, err := build(cfg.(*Config))
+	return err
+}
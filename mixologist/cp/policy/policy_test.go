@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"testing"
+
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+)
+
+func buildChecker(cfg *Config) *checker {
+	b := new(builder)
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	return c.(*checker)
+}
+
+func TestCheck(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	cfg := b.ConfigStruct().(*Config)
+	cfg.Expression = `operation_name == "DeleteShelf" and consumer_id not in ["api_key:bbbb"]`
+	chk := buildChecker(cfg)
+
+	ce, err := chk.Check(context.Background(), request())
+	g.Expect(err).To(g.BeNil())
+	g.Expect(ce).To(g.Equal(&sc.CheckError{Code: sc.CheckError_PERMISSION_DENIED, Detail: DefaultMessage}))
+
+	cr := request()
+	cr.Operation.ConsumerId = "api_key:bbbb"
+	ce, _ = chk.Check(context.Background(), cr)
+	g.Expect(ce).To(g.BeNil())
+
+	// allow mode blocks requests not matching the expression
+	cfg.Mode = ModeAllow
+	cfg.Code = "IP_ADDRESS_BLOCKED"
+	cfg.Message = "internal only"
+	cfg.Expression = `labels["` + callerIP + `"] in_cidr "10.0.0.0/8"`
+	chk = buildChecker(cfg)
+	ce, _ = chk.Check(context.Background(), request())
+	g.Expect(ce).To(g.BeNil())
+	cr.Operation.Labels[callerIP] = "8.8.8.8"
+	ce, _ = chk.Check(context.Background(), cr)
+	g.Expect(ce).To(g.Equal(&sc.CheckError{Code: sc.CheckError_IP_ADDRESS_BLOCKED, Detail: "internal only"}))
+
+	// an empty mode is DefaultMode, deny
+	cfg.Mode = ""
+	chk = buildChecker(cfg)
+	ce, _ = chk.Check(context.Background(), request())
+	g.Expect(ce).NotTo(g.BeNil())
+}
+
+func TestValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	for _, cfg := range []*Config{
+		{Expression: "true", Code: "BOGUS"},
+		{Expression: "true", Code: DefaultCode, Mode: "block"},
+		{Expression: "operation_name ==", Code: DefaultCode},
+	} {
+		g.Expect(b.ValidateConfig(cfg)).NotTo(g.Succeed(), "%#v", cfg)
+		_, err := b.BuildChecker(cfg)
+		g.Expect(err).NotTo(g.BeNil())
+	}
+}
@@ -0,0 +1,47 @@
+package policy
+
+import (
+	sc "google/api/servicecontrol/v1"
+
+	"github.com/cloudendpoints/mixologist/mixologist/cp/block"
+)
+
+const (
+	// Name -- name of this provider.
+	Name = "policy"
+
+	// ModeDeny -- requests are blocked when the expression is true
+	ModeDeny = block.ModeDeny
+	// ModeAllow -- requests are blocked when the expression is false
+	ModeAllow = block.ModeAllow
+	// DefaultMode -- a policy expression describes what is denied
+	DefaultMode = ModeDeny
+
+	// DefaultCode -- CheckError code returned when blocked
+	DefaultCode = "PERMISSION_DENIED"
+	// DefaultMessage -- detail of the CheckError returned when blocked
+	DefaultMessage = "Access denied by policy"
+)
+
+type (
+	builder struct{}
+
+	checker struct {
+		expr  node
+		allow bool
+		ce    *sc.CheckError
+	}
+
+	// Config -- struct needed to configure this checker
+	Config struct {
+		// Expression -- boolean expression over the CheckRequest, see expr.go for the grammar
+		// ex: operation_name == "DeleteShelf" and consumer_id not in ["api_key:aaaa"]
+		Expression string `yaml:"expression" required:"true"`
+		// Mode -- deny or allow requests matching the expression. default: DefaultMode, deny
+		Mode string `yaml:"mode"`
+		// Code -- name of the CheckError code returned when blocked
+		Code string `yaml:"code"`
+		// Message -- detail of the CheckError returned when blocked
+		Message string `yaml:"message"`
+	}
+)
@@ -0,0 +1,305 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// maxSweepInterval -- upper bound on the time between sweeps of idle buckets
+const maxSweepInterval = time.Minute
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+// Unload -- stop syncing, give reserved tokens back and release the store
+func (c *checker) Unload() {
+	if c.store == nil {
+		return
+	}
+	close(c.closing)
+	for _, l := range c.limiters {
+		l.shared.sync(context.Background(), c.now(), 0)
+	}
+	c.store.Close()
+}
+
+// syncLoop -- return idle reserved tokens to the store
+func (c *checker) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, l := range c.limiters {
+				l.shared.sync(context.Background(), c.now(), l.shared.idle)
+			}
+		case <-c.closing:
+			return
+		}
+	}
+}
+
+// period -- parse Limit.Period
+func period(p string) (time.Duration, error) {
+	if d, found := periods[p]; found {
+		return d, nil
+	}
+	d, err := time.ParseDuration(p)
+	if err == nil && d <= 0 {
+		err = errors.New("period must be positive")
+	}
+	return d, err
+}
+
+func newLimiter(l Limit, store Store, scfg StoreConfig) *limiter {
+	d, _ := period(l.Period)
+	if l.Burst <= 0 {
+		l.Burst = l.Rate
+	}
+	if len(l.KeyBy) == 0 {
+		l.KeyBy = []string{KeyConsumerID}
+	}
+	lm := &limiter{
+		Limit:    l,
+		perSec:   float64(l.Rate) / d.Seconds(),
+		capacity: float64(l.Burst),
+		buckets:  make(map[string]*bucket),
+	}
+	if store != nil {
+		lm.shared = newSharedCounter(store, scfg, l, d)
+	}
+	return lm
+}
+
+// key -- bucket key of the request for this limit
+func (l *limiter) key(cr *sc.CheckRequest) (string, error) {
+	op := cr.GetOperation()
+	if op == nil {
+		op = &sc.Operation{}
+	}
+	parts := []string{cr.ServiceName}
+	for _, k := range l.KeyBy {
+		switch {
+		case k == KeyConsumerID:
+			parts = append(parts, op.ConsumerId)
+		case k == KeyAPIMethod:
+			parts = append(parts, op.OperationName)
+		case strings.HasPrefix(k, KeyLimitByPrefix):
+			lt := strings.TrimPrefix(k, KeyLimitByPrefix)
+			id, found := op.GetQuotaProperties().GetLimitByIds()[lt]
+			if !found && lt == LimitTypeUser {
+				id, found = op.GetLabels()[ClientIPKey]
+			}
+			if !found {
+				return "", fmt.Errorf("%s: %s", ErrLimitKeyMissing, lt)
+			}
+			parts = append(parts, id)
+		}
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+// cost -- defaults to 1 unless overridden by
+// a <service_name>/quota/<name>/cost metric value
+func (l *limiter) cost(cr *sc.CheckRequest) float64 {
+	metric := cr.ServiceName + "/quota/" + l.Name + "/cost"
+	for _, mvs := range cr.GetOperation().GetMetricValueSets() {
+		if mvs.MetricName != metric {
+			continue
+		}
+		for _, mv := range mvs.GetMetricValues() {
+			if v, ok := mv.Value.(*sc.MetricValue_Int64Value); ok && v.Int64Value >= 0 {
+				return float64(v.Int64Value)
+			}
+		}
+	}
+	return 1
+}
+
+// refill -- add tokens accrued since b.last
+func (l *limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.capacity, b.tokens+elapsed*l.perSec)
+	}
+	b.last = now
+}
+
+// take -- apply cost to the shared counter or the local bucket of key
+// as specified by mode. returns false if there is not enough quota
+func (l *limiter) take(ctx context.Context, key string, cost float64, mode sc.QuotaProperties_QuotaMode, now time.Time) (bool, error) {
+	if l.shared != nil {
+		return l.shared.take(ctx, key, cost, mode, now)
+	}
+	return l.takeLocal(key, cost, mode, now), nil
+}
+
+// takeLocal -- apply cost to the bucket of key as specified by mode
+// returns false if there is not enough quota
+func (l *limiter) takeLocal(key string, cost float64, mode sc.QuotaProperties_QuotaMode, now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.sweep(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: l.capacity, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	switch mode {
+	case sc.QuotaProperties_RELEASE:
+		b.tokens = math.Min(l.capacity, b.tokens+cost)
+		return true
+	case sc.QuotaProperties_CHECK:
+		return b.tokens >= cost
+	case sc.QuotaProperties_ACQUIRE_BEST_EFFORT:
+		ok := b.tokens >= cost
+		b.tokens = math.Max(0, b.tokens-cost)
+		return ok
+	default:
+		if b.tokens < cost {
+			return false
+		}
+		b.tokens -= cost
+		return true
+	}
+}
+
+// sweep -- drop buckets that are full by now, they are recreated on demand
+// must be called with l.lock held
+func (l *limiter) sweep(now time.Time) {
+	interval := time.Duration(l.capacity / l.perSec * float64(time.Second))
+	if interval > maxSweepInterval {
+		interval = maxSweepInterval
+	}
+	if now.Sub(l.lastSweep) < interval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.perSec >= l.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Check -- enforce all limits, quota acquired from earlier limits
+// is released if a later limit is exceeded
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	mode := sc.QuotaProperties_ACQUIRE
+	if qp := cr.GetOperation().GetQuotaProperties(); qp != nil {
+		mode = qp.QuotaMode
+	}
+	now := c.now()
+	type acquired struct {
+		l    *limiter
+		key  string
+		cost float64
+	}
+	var taken []acquired
+	release := func() {
+		for _, a := range taken {
+			a.l.take(ctx, a.key, a.cost, sc.QuotaProperties_RELEASE, now)
+		}
+	}
+
+	for _, l := range c.limiters {
+		cost := l.cost(cr)
+		// cost 0 causes no quota check
+		if cost == 0 {
+			continue
+		}
+		key, err := l.key(cr)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		ok, err := l.take(ctx, key, cost, mode, now)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if !ok {
+			glog.V(1).Infof("%s quota exceeded for %q", l.Name, key)
+			release()
+			return quotaExceeded(l.Name), nil
+		}
+		if mode == sc.QuotaProperties_ACQUIRE {
+			taken = append(taken, acquired{l, key, cost})
+		}
+	}
+	return nil, nil
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	qcfg := cfg.(*Config)
+	chk := &checker{
+		now:     time.Now,
+		store:   newStore(qcfg.Store),
+		closing: make(chan bool),
+	}
+	for _, l := range qcfg.Limits {
+		chk.limiters = append(chk.limiters, newLimiter(l, chk.store, qcfg.Store))
+	}
+	if chk.store != nil {
+		interval := time.Duration(qcfg.Store.SyncIntervalSec) * time.Second
+		if interval == 0 {
+			interval = DefaultSyncIntervalSec * time.Second
+		}
+		go chk.syncLoop(interval)
+	}
+	return chk, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	qcfg := cfg.(*Config)
+	if len(qcfg.Limits) == 0 {
+		return errors.New("quota: no limits configured")
+	}
+	if err := qcfg.Store.Validate(); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, l := range qcfg.Limits {
+		if l.Name == "" {
+			return errors.New("quota: limit without a name")
+		}
+		if names[l.Name] {
+			return errors.New("quota: duplicate limit " + l.Name)
+		}
+		names[l.Name] = true
+		if l.Rate <= 0 {
+			return errors.New("quota: " + l.Name + " rate must be positive")
+		}
+		if _, err := period(l.Period); err != nil {
+			return errors.New("quota: " + l.Name + " invalid period " + err.Error())
+		}
+		for _, k := range l.KeyBy {
+			if k != KeyConsumerID && k != KeyAPIMethod && !strings.HasPrefix(k, KeyLimitByPrefix) {
+				return errors.New("quota: " + l.Name + " unknown key " + k)
+			}
+		}
+	}
+	return nil
+}
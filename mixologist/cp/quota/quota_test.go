@@ -0,0 +1,215 @@
+package quota
+
+import (
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"testing"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func build(limits ...Limit) (*checker, *clock) {
+	b := new(builder)
+	cfg := &Config{Limits: limits}
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	chk, _ := b.BuildChecker(cfg)
+	clk := &clock{t: time.Unix(1475272937, 0)}
+	chk.(*checker).now = clk.now
+	return chk.(*checker), clk
+}
+
+func request(consumer string, method string) *sc.CheckRequest {
+	return &sc.CheckRequest{
+		ServiceName: "svc",
+		Operation: &sc.Operation{
+			ConsumerId:    consumer,
+			OperationName: method,
+		},
+	}
+}
+
+func check(chk *checker, cr *sc.CheckRequest) *sc.CheckError {
+	ce, err := chk.Check(context.Background(), cr)
+	g.Expect(err).To(g.BeNil())
+	return ce
+}
+
+func TestQuotaRate(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk, clk := build(Limit{Name: "rps", Rate: 2})
+	cr := request("api_key:a", "ListShelves")
+
+	g.Expect(check(chk, cr)).To(g.BeNil())
+	g.Expect(check(chk, cr)).To(g.BeNil())
+	ce := check(chk, cr)
+	g.Expect(ce).NotTo(g.BeNil())
+	g.Expect(ce.Code).To(g.Equal(sc.CheckError_RESOURCE_EXHAUSTED))
+	g.Expect(ce.Detail).To(g.Equal(QuotaExceededErrorMsg + "rps"))
+
+	// other consumers have their own bucket
+	g.Expect(check(chk, request("api_key:b", "ListShelves"))).To(g.BeNil())
+
+	// one token is added every 500ms
+	clk.advance(500 * time.Millisecond)
+	g.Expect(check(chk, cr)).To(g.BeNil())
+	g.Expect(check(chk, cr)).NotTo(g.BeNil())
+}
+
+func TestQuotaPeriodAndBurst(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk, clk := build(Limit{Name: "rpm", Rate: 60, Period: "minute", Burst: 1})
+	cr := request("api_key:a", "ListShelves")
+
+	g.Expect(check(chk, cr)).To(g.BeNil())
+	g.Expect(check(chk, cr)).NotTo(g.BeNil())
+	clk.advance(time.Second)
+	g.Expect(check(chk, cr)).To(g.BeNil())
+}
+
+func TestQuotaKeyBy(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk, _ := build(Limit{Name: "per-method", Rate: 1, KeyBy: []string{KeyAPIMethod}})
+
+	g.Expect(check(chk, request("api_key:a", "ListShelves"))).To(g.BeNil())
+	// same method, different consumer
+	g.Expect(check(chk, request("api_key:b", "ListShelves"))).NotTo(g.BeNil())
+	g.Expect(check(chk, request("api_key:b", "CreateBook"))).To(g.BeNil())
+}
+
+func TestQuotaLimitByIds(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk, _ := build(Limit{Name: "per-user", Rate: 1, KeyBy: []string{KeyLimitByPrefix + LimitTypeUser}})
+
+	cr := request("api_key:a", "ListShelves")
+	cr.Operation.QuotaProperties = &sc.QuotaProperties{
+		LimitByIds: map[string]string{LimitTypeUser: "123"},
+	}
+	g.Expect(check(chk, cr)).To(g.BeNil())
+	g.Expect(check(chk, cr)).NotTo(g.BeNil())
+
+	// USER falls back to caller ip
+	cr = request("api_key:a", "ListShelves")
+	cr.Operation.Labels = map[string]string{ClientIPKey: "10.10.11.2"}
+	g.Expect(check(chk, cr)).To(g.BeNil())
+	g.Expect(check(chk, cr)).NotTo(g.BeNil())
+
+	// unresolved ids are errors
+	_, err := chk.Check(context.Background(), request("api_key:a", "ListShelves"))
+	g.Expect(err).NotTo(g.BeNil())
+}
+
+func TestQuotaModes(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk, _ := build(Limit{Name: "rps", Rate: 2})
+	withMode := func(mode sc.QuotaProperties_QuotaMode, cost int64) *sc.CheckRequest {
+		cr := request("api_key:a", "ListShelves")
+		cr.Operation.QuotaProperties = &sc.QuotaProperties{QuotaMode: mode}
+		cr.Operation.MetricValueSets = []*sc.MetricValueSet{
+			&sc.MetricValueSet{
+				MetricName:   "svc/quota/rps/cost",
+				MetricValues: []*sc.MetricValue{&sc.MetricValue{Value: &sc.MetricValue_Int64Value{Int64Value: cost}}},
+			},
+		}
+		return cr
+	}
+
+	// CHECK does not consume quota
+	g.Expect(check(chk, withMode(sc.QuotaProperties_CHECK, 2))).To(g.BeNil())
+	g.Expect(check(chk, withMode(sc.QuotaProperties_CHECK, 3))).NotTo(g.BeNil())
+	g.Expect(check(chk, withMode(sc.QuotaProperties_ACQUIRE, 2))).To(g.BeNil())
+	g.Expect(check(chk, withMode(sc.QuotaProperties_ACQUIRE, 1))).NotTo(g.BeNil())
+	// cost 0 causes no quota check
+	g.Expect(check(chk, withMode(sc.QuotaProperties_ACQUIRE, 0))).To(g.BeNil())
+
+	// RELEASE returns quota
+	g.Expect(check(chk, withMode(sc.QuotaProperties_RELEASE, 1))).To(g.BeNil())
+	g.Expect(check(chk, withMode(sc.QuotaProperties_ACQUIRE, 1))).To(g.BeNil())
+
+	// ACQUIRE_BEST_EFFORT fails but drains the bucket
+	g.Expect(check(chk, withMode(sc.QuotaProperties_RELEASE, 1))).To(g.BeNil())
+	g.Expect(check(chk, withMode(sc.QuotaProperties_ACQUIRE_BEST_EFFORT, 2))).NotTo(g.BeNil())
+	g.Expect(check(chk, withMode(sc.QuotaProperties_CHECK, 1))).NotTo(g.BeNil())
+}
+
+func TestQuotaMultipleLimitsRelease(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk, _ := build(
+		Limit{Name: "per-consumer", Rate: 10},
+		Limit{Name: "per-method", Rate: 1, KeyBy: []string{KeyAPIMethod}},
+	)
+	g.Expect(check(chk, request("api_key:a", "ListShelves"))).To(g.BeNil())
+	for i := 0; i < 5; i++ {
+		ce := check(chk, request("api_key:a", "ListShelves"))
+		g.Expect(ce).NotTo(g.BeNil())
+		g.Expect(ce.Detail).To(g.Equal(QuotaExceededErrorMsg + "per-method"))
+	}
+	// denied requests did not consume per-consumer quota
+	for i := 0; i < 9; i++ {
+		g.Expect(check(chk, request("api_key:a", fmt.Sprintf("Method%d", i)))).To(g.BeNil())
+	}
+	g.Expect(check(chk, request("api_key:a", "CreateBook"))).NotTo(g.BeNil())
+}
+
+func TestQuotaSweep(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk, clk := build(Limit{Name: "rps", Rate: 1})
+	l := chk.limiters[0]
+	check(chk, request("api_key:a", "ListShelves"))
+	check(chk, request("api_key:b", "ListShelves"))
+	g.Expect(l.buckets).To(g.HaveLen(2))
+
+	clk.advance(2 * time.Second)
+	check(chk, request("api_key:c", "ListShelves"))
+	g.Expect(l.buckets).To(g.HaveLen(1))
+}
+
+func TestQuotaValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	for _, cfg := range []*Config{
+		&Config{},
+		&Config{Limits: []Limit{Limit{Rate: 1}}},
+		&Config{Limits: []Limit{Limit{Name: "a"}}},
+		&Config{Limits: []Limit{Limit{Name: "a", Rate: 1}, Limit{Name: "a", Rate: 1}}},
+		&Config{Limits: []Limit{Limit{Name: "a", Rate: 1, Period: "fortnight"}}},
+		&Config{Limits: []Limit{Limit{Name: "a", Rate: 1, Period: "-1s"}}},
+		&Config{Limits: []Limit{Limit{Name: "a", Rate: 1, KeyBy: []string{"caller_ip"}}}},
+	} {
+		g.Expect(b.ValidateConfig(cfg)).NotTo(g.Succeed(), "%#v", cfg)
+	}
+}
+
+func TestQuotaDecode(t *testing.T) {
+	g.RegisterTestingT(t)
+	var params interface{}
+	g.Expect(yaml.Unmarshal([]byte(`
+limits:
+- name: per-user
+  rate: 100
+  period: day
+  keyby:
+  - consumer_id
+  - limit_by_ids/USER
+`), &params)).To(g.Succeed())
+	cfg := new(builder).ConfigStruct()
+	g.Expect(mixologist.Decode(params, cfg)).To(g.BeNil())
+	g.Expect(cfg).To(g.Equal(&Config{Limits: []Limit{
+		Limit{Name: "per-user", Rate: 100, Period: "day", KeyBy: []string{KeyConsumerID, "limit_by_ids/USER"}},
+	}}))
+}
@@ -0,0 +1,239 @@
+package quota
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// redisTimeout -- upper bound on a round trip to redis
+const redisTimeout = 500 * time.Millisecond
+
+type (
+	// redisStore -- Store backed by a redis server.
+	// Speaks just enough of the redis protocol (RESP) for counters.
+	// Up to poolSize idle connections are kept for reuse
+	redisStore struct {
+		addr     string
+		password string
+		db       int
+		poolSize int
+
+		lock   sync.Mutex
+		idle   []*redisConn
+		closed bool
+	}
+
+	// redisConn -- connection to the redis server
+	redisConn struct {
+		net.Conn
+		rd *bufio.Reader
+	}
+
+	// redisError -- error reply from the server
+	redisError string
+)
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func newRedisStore(addr string, password string, db int, poolSize int) *redisStore {
+	return &redisStore{
+		addr:     addr,
+		password: password,
+		db:       db,
+		poolSize: poolSize,
+	}
+}
+
+// IncrBy -- Store#IncrBy
+func (r *redisStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	replies, err := r.do(ctx,
+		[]string{"INCRBY", key, strconv.FormatInt(delta, 10)},
+		[]string{"PEXPIRE", key, strconv.FormatInt(int64(ttl/time.Millisecond), 10)},
+	)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := replies[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCRBY reply %v", replies[0])
+	}
+	return v, nil
+}
+
+// Close -- Store#Close. Connections in use are closed when they are returned
+func (r *redisStore) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+	var err error
+	for _, conn := range r.idle {
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	r.idle = nil
+	return err
+}
+
+// get -- an idle connection, or a new one if there is none
+func (r *redisStore) get(deadline time.Time) (*redisConn, error) {
+	r.lock.Lock()
+	if n := len(r.idle); n > 0 {
+		conn := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.lock.Unlock()
+		return conn, nil
+	}
+	r.lock.Unlock()
+	return r.dial(deadline)
+}
+
+// put -- keep conn for reuse unless the store is closed or the pool is full
+func (r *redisStore) put(conn *redisConn) {
+	r.lock.Lock()
+	if !r.closed && len(r.idle) < r.poolSize {
+		r.idle = append(r.idle, conn)
+		conn = nil
+	}
+	r.lock.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// dial -- connect, authenticate and select db
+func (r *redisStore) dial(deadline time.Time) (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", r.addr, deadline.Sub(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, rd: bufio.NewReader(nc)}
+	var cmds [][]string
+	if r.password != "" {
+		cmds = append(cmds, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		cmds = append(cmds, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	if len(cmds) == 0 {
+		return conn, nil
+	}
+	if _, err = conn.roundTrip(deadline, cmds...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// do -- pipeline cmds and return one reply per command.
+// The first error reply is returned as error. Round trips are bounded by redisTimeout and ctx
+func (r *redisStore) do(ctx context.Context, cmds ...[]string) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(redisTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn, err := r.get(deadline)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := conn.roundTrip(deadline, cmds...)
+	if _, isReply := err.(redisError); err != nil && !isReply {
+		// the connection is in an unknown state
+		conn.Close()
+		return replies, err
+	}
+	r.put(conn)
+	return replies, err
+}
+
+// roundTrip -- write cmds and read their replies
+func (c *redisConn) roundTrip(deadline time.Time, cmds ...[]string) ([]interface{}, error) {
+	c.SetDeadline(deadline)
+	w := bufio.NewWriter(c.Conn)
+	for _, cmd := range cmds {
+		writeCommand(w, cmd)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	var firstErr error
+	replies := make([]interface{}, len(cmds))
+	for idx := range cmds {
+		reply, err := readReply(c.rd)
+		if err != nil {
+			if _, isReply := err.(redisError); !isReply {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		replies[idx] = reply
+	}
+	return replies, firstErr
+}
+
+// writeCommand -- encode cmd as a RESP array of bulk strings
+func writeCommand(w io.Writer, cmd []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(cmd))
+	for _, arg := range cmd {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply -- decode a RESP reply.
+// returns string, int64, []byte, []interface{} or nil, error replies are returned as redisError
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = readReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	return nil, errors.New("redis: unknown reply type " + line[:1])
+}
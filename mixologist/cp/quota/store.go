@@ -0,0 +1,307 @@
+package quota
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	sc "google/api/servicecontrol/v1"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// StoreMemory -- counters are shared by checkers in this process
+	StoreMemory = "memory"
+	// StoreRedis -- counters are shared by all replicas using the same redis server
+	StoreRedis = "redis"
+
+	// DefaultKeyPrefix -- prefix of all counter keys in the store
+	DefaultKeyPrefix = "mixologist:quota:"
+	// DefaultPreAllocate -- tokens reserved from the store per round trip
+	DefaultPreAllocate = 10
+	// DefaultSyncIntervalSec -- idle reserved tokens are returned to the store this often
+	DefaultSyncIntervalSec = 1
+	// DefaultPoolSize -- idle connections kept open to the redis server
+	DefaultPoolSize = 8
+
+	// memorySweepInterval -- expired counters of the memory store are dropped this often
+	memorySweepInterval = time.Minute
+)
+
+type (
+	// Store -- counters shared by all replicas of mixologist
+	Store interface {
+		// IncrBy -- atomically add delta to the counter of key and return the new value.
+		// The counter expires ttl after the last IncrBy.
+		IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+		// Close -- release resources
+		Close() error
+	}
+
+	// StoreConfig -- configure sharing of quota across replicas
+	// When Kind is not set, token buckets are local to the replica.
+	// Otherwise every limit allows Rate requests per fixed window of Period
+	// across all replicas that share the store.
+	StoreConfig struct {
+		// Kind -- memory or redis
+		Kind string
+		// Addr -- host:port of the redis server
+		Addr string
+		// Password -- optional redis password
+		Password string
+		// DB -- redis database number
+		DB int
+		// KeyPrefix -- default: DefaultKeyPrefix
+		KeyPrefix string
+		// PreAllocate -- tokens reserved per round trip to the store. default: DefaultPreAllocate
+		PreAllocate int
+		// SyncIntervalSec -- reserved tokens that are not used for this long are
+		// returned to the store. default: DefaultSyncIntervalSec
+		SyncIntervalSec int
+		// PoolSize -- idle connections kept open to redis. default: DefaultPoolSize
+		PoolSize int
+	}
+
+	// memoryStore -- in process Store
+	memoryStore struct {
+		lock     sync.Mutex
+		counters map[string]*counter
+		swept    time.Time
+		now      func() time.Time
+	}
+
+	counter struct {
+		value   int64
+		expires time.Time
+	}
+
+	// lease -- tokens of a window reserved from the store
+	lease struct {
+		window int64
+		tokens int64
+		used   time.Time
+	}
+
+	// sharedCounter -- fixed window counters in a Store,
+	// tokens are reserved in chunks to avoid a round trip per Check
+	sharedCounter struct {
+		store    Store
+		prefix   string
+		limit    int64
+		period   time.Duration
+		prealloc int64
+		idle     time.Duration
+
+		lock   sync.Mutex
+		leases map[string]*lease
+	}
+)
+
+// Validate -- ensure kind is known and redis has an address
+func (c StoreConfig) Validate() error {
+	switch c.Kind {
+	case "", StoreMemory:
+	case StoreRedis:
+		if c.Addr == "" {
+			return errors.New("quota: redis store requires addr")
+		}
+	default:
+		return errors.New("quota: unknown store " + c.Kind)
+	}
+	if c.PreAllocate < 0 || c.SyncIntervalSec < 0 || c.PoolSize < 0 {
+		return errors.New("quota: preallocate, syncintervalsec and poolsize must not be negative")
+	}
+	return nil
+}
+
+// memory -- the StoreMemory of this process, keys are prefixed by limit name
+var memory = newMemoryStore()
+
+// newStore -- return the Store configured by c, nil if counters are local
+func newStore(c StoreConfig) Store {
+	switch c.Kind {
+	case StoreMemory:
+		return memory
+	case StoreRedis:
+		poolSize := c.PoolSize
+		if poolSize == 0 {
+			poolSize = DefaultPoolSize
+		}
+		return newRedisStore(c.Addr, c.Password, c.DB, poolSize)
+	}
+	return nil
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		counters: make(map[string]*counter),
+		now:      time.Now,
+	}
+}
+
+// IncrBy -- Store#IncrBy
+func (m *memoryStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := m.now()
+	c, found := m.counters[key]
+	if !found || now.After(c.expires) {
+		c = &counter{}
+		m.counters[key] = c
+	}
+	c.value += delta
+	c.expires = now.Add(ttl)
+	// expired counters are dropped at most once per memorySweepInterval
+	if now.Sub(m.swept) >= memorySweepInterval {
+		m.swept = now
+		for k, v := range m.counters {
+			if now.After(v.expires) {
+				delete(m.counters, k)
+			}
+		}
+	}
+	return c.value, nil
+}
+
+// Close -- Store#Close, counters outlive the checkers using them
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+func newSharedCounter(store Store, c StoreConfig, l Limit, period time.Duration) *sharedCounter {
+	s := &sharedCounter{
+		store:    store,
+		prefix:   c.KeyPrefix,
+		limit:    int64(l.Rate),
+		period:   period,
+		prealloc: int64(c.PreAllocate),
+		idle:     time.Duration(c.SyncIntervalSec) * time.Second,
+		leases:   make(map[string]*lease),
+	}
+	if s.prefix == "" {
+		s.prefix = DefaultKeyPrefix
+	}
+	s.prefix += l.Name + ":"
+	if s.prealloc == 0 {
+		s.prealloc = DefaultPreAllocate
+	}
+	if s.idle == 0 {
+		s.idle = DefaultSyncIntervalSec * time.Second
+	}
+	return s
+}
+
+func (s *sharedCounter) storeKey(key string, window int64) string {
+	return s.prefix + key + ":" + strconv.FormatInt(window, 10)
+}
+
+// reserve -- reserve up to n tokens of window from the store, returns the tokens granted
+func (s *sharedCounter) reserve(ctx context.Context, key string, window int64, n int64) (int64, error) {
+	k := s.storeKey(key, window)
+	v, err := s.store.IncrBy(ctx, k, n, 2*s.period)
+	if err != nil {
+		return 0, err
+	}
+	if over := v - s.limit; over > 0 {
+		if over > n {
+			over = n
+		}
+		// give back what was not granted so that other replicas can use it
+		if _, err := s.store.IncrBy(ctx, k, -over, 2*s.period); err != nil {
+			glog.Warningf("Unable to return %d tokens of %s: %s", over, k, err)
+		}
+		n -= over
+	}
+	return n, nil
+}
+
+// lease -- the lease of key for window
+// must be called with s.lock held
+func (s *sharedCounter) lease(key string, window int64, now time.Time) *lease {
+	l, found := s.leases[key]
+	if !found || l.window != window {
+		l = &lease{window: window}
+		s.leases[key] = l
+	}
+	l.used = now
+	return l
+}
+
+// take -- apply cost to the shared counter of key as specified by mode
+// returns false if there is not enough quota. s.lock is not held during round trips to the store
+func (s *sharedCounter) take(ctx context.Context, key string, fcost float64, mode sc.QuotaProperties_QuotaMode, now time.Time) (bool, error) {
+	cost := int64(math.Ceil(fcost))
+	window := now.UnixNano() / int64(s.period)
+
+	s.lock.Lock()
+	l := s.lease(key, window, now)
+	tokens := l.tokens
+	switch {
+	case mode == sc.QuotaProperties_RELEASE:
+		l.tokens += cost
+		s.lock.Unlock()
+		return true, nil
+	case tokens >= cost:
+		if mode != sc.QuotaProperties_CHECK {
+			l.tokens -= cost
+		}
+		s.lock.Unlock()
+		return true, nil
+	}
+	s.lock.Unlock()
+
+	if mode == sc.QuotaProperties_CHECK {
+		v, err := s.store.IncrBy(ctx, s.storeKey(key, window), 0, 2*s.period)
+		return err == nil && tokens+s.limit-v >= cost, err
+	}
+	n := cost - tokens
+	if n < s.prealloc {
+		n = s.prealloc
+	}
+	granted, err := s.reserve(ctx, key, window, n)
+	if err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// other checks may have used or added tokens in the meantime
+	l = s.lease(key, window, now)
+	l.tokens += granted
+	if l.tokens >= cost {
+		l.tokens -= cost
+		return true, nil
+	}
+	if mode == sc.QuotaProperties_ACQUIRE_BEST_EFFORT {
+		l.tokens = 0
+	}
+	return false, nil
+}
+
+// sync -- return tokens of leases not used for idle, 0 returns every lease
+func (s *sharedCounter) sync(ctx context.Context, now time.Time, idle time.Duration) {
+	window := now.UnixNano() / int64(s.period)
+	unused := make(map[string]*lease)
+	s.lock.Lock()
+	for key, l := range s.leases {
+		if now.Sub(l.used) < idle {
+			continue
+		}
+		delete(s.leases, key)
+		// tokens of past windows expire with the window
+		if l.window == window && l.tokens > 0 {
+			unused[key] = l
+		}
+	}
+	s.lock.Unlock()
+
+	for key, l := range unused {
+		if _, err := s.store.IncrBy(ctx, s.storeKey(key, l.window), -l.tokens, 2*s.period); err != nil {
+			glog.Warningf("Unable to return %d tokens of %s: %s", l.tokens, key, err)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package quota
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sc "google/api/servicecontrol/v1"
+
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+)
+
+// fakeRedis -- in process server that speaks enough RESP for redisStore
+type fakeRedis struct {
+	password string
+	lis      net.Listener
+
+	lock     sync.Mutex
+	counters map[string]int64
+	ttls     map[string]string
+}
+
+func newFakeRedis(password string) *fakeRedis {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).To(g.BeNil())
+	f := &fakeRedis{
+		password: password,
+		lis:      lis,
+		counters: make(map[string]int64),
+		ttls:     make(map[string]string),
+	}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		req, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		var cmd []string
+		for _, arg := range req.([]interface{}) {
+			cmd = append(cmd, string(arg.([]byte)))
+		}
+		f.lock.Lock()
+		switch {
+		case cmd[0] == "AUTH" && cmd[1] == f.password:
+			authed = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case cmd[0] == "AUTH":
+			fmt.Fprint(conn, "-ERR invalid password\r\n")
+		case !authed:
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		case cmd[0] == "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case cmd[0] == "INCRBY":
+			delta, _ := strconv.ParseInt(cmd[2], 10, 64)
+			f.counters[cmd[1]] += delta
+			fmt.Fprintf(conn, ":%d\r\n", f.counters[cmd[1]])
+		case cmd[0] == "PEXPIRE":
+			f.ttls[cmd[1]] = cmd[2]
+			fmt.Fprint(conn, ":1\r\n")
+		case cmd[0] == "QUIT":
+			f.lock.Unlock()
+			return
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", cmd[0])
+		}
+		f.lock.Unlock()
+	}
+}
+
+func (f *fakeRedis) Close() {
+	f.lis.Close()
+}
+
+func testIncrBy(store Store, key string) {
+	v, err := store.IncrBy(context.Background(), key, 3, time.Minute)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(v).To(g.Equal(int64(3)))
+	v, err = store.IncrBy(context.Background(), key, -1, time.Minute)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(v).To(g.Equal(int64(2)))
+	v, err = store.IncrBy(context.Background(), key, 0, time.Minute)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(v).To(g.Equal(int64(2)))
+}
+
+func TestRedisStore(t *testing.T) {
+	g.RegisterTestingT(t)
+	f := newFakeRedis("secret")
+	defer f.Close()
+
+	store := newRedisStore(f.lis.Addr().String(), "secret", 1, 2)
+	defer store.Close()
+	testIncrBy(store, "k")
+	g.Expect(f.ttls["k"]).To(g.Equal("60000"))
+
+	// reconnect after the connection is lost
+	g.Expect(store.idle).To(g.HaveLen(1))
+	store.idle[0].Close()
+	_, err := store.IncrBy(context.Background(), "k", 1, time.Minute)
+	g.Expect(err).NotTo(g.BeNil())
+	v, err := store.IncrBy(context.Background(), "k", 1, time.Minute)
+	g.Expect(err).To(g.BeNil())
+	g.Expect(v).To(g.Equal(int64(3)))
+
+	// round trips run in parallel, the pool keeps at most poolSize connections
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.IncrBy(context.Background(), "k", 1, time.Minute)
+			g.Expect(err).To(g.BeNil())
+		}()
+	}
+	wg.Wait()
+	f.lock.Lock()
+	g.Expect(f.counters["k"]).To(g.Equal(int64(13)))
+	f.lock.Unlock()
+	g.Expect(len(store.idle)).To(g.BeNumerically("<=", 2))
+
+	// error replies
+	bad := newRedisStore(f.lis.Addr().String(), "wrong", 0, 2)
+	defer bad.Close()
+	_, err = bad.IncrBy(context.Background(), "k", 1, time.Minute)
+	g.Expect(err).To(g.BeAssignableToTypeOf(redisError("")))
+	g.Expect(err.Error()).To(g.ContainSubstring("invalid password"))
+}
+
+// TestRedisServer -- run against a local redis-server
+// MIXOLOGIST_REDIS_ADDR=localhost:6379 go test ./mixologist/cp/quota
+func TestRedisServer(t *testing.T) {
+	addr := os.Getenv("MIXOLOGIST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("MIXOLOGIST_REDIS_ADDR not set")
+	}
+	g.RegisterTestingT(t)
+	store := newRedisStore(addr, os.Getenv("MIXOLOGIST_REDIS_PASSWORD"), 0, DefaultPoolSize)
+	defer store.Close()
+	testIncrBy(store, fmt.Sprintf("%stest:%d", DefaultKeyPrefix, time.Now().UnixNano()))
+}
+
+func TestMemoryStore(t *testing.T) {
+	g.RegisterTestingT(t)
+	store := newMemoryStore()
+	clk := &clock{t: time.Unix(1475272937, 0)}
+	store.now = clk.now
+	testIncrBy(store, "k")
+
+	clk.advance(2 * time.Minute)
+	v, _ := store.IncrBy(context.Background(), "k", 1, time.Minute)
+	g.Expect(v).To(g.Equal(int64(1)))
+	store.IncrBy(context.Background(), "other", 1, time.Second)
+	clk.advance(2 * time.Second)
+	store.IncrBy(context.Background(), "new", 1, time.Minute)
+	g.Expect(store.counters).To(g.HaveLen(3), "expired counters are kept until the next sweep")
+
+	clk.advance(memorySweepInterval)
+	store.IncrBy(context.Background(), "new", 1, time.Minute)
+	g.Expect(store.counters).To(g.HaveLen(1))
+}
+
+// replicas -- checkers sharing store
+func replicas(store Store, n int, limit Limit, scfg StoreConfig) ([]*checker, *clock) {
+	clk := &clock{t: time.Unix(1475272920, 0)}
+	var chks []*checker
+	for i := 0; i < n; i++ {
+		chk := &checker{now: clk.now}
+		chk.limiters = []*limiter{newLimiter(limit, store, scfg)}
+		chks = append(chks, chk)
+	}
+	return chks, clk
+}
+
+func TestSharedQuota(t *testing.T) {
+	g.RegisterTestingT(t)
+	store := newMemoryStore()
+	chks, clk := replicas(store, 2, Limit{Name: "rpm", Rate: 10, Period: "minute"}, StoreConfig{Kind: StoreMemory, PreAllocate: 3})
+	store.now = clk.now
+	cr := request("api_key:a", "ListShelves")
+
+	for i := 0; i < 4; i++ {
+		g.Expect(check(chks[0], cr)).To(g.BeNil())
+	}
+	// replica 0 reserved 6 tokens, 4 are left for replica 1
+	for i := 0; i < 4; i++ {
+		g.Expect(check(chks[1], cr)).To(g.BeNil())
+	}
+	g.Expect(check(chks[1], cr)).NotTo(g.BeNil())
+	// replica 0 still has 2 reserved tokens
+	g.Expect(check(chks[0], cr)).To(g.BeNil())
+
+	// idle reserved tokens are returned to the store
+	clk.advance(2 * time.Second)
+	chks[0].limiters[0].shared.sync(context.Background(), clk.now(), chks[0].limiters[0].shared.idle)
+	g.Expect(check(chks[1], cr)).To(g.BeNil())
+	g.Expect(check(chks[1], cr)).NotTo(g.BeNil())
+
+	// a new window starts with the full rate
+	clk.advance(time.Minute)
+	granted := 0
+	for i := 0; i < 20; i++ {
+		if check(chks[i%2], cr) == nil {
+			granted++
+		}
+	}
+	g.Expect(granted).To(g.Equal(10))
+}
+
+func TestUnloadReturnsLeases(t *testing.T) {
+	g.RegisterTestingT(t)
+	store := newMemoryStore()
+	chks, clk := replicas(store, 2, Limit{Name: "rpm", Rate: 10, Period: "minute"}, StoreConfig{Kind: StoreMemory, PreAllocate: 3})
+	store.now = clk.now
+	chks[0].store = store
+	chks[0].closing = make(chan bool)
+	cr := request("api_key:a", "ListShelves")
+
+	g.Expect(check(chks[0], cr)).To(g.BeNil())
+	chks[0].Unload()
+	granted := 0
+	for i := 0; i < 20; i++ {
+		if check(chks[1], cr) == nil {
+			granted++
+		}
+	}
+	g.Expect(granted).To(g.Equal(9), "tokens reserved by the unloaded checker are given back")
+}
+
+func TestSharedQuotaModes(t *testing.T) {
+	g.RegisterTestingT(t)
+	chks, _ := replicas(newMemoryStore(), 1, Limit{Name: "rpm", Rate: 2, Period: "minute"}, StoreConfig{Kind: StoreMemory, PreAllocate: 1})
+	withMode := func(mode sc.QuotaProperties_QuotaMode) *sc.CheckRequest {
+		cr := request("api_key:a", "ListShelves")
+		cr.Operation.QuotaProperties = &sc.QuotaProperties{QuotaMode: mode}
+		return cr
+	}
+	g.Expect(check(chks[0], withMode(sc.QuotaProperties_CHECK))).To(g.BeNil())
+	g.Expect(check(chks[0], withMode(sc.QuotaProperties_ACQUIRE))).To(g.BeNil())
+	g.Expect(check(chks[0], withMode(sc.QuotaProperties_ACQUIRE))).To(g.BeNil())
+	g.Expect(check(chks[0], withMode(sc.QuotaProperties_CHECK))).NotTo(g.BeNil())
+	g.Expect(check(chks[0], withMode(sc.QuotaProperties_RELEASE))).To(g.BeNil())
+	g.Expect(check(chks[0], withMode(sc.QuotaProperties_ACQUIRE))).To(g.BeNil())
+	g.Expect(check(chks[0], withMode(sc.QuotaProperties_ACQUIRE_BEST_EFFORT))).NotTo(g.BeNil())
+}
+
+func TestSharedQuotaStoreDown(t *testing.T) {
+	g.RegisterTestingT(t)
+	f := newFakeRedis("")
+	addr := f.lis.Addr().String()
+	f.Close()
+
+	b := new(builder)
+	cfg := &Config{
+		Limits: []Limit{Limit{Name: "rps", Rate: 1}},
+		Store:  StoreConfig{Kind: StoreRedis, Addr: addr},
+	}
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	chk, _ := b.BuildChecker(cfg)
+	defer chk.Unload()
+	_, err := chk.Check(context.Background(), request("api_key:a", "ListShelves"))
+	g.Expect(err).NotTo(g.BeNil())
+}
+
+func TestMemoryStoreShared(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	// counters outlive the test, the limit name keeps runs apart
+	cfg := &Config{
+		Limits: []Limit{Limit{Name: fmt.Sprintf("rpm-%d", time.Now().UnixNano()), Rate: 3, Period: "minute"}},
+		Store:  StoreConfig{Kind: StoreMemory, PreAllocate: 1},
+	}
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	chk0, _ := b.BuildChecker(cfg)
+	defer chk0.Unload()
+	chk1, _ := b.BuildChecker(cfg)
+	defer chk1.Unload()
+
+	granted := 0
+	for i := 0; i < 6; i++ {
+		if check([]*checker{chk0.(*checker), chk1.(*checker)}[i%2], request("api_key:a", "ListShelves")) == nil {
+			granted++
+		}
+	}
+	g.Expect(granted).To(g.Equal(3), "checkers of this process share the memory store")
+}
+
+// blockingStore -- a Store whose round trips wait for release or ctx
+type blockingStore struct {
+	*memoryStore
+	entered chan string
+	release chan struct{}
+}
+
+func (b *blockingStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	b.entered <- key
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	return b.memoryStore.IncrBy(ctx, key, delta, ttl)
+}
+
+func TestSharedQuotaRoundTrip(t *testing.T) {
+	g.RegisterTestingT(t)
+	store := &blockingStore{memoryStore: newMemoryStore(), entered: make(chan string, 1), release: make(chan struct{})}
+	shared := newSharedCounter(store, StoreConfig{Kind: StoreMemory, PreAllocate: 1}, Limit{Name: "rpm", Rate: 2}, time.Minute)
+	now := time.Unix(1475272920, 0)
+
+	done := make(chan bool, 1)
+	go func() {
+		ok, _ := shared.take(context.Background(), "a", 1, sc.QuotaProperties_ACQUIRE, now)
+		done <- ok
+	}()
+	g.Expect(<-store.entered).To(g.HavePrefix(DefaultKeyPrefix + "rpm:a:"))
+
+	// other keys are not blocked by the round trip
+	ok, err := shared.take(context.Background(), "b", 1, sc.QuotaProperties_RELEASE, now)
+	g.Expect(ok).To(g.BeTrue())
+	g.Expect(err).To(g.BeNil())
+
+	// round trips are bounded by ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = shared.take(ctx, "c", 1, sc.QuotaProperties_ACQUIRE, now)
+	g.Expect(<-store.entered).To(g.HavePrefix(DefaultKeyPrefix + "rpm:c:"))
+	g.Expect(err).To(g.Equal(context.DeadlineExceeded))
+
+	close(store.release)
+	g.Eventually(done).Should(g.Receive(g.BeTrue()))
+}
+
+func TestStoreConfigValidate(t *testing.T) {
+	g.RegisterTestingT(t)
+	g.Expect(StoreConfig{}.Validate()).To(g.Succeed())
+	g.Expect(StoreConfig{Kind: StoreMemory}.Validate()).To(g.Succeed())
+	g.Expect(StoreConfig{Kind: StoreRedis, Addr: "redis:6379"}.Validate()).To(g.Succeed())
+	g.Expect(StoreConfig{Kind: StoreRedis}.Validate()).NotTo(g.Succeed())
+	g.Expect(StoreConfig{Kind: "memcache"}.Validate()).NotTo(g.Succeed())
+	g.Expect(StoreConfig{Kind: StoreMemory, PreAllocate: -1}.Validate()).NotTo(g.Succeed())
+	g.Expect(StoreConfig{Kind: StoreRedis, Addr: "redis:6379", PoolSize: -1}.Validate()).NotTo(g.Succeed())
+	g.Expect(strings.HasPrefix(DefaultKeyPrefix, "mixologist")).To(g.BeTrue())
+}
@@ -0,0 +1,107 @@
+package quota
+
+import (
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"sync"
+	"time"
+)
+
+const (
+	// Name -- name of this provider
+	Name = "quota"
+	// ClientIPKey -- key used by service control to pass thru client ip
+	ClientIPKey = "servicecontrol.googleapis.com/caller_ip"
+
+	// KeyConsumerID -- limit by Operation.ConsumerId
+	KeyConsumerID = "consumer_id"
+	// KeyAPIMethod -- limit by Operation.OperationName
+	KeyAPIMethod = "api_method"
+	// KeyLimitByPrefix -- limit by an entry of QuotaProperties.LimitByIds. ex: limit_by_ids/USER
+	KeyLimitByPrefix = "limit_by_ids/"
+	// LimitTypeUser -- LimitByIds key that falls back to the caller ip
+	LimitTypeUser = "USER"
+
+	// QuotaExceededErrorMsg -- error msg while rejecting
+	QuotaExceededErrorMsg = "Quota exceeded for "
+)
+
+type (
+	builder struct{}
+
+	checker struct {
+		limiters []*limiter
+		// now -- time source, replaced in tests
+		now func() time.Time
+		// store -- nil if counters are local
+		store   Store
+		closing chan bool
+	}
+
+	// Config -- struct needed to configure this checker
+	Config struct {
+		Limits []Limit `required:"true"`
+		// Store -- share quota across replicas. default: local token buckets
+		Store StoreConfig
+	}
+
+	// Limit -- a rate limit enforced by a token bucket per distinct key
+	// Buckets are keyed by service name and the KeyBy values of the request.
+	// Checker instances with identical params share buckets,
+	// include consumer_id in KeyBy to limit consumer bindings independently.
+	Limit struct {
+		// Name -- quota group name, also used for cost overrides
+		// in <service_name>/quota/<name>/cost metric values
+		Name string
+		// Rate -- number of requests allowed per Period
+		Rate int
+		// Period -- second, minute, hour, day or a go duration. default: second
+		Period string
+		// Burst -- bucket capacity. default: Rate
+		Burst int
+		// KeyBy -- consumer_id, api_method or limit_by_ids/<LimitType>
+		// default: consumer_id
+		KeyBy []string `yaml:",omitempty"`
+	}
+
+	// limiter -- token buckets for a single Limit
+	limiter struct {
+		Limit
+		// perSec -- tokens added per second
+		perSec   float64
+		capacity float64
+
+		lock      sync.Mutex
+		buckets   map[string]*bucket
+		lastSweep time.Time
+
+		// shared -- nil unless a Store is configured
+		shared *sharedCounter
+	}
+
+	// bucket -- available tokens as of last
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+var (
+	// ErrLimitKeyMissing -- the request does not carry a value for a limit_by_ids key
+	ErrLimitKeyMissing = errors.New("LimitByIds entry not found")
+
+	periods = map[string]time.Duration{
+		"":       time.Second,
+		"second": time.Second,
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+	}
+)
+
+func quotaExceeded(name string) *sc.CheckError {
+	return &sc.CheckError{
+		Code:   sc.CheckError_RESOURCE_EXHAUSTED,
+		Detail: QuotaExceededErrorMsg + name,
+	}
+}
@@ -0,0 +1,109 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// cronField -- bitset of the values matched by a field
+	cronField uint64
+
+	// cronExpr -- minute hour day-of-month month day-of-week
+	cronExpr struct {
+		minute, hour, dom, month, dow cronField
+		// domStar, dowStar -- unrestricted day fields
+		domStar, dowStar bool
+	}
+)
+
+var cronBounds = []struct{ min, max int }{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, 0 and 7 are sunday
+}
+
+// parseCron -- parse a 5 field cron expression
+// Fields support *, lists, ranges and steps ex: */15 9-17 * * 1-5
+func parseCron(expr string) (*cronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronBounds) {
+		return nil, fmt.Errorf("cron %q: expected %d fields", expr, len(cronBounds))
+	}
+	parsed := make([]cronField, len(fields))
+	for i, f := range fields {
+		var err error
+		if parsed[i], err = parseField(f, cronBounds[i].min, cronBounds[i].max); err != nil {
+			return nil, fmt.Errorf("cron %q: %s", expr, err)
+		}
+	}
+	c := &cronExpr{
+		minute:  parsed[0],
+		hour:    parsed[1],
+		dom:     parsed[2],
+		month:   parsed[3],
+		dow:     parsed[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseField(field string, min int, max int) (cronField, error) {
+	var f cronField
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			var err error
+			bounds := strings.SplitN(part, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			f |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+func (f cronField) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// matches -- t is in a minute matched by the expression
+// as in cron, if both day fields are restricted either may match
+func (c *cronExpr) matches(t time.Time) bool {
+	if !c.minute.has(t.Minute()) || !c.hour.has(t.Hour()) || !c.month.has(int(t.Month())) {
+		return false
+	}
+	dom, dow := c.dom.has(t.Day()), c.dow.has(int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
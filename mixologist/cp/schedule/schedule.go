@@ -0,0 +1,193 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	sc "google/api/servicecontrol/v1"
+	"strings"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/cloudendpoints/mixologist/mixologist/cp/block"
+	"golang.org/x/net/context"
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func init() {
+	mixologist.RegisterChecker(Name, new(builder))
+}
+
+func (c *checker) Name() string {
+	return Name
+}
+
+func (c *checker) Unload() {}
+
+// inside -- t is inside one of the windows
+func (c *checker) inside(t time.Time) bool {
+	t = t.In(c.loc)
+	for _, w := range c.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check -- block requests outside the windows, or inside them in deny mode
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
+	if c.inside(c.now()) == c.deny {
+		return c.ce, nil
+	}
+	return nil, nil
+}
+
+func (w *window) hasDay(d time.Weekday) bool {
+	return w.days&(1<<uint(d)) != 0
+}
+
+// contains -- t is inside the window, t must be in the windows location
+func (w *window) contains(t time.Time) bool {
+	if w.cron != nil {
+		return w.cron.matches(t)
+	}
+	// wall clock time, not elapsed time, so that DST changes do not shift windows
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	switch {
+	case w.start == w.end:
+		return w.hasDay(t.Weekday())
+	case w.start < w.end:
+		return w.hasDay(t.Weekday()) && tod >= w.start && tod < w.end
+	}
+	// spans midnight, the day is the day the window starts
+	return (w.hasDay(t.Weekday()) && tod >= w.start) ||
+		(w.hasDay((t.Weekday()+6)%7) && tod < w.end)
+}
+
+func parseDay(day string) (int, error) {
+	for i, wd := range weekdays {
+		if strings.HasPrefix(strings.ToLower(day), wd) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", day)
+}
+
+// parseDays -- convert days and day ranges to a bitset
+func parseDays(days []string) (uint8, error) {
+	if len(days) == 0 {
+		return 0x7f, nil
+	}
+	var set uint8
+	for _, d := range days {
+		bounds := strings.SplitN(d, "-", 2)
+		lo, err := parseDay(bounds[0])
+		if err != nil {
+			return 0, err
+		}
+		hi := lo
+		if len(bounds) == 2 {
+			if hi, err = parseDay(bounds[1]); err != nil {
+				return 0, err
+			}
+		}
+		// ranges may wrap around the week ex: fri-mon
+		for i := lo; ; i = (i + 1) % 7 {
+			set |= 1 << uint(i)
+			if i == hi {
+				break
+			}
+		}
+	}
+	return set, nil
+}
+
+// parseTimeOfDay -- HH:MM to duration since midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func compileWindow(w Window) (*window, error) {
+	if w.Cron != "" {
+		if len(w.Days) > 0 || w.Start != "" || w.End != "" {
+			return nil, errors.New("cron cannot be used with days, start or end")
+		}
+		cron, err := parseCron(w.Cron)
+		return &window{cron: cron}, err
+	}
+	cw := &window{}
+	var err error
+	if cw.days, err = parseDays(w.Days); err != nil {
+		return nil, err
+	}
+	if cw.start, err = parseTimeOfDay(w.Start); err != nil {
+		return nil, err
+	}
+	if cw.end, err = parseTimeOfDay(w.End); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// compile -- convert Config into a checker
+func compile(cfg *Config) (*checker, error) {
+	chk := &checker{
+		now: time.Now,
+	}
+	var err error
+	if chk.deny, err = block.ParseMode(cfg.Mode, DefaultMode); err != nil {
+		return nil, err
+	}
+	code, err := block.ParseCode(cfg.Code)
+	if err != nil {
+		return nil, err
+	}
+	chk.ce = block.NewCheckError(code, cfg.Message)
+	if chk.loc, err = time.LoadLocation(cfg.TimeZone); err != nil {
+		return nil, err
+	}
+	if len(cfg.Windows) == 0 {
+		return nil, errors.New("at least one window is required")
+	}
+	for i, w := range cfg.Windows {
+		cw, err := compileWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: %s", i, err)
+		}
+		chk.windows = append(chk.windows, cw)
+	}
+	return chk, nil
+}
+
+// BuildChecker -- exported method
+func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
+	chk, err := compile(cfg.(*Config))
+	if err != nil {
+		return nil, err
+	}
+	return chk, nil
+}
+
+// ConfigStruct -- return pointer to Config struct
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		Mode:    DefaultMode,
+		Code:    DefaultCode,
+		Message: block.DefaultMessage,
+	}
+}
+
+// ValidateConfig -- validate given config
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	_, err := compile(cfg.(*Config))
+	return err
+}
@@ -0,0 +1,153 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	sc "google/api/servicecontrol/v1"
+)
+
+func buildChecker(cfg *Config) *checker {
+	b := new(builder)
+	dflt := b.ConfigStruct().(*Config)
+	if cfg.Code == "" {
+		cfg.Code = dflt.Code
+	}
+	if cfg.Message == "" {
+		cfg.Message = dflt.Message
+	}
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	return c.(*checker)
+}
+
+// at -- time in loc, 2016-10-03 is a monday
+func at(loc string, day int, hour int, min int) time.Time {
+	l, err := time.LoadLocation(loc)
+	g.Expect(err).To(g.BeNil())
+	return time.Date(2016, 10, 3+day, hour, min, 0, 0, l)
+}
+
+func TestBusinessHours(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(&Config{
+		Windows:  []Window{{Days: []string{"mon-fri"}, Start: "09:00", End: "17:30"}},
+		TimeZone: "America/Los_Angeles",
+	})
+	for _, tc := range []struct {
+		t      time.Time
+		inside bool
+	}{
+		{at("America/Los_Angeles", 0, 9, 0), true},
+		{at("America/Los_Angeles", 4, 17, 29), true},
+		{at("America/Los_Angeles", 4, 17, 30), false},
+		{at("America/Los_Angeles", 0, 8, 59), false},
+		{at("America/Los_Angeles", 5, 12, 0), false},
+		// 12:00 in LA is 19:00 UTC
+		{at("UTC", 1, 19, 0), true},
+		{at("UTC", 1, 12, 0), false},
+	} {
+		g.Expect(chk.inside(tc.t)).To(g.Equal(tc.inside), tc.t.String())
+	}
+}
+
+func TestOvernightWindow(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(&Config{
+		Windows: []Window{
+			{Days: []string{"fri"}, Start: "22:00", End: "02:00"},
+			{Days: []string{"sun"}},
+		},
+	})
+	g.Expect(chk.inside(at("UTC", 4, 23, 0))).To(g.BeTrue())
+	g.Expect(chk.inside(at("UTC", 5, 1, 59))).To(g.BeTrue(), "saturday morning belongs to friday")
+	g.Expect(chk.inside(at("UTC", 5, 2, 0))).To(g.BeFalse())
+	g.Expect(chk.inside(at("UTC", 0, 1, 0))).To(g.BeFalse(), "monday morning")
+	g.Expect(chk.inside(at("UTC", 6, 13, 0))).To(g.BeTrue(), "entire sunday")
+}
+
+func TestCron(t *testing.T) {
+	g.RegisterTestingT(t)
+	chk := buildChecker(&Config{
+		Windows: []Window{{Cron: "0-29 2 * * 0,7"}, {Cron: "* * 1 * 1"}},
+	})
+	g.Expect(chk.inside(at("UTC", 6, 2, 15))).To(g.BeTrue())
+	g.Expect(chk.inside(at("UTC", 6, 2, 30))).To(g.BeFalse())
+	g.Expect(chk.inside(at("UTC", 5, 2, 15))).To(g.BeFalse())
+	// both day fields are restricted, either matches
+	g.Expect(chk.inside(at("UTC", 0, 12, 0))).To(g.BeTrue(), "monday")
+	g.Expect(chk.inside(time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC))).To(g.BeTrue(), "january 1st")
+
+	for _, tc := range []struct {
+		expr  string
+		t     time.Time
+		match bool
+	}{
+		{"*/15 * * * *", at("UTC", 0, 3, 45), true},
+		{"*/15 * * * *", at("UTC", 0, 3, 46), false},
+		{"* 9-17 * * 1-5", at("UTC", 2, 17, 59), true},
+		{"* 9-17 * * 1-5", at("UTC", 5, 12, 0), false},
+		{"* * * 10 *", at("UTC", 0, 0, 0), true},
+	} {
+		c, err := parseCron(tc.expr)
+		g.Expect(err).To(g.BeNil())
+		g.Expect(c.matches(tc.t)).To(g.Equal(tc.match), tc.expr+" "+tc.t.String())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := &Config{
+		Windows: []Window{{Days: []string{"sat", "sun"}}},
+		Code:    "PERMISSION_DENIED",
+		Message: "closed for maintenance",
+	}
+	// an empty mode is DefaultMode, allow
+	chk := buildChecker(cfg)
+	chk.now = func() time.Time { return at("UTC", 0, 12, 0) }
+	ce, err := chk.Check(context.Background(), &sc.CheckRequest{})
+	g.Expect(err).To(g.BeNil())
+	g.Expect(ce).To(g.Equal(&sc.CheckError{Code: sc.CheckError_PERMISSION_DENIED, Detail: "closed for maintenance"}))
+
+	chk.now = func() time.Time { return at("UTC", 5, 12, 0) }
+	ce, _ = chk.Check(context.Background(), &sc.CheckRequest{})
+	g.Expect(ce).To(g.BeNil())
+
+	// deny mode blocks inside the window
+	cfg.Mode = ModeDeny
+	chk = buildChecker(cfg)
+	chk.now = func() time.Time { return at("UTC", 5, 12, 0) }
+	ce, _ = chk.Check(context.Background(), &sc.CheckRequest{})
+	g.Expect(ce.Code).To(g.Equal(sc.CheckError_PERMISSION_DENIED))
+}
+
+func TestValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	valid := func(w ...Window) *Config {
+		cfg := b.ConfigStruct().(*Config)
+		cfg.Windows = w
+		return cfg
+	}
+	g.Expect(b.ValidateConfig(valid(Window{Days: []string{"Monday", "fri-mon"}, Start: "23:00", End: "01:00"}))).To(g.Succeed())
+	for _, cfg := range []*Config{
+		valid(),
+		valid(Window{Days: []string{"someday"}}),
+		valid(Window{Start: "25:00"}),
+		valid(Window{Start: "9am"}),
+		valid(Window{Cron: "* * * *"}),
+		valid(Window{Cron: "60 * * * *"}),
+		valid(Window{Cron: "*/0 * * * *"}),
+		valid(Window{Cron: "* * * * *", Days: []string{"mon"}}),
+		{Windows: []Window{{}}, Code: "BOGUS"},
+		{Windows: []Window{{}}, Code: DefaultCode, TimeZone: "Mars/Olympus_Mons"},
+		{Windows: []Window{{}}, Code: DefaultCode, Mode: "block"},
+	} {
+		g.Expect(b.ValidateConfig(cfg)).NotTo(g.Succeed(), "%#v", cfg)
+		_, err := b.BuildChecker(cfg)
+		g.Expect(err).NotTo(g.BeNil())
+	}
+}
@@ -0,0 +1,69 @@
+package schedule
+
+import (
+	sc "google/api/servicecontrol/v1"
+	"time"
+
+	"github.com/cloudendpoints/mixologist/mixologist/cp/block"
+)
+
+const (
+	// Name -- name of this provider.
+	Name = "schedule"
+
+	// ModeAllow -- requests are blocked outside the windows
+	ModeAllow = block.ModeAllow
+	// ModeDeny -- requests are blocked inside the windows
+	ModeDeny = block.ModeDeny
+	// DefaultMode -- a schedule lists when access is allowed
+	DefaultMode = ModeAllow
+
+	// DefaultCode -- CheckError code returned when blocked
+	DefaultCode = "CLIENT_APP_BLOCKED"
+)
+
+type (
+	builder struct{}
+
+	checker struct {
+		loc     *time.Location
+		deny    bool
+		windows []*window
+		ce      *sc.CheckError
+		now     func() time.Time
+	}
+
+	// Config -- struct needed to configure this checker
+	Config struct {
+		// Windows -- a request is inside the schedule if it is inside any window
+		Windows []Window `yaml:"windows" required:"true"`
+		// TimeZone -- IANA time zone of the windows, defaults to UTC
+		TimeZone string `yaml:"timezone"`
+		// Mode -- allow or deny access inside the windows. default: DefaultMode, allow
+		Mode string `yaml:"mode"`
+		// Code -- name of the CheckError code returned when blocked
+		Code string `yaml:"code"`
+		// Message -- detail of the CheckError returned when blocked
+		Message string `yaml:"message"`
+	}
+
+	// Window -- either a Cron expression or Days with a Start and End time
+	Window struct {
+		// Cron -- minute hour day-of-month month day-of-week, matches every minute inside the window
+		Cron string `yaml:"cron"`
+		// Days -- mon, tue, ... or ranges like mon-fri. Empty means every day
+		Days []string `yaml:"days"`
+		// Start, End -- HH:MM, an End before the Start ends on the next day.
+		// Equal Start and End span the entire day
+		Start string `yaml:"start"`
+		End   string `yaml:"end"`
+	}
+
+	// window -- compiled Window
+	window struct {
+		cron *cronExpr
+		// days -- bitset of time.Weekday
+		days       uint8
+		start, end time.Duration
+	}
+)
@@ -0,0 +1,77 @@
+package whitelist
+
+import (
+	"net"
+)
+
+type (
+	// trieNode -- binary trie node, one level per bit of the address
+	trieNode struct {
+		child [2]*trieNode
+		// leaf -- a prefix ends at this node
+		leaf bool
+	}
+
+	// ipTrie -- longest prefix trie of IPv4 and IPv6 networks
+	ipTrie struct {
+		v4 trieNode
+		v6 trieNode
+		n  int
+	}
+)
+
+func bit(ip net.IP, i int) byte {
+	return ip[i/8] >> (7 - uint(i%8)) & 1
+}
+
+// root -- trie and normalized address for ip
+func (t *ipTrie) root(ip net.IP, v4 bool) (*trieNode, net.IP) {
+	if v4 {
+		return &t.v4, ip.To4()
+	}
+	return &t.v6, ip.To16()
+}
+
+// insert -- add ipnet to the trie
+func (t *ipTrie) insert(ipnet *net.IPNet) {
+	ones, bits := ipnet.Mask.Size()
+	n, ip := t.root(ipnet.IP, bits == 8*net.IPv4len)
+	for i := 0; i < ones; i++ {
+		if n.leaf {
+			// already covered by a shorter prefix
+			return
+		}
+		b := bit(ip, i)
+		if n.child[b] == nil {
+			n.child[b] = &trieNode{}
+		}
+		n = n.child[b]
+	}
+	n.leaf = true
+	// longer prefixes are covered by this one
+	n.child = [2]*trieNode{}
+	t.n++
+}
+
+// contains -- true if ip is in any of the networks
+func (t *ipTrie) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	n, ip := t.root(ip, ip.To4() != nil)
+	for i := 0; n != nil; i++ {
+		if n.leaf {
+			return true
+		}
+		if i == 8*len(ip) {
+			return false
+		}
+		n = n.child[bit(ip, i)]
+	}
+	return false
+}
+
+// Len -- number of networks inserted
+func (t *ipTrie) Len() int {
+	return t.n
+}
@@ -1,10 +1,11 @@
 package whitelist
 
 import (
-	"crypto/sha1"
 	"errors"
 	sc "google/api/servicecontrol/v1"
 	"sync/atomic"
+
+	"github.com/cloudendpoints/mixologist/mixologist"
 )
 
 const (
@@ -14,6 +15,8 @@ const (
 	ClientIPKey = "servicecontrol.googleapis.com/caller_ip"
 	// IPBlockedErrorMsg -- error msg while rejecting
 	IPBlockedErrorMsg = "IP address is not on the whitelist"
+	// DefaultRefreshIntervalSec -- interval between fetches of the ProviderURL
+	DefaultRefreshIntervalSec = 5
 )
 
 type (
@@ -21,21 +24,40 @@ type (
 	}
 
 	checker struct {
-		backend string
-		// wl holds value of type []*net.IPNet
+		// poller -- nil for inline lists
+		poller *mixologist.Poller
+		// atomicWhitelist holds value of type *ipFilter
 		atomicWhitelist atomic.Value
-		fetchedSha      [sha1.Size]byte
-
-		closing chan bool
 	}
 
 	// Config -- struct needed to configure this checker
+	// Either ProviderURL or the inline lists must be given
 	Config struct {
-		ProviderURL string `yaml:"providerurl" required:"true"`
+		// ProviderURL -- http(s) url, file or configmap://namespace/name of a CfgList
+		ProviderURL string `yaml:"providerurl"`
+		// RefreshIntervalSec -- interval between fetches of ProviderURL
+		RefreshIntervalSec int `yaml:"refreshintervalsec"`
+		// Kubeconfig -- used for configmap urls, defaults to the in cluster config
+		Kubeconfig string `yaml:"kubeconfig"`
+
+		// WhiteList, BlackList -- inline CfgList
+		WhiteList []string `yaml:"whitelist"`
+		BlackList []string `yaml:"blacklist"`
 	}
 	// CfgList -- file format of the exteral file denoting a whitelist
+	// Entries are IPv4 or IPv6 addresses or CIDR prefixes.
+	// BlackList is evaluated first, if WhiteList is empty every address
+	// not on the BlackList is allowed.
 	CfgList struct {
-		WhiteList []string `yaml:"whitelist" required:"true"`
+		WhiteList []string `yaml:"whitelist"`
+		BlackList []string `yaml:"blacklist"`
+	}
+
+	// ipFilter -- compiled CfgList
+	ipFilter struct {
+		// allow -- nil allows every address
+		allow *ipTrie
+		deny  *ipTrie
 	}
 )
 
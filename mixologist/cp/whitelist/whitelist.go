@@ -1,43 +1,52 @@
 package whitelist
 
 import (
-	"crypto/sha1"
 	"errors"
+	"fmt"
 	sc "google/api/servicecontrol/v1"
-	"io/ioutil"
 	"net"
-	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cloudendpoints/mixologist/mixologist"
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	"gopkg.in/yaml.v2"
 )
 
 // whitelist -- typed atomic accessor for whitelist
-func (c *checker) whitelist() []*net.IPNet {
-	return c.atomicWhitelist.Load().([]*net.IPNet)
+func (c *checker) whitelist() *ipFilter {
+	return c.atomicWhitelist.Load().(*ipFilter)
 }
 
 // setWhitelist -- typed atomic setter for whitelist
-func (c *checker) setWhitelist(wl []*net.IPNet) {
+func (c *checker) setWhitelist(wl *ipFilter) {
 	c.atomicWhitelist.Store(wl)
 }
 
 func (c *checker) checkWhiteList(ip string) bool {
-	ipa := net.ParseIP(ip)
-	for _, ipnet := range c.whitelist() {
-		if ipnet.Contains(ipa) {
-			return true
-		}
+	return c.whitelist().allowed(net.ParseIP(ip))
+}
+
+// allowed -- ip is not on the deny list and is on the allow list
+func (f *ipFilter) allowed(ip net.IP) bool {
+	if ip == nil || f.deny.contains(ip) {
+		return false
+	}
+	return f.allow == nil || f.allow.contains(ip)
+}
+
+func (f *ipFilter) String() string {
+	allow := "all"
+	if f.allow != nil {
+		allow = strconv.Itoa(f.allow.Len())
 	}
-	return false
+	return fmt.Sprintf("allow: %s deny: %d", allow, f.deny.Len())
 }
 
 // Check -- Check if client ip is on the whitelist
-func (c *checker) Check(cr *sc.CheckRequest) (*sc.CheckError, error) {
+func (c *checker) Check(ctx context.Context, cr *sc.CheckRequest) (*sc.CheckError, error) {
 	//Check: service_name:"owner-1470410002014.appspot.com" operation:<operation_id:"c37d4302-66bd-4f34-8ed7-07b36d941fcd" operation_name:"ListShelves" consumer_id:"project:mixologist-142215" start_time:<seconds:1475272937 nanos:398591000 > end_time:<seconds:1475273136 nanos:719613000 > labels:<key:"servicecontrol.googleapis.com/caller_ip" value:"10.128.0.2" > labels:<key:"servicecontrol.googleapis.com/service_agent" value:"ESP/0.3.7" > labels:<key:"servicecontrol.googleapis.com/user_agent" value:"ESP" > >
 	if ip, found := cr.GetOperation().GetLabels()[ClientIPKey]; found {
 		if c.checkWhiteList(ip) {
@@ -50,75 +59,66 @@ func (c *checker) Check(cr *sc.CheckRequest) (*sc.CheckError, error) {
 	return nil, ErrClientIPMissing
 }
 
-// updateConfig -- fetch list from backend and populate datastructure
-func (c *checker) updateConfigLoop() {
-	ticker := time.NewTicker(time.Second * 5)
-	defer ticker.Stop()
-
-	clnt := &http.Client{
-		Timeout: time.Second * 5,
+// load -- install the filter of a fetched CfgList
+func (c *checker) load(buf []byte) error {
+	wlcfg := CfgList{}
+	if err := yaml.Unmarshal(buf, &wlcfg); err != nil {
+		return err
 	}
-	// nearly synchronous config fetch
-	c.updateConfig(clnt)
-	done := false
-
-	for !done {
-		select {
-		case <-ticker.C:
-			c.updateConfig(clnt)
-		case <-c.closing:
-			done = true
-		}
+	if len(wlcfg.WhiteList) == 0 && len(wlcfg.BlackList) == 0 {
+		return errors.New("whitelist and blacklist are empty")
 	}
-	glog.V(2).Info("Unloaded")
+	c.setWhitelist(buildFilter(&wlcfg))
+	return nil
 }
 
-// updateConfig -- fetch list from backend and populate datastructure
-func (c *checker) updateConfig(clnt *http.Client) error {
-	resp, err := clnt.Get(c.backend)
-	if err != nil {
-		glog.Warning("Could not connect to ", c.backend, " ", err)
-		return err
+// buildFilter -- compile allow and deny lists
+func buildFilter(cfg *CfgList) *ipFilter {
+	f := &ipFilter{
+		deny: buildWhiteList(cfg.BlackList...),
 	}
-	buf, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		glog.Warning("Could not read from ", c.backend, " ", err)
-		return err
+	if len(cfg.WhiteList) > 0 {
+		f.allow = buildWhiteList(cfg.WhiteList...)
 	}
+	glog.V(1).Info("New whitelist ", f)
+	return f
+}
 
-	newsha := sha1.Sum(buf)
-	// c.fetchedSha is only read and written by this function
-	// in a single thread
-	if newsha != c.fetchedSha {
-		glog.Infoln("Fetched new config from ", c.backend)
-		wlcfg := CfgList{}
-		err = yaml.Unmarshal(buf, &wlcfg)
-		if err != nil || len(wlcfg.WhiteList) == 0 {
-			glog.Warning("Could not unmarshal ", c.backend, " ", err)
-			return err
+// parseEntry -- parse an address or prefix.
+// IPv4-mapped IPv6 entries are converted to IPv4 as lookups are
+func parseEntry(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		addr := net.ParseIP(entry)
+		if addr == nil {
+			return nil, fmt.Errorf("invalid IP address %s", entry)
+		}
+		if v4 := addr.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}, nil
 		}
-		// Now create a new map and install it
-		c.setWhitelist(buildWhiteList(wlcfg.WhiteList...))
-		c.fetchedSha = newsha
+		return &net.IPNet{IP: addr, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}, nil
 	}
-	return nil
+	_, ipnet, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := ipnet.Mask.Size()
+	if v4 := ipnet.IP.To4(); v4 != nil && bits == 8*net.IPv6len && ones >= 8*(net.IPv6len-net.IPv4len) {
+		ipnet = &net.IPNet{IP: v4, Mask: net.CIDRMask(ones-8*(net.IPv6len-net.IPv4len), 8*net.IPv4len)}
+	}
+	return ipnet, nil
 }
 
-// buildWhiteList -- convert a list of strings to ipnets
-func buildWhiteList(whitelist ...string) []*net.IPNet {
-	wl := make([]*net.IPNet, 0, len(whitelist))
+// buildWhiteList -- convert a list of addresses and prefixes to a trie
+func buildWhiteList(whitelist ...string) *ipTrie {
+	wl := &ipTrie{}
 	for _, ip := range whitelist {
-		if !strings.Contains(ip, "/") {
-			ip += "/32"
-		}
-		_, ipnet, err := net.ParseCIDR(ip)
+		ipnet, err := parseEntry(ip)
 		if err != nil {
 			glog.Warningf("Unable to parse %s -- %v", ip, err)
 			continue
 		}
-		wl = append(wl, ipnet)
+		wl.insert(ipnet)
 	}
-	glog.V(1).Info("New whitelist", wl)
 	return wl
 }
 
@@ -127,7 +127,9 @@ func (c *checker) Name() string {
 }
 
 func (c *checker) Unload() {
-	close(c.closing)
+	if c.poller != nil {
+		c.poller.Stop()
+	}
 }
 
 func init() {
@@ -137,30 +139,46 @@ func init() {
 // BuildChecker -- exported method
 func (b *builder) BuildChecker(cfg interface{}) (mixologist.Checker, error) {
 	wlcfg := cfg.(*Config)
-	chk := &checker{
-		backend: wlcfg.ProviderURL,
-		closing: make(chan bool),
+	chk := &checker{}
+	if wlcfg.ProviderURL == "" {
+		chk.setWhitelist(buildFilter(&CfgList{
+			WhiteList: wlcfg.WhiteList,
+			BlackList: wlcfg.BlackList,
+		}))
+		return chk, nil
+	}
+	var err error
+	chk.poller, err = mixologist.NewPoller(wlcfg.ProviderURL, wlcfg.Kubeconfig,
+		time.Duration(wlcfg.RefreshIntervalSec)*time.Second, chk.load)
+	if err != nil {
+		return nil, err
 	}
 	// install an empty list
-	chk.atomicWhitelist.Store([]*net.IPNet{})
-	go chk.updateConfigLoop()
+	chk.setWhitelist(&ipFilter{allow: &ipTrie{}, deny: &ipTrie{}})
+	chk.poller.Start()
 	return chk, nil
 }
 
 // ConfigStruct -- return pointer to Config struct
 func (b *builder) ConfigStruct() interface{} {
-	return &Config{}
+	return &Config{
+		RefreshIntervalSec: DefaultRefreshIntervalSec,
+	}
 }
 
 // ValidateConfig -- validate given config
 func (b *builder) ValidateConfig(cfg interface{}) error {
 	wlcfg := cfg.(*Config)
-	var err error
-	var u *url.URL
-	if u, err = url.Parse(wlcfg.ProviderURL); err == nil {
-		if u.Scheme == "" || u.Host == "" {
-			err = errors.New("Scheme and Host cannot be nil")
-		}
+	inline := len(wlcfg.WhiteList) > 0 || len(wlcfg.BlackList) > 0
+	switch {
+	case wlcfg.ProviderURL == "" && !inline:
+		return errors.New("One of ProviderURL, WhiteList or BlackList is required")
+	case wlcfg.ProviderURL != "" && inline:
+		return errors.New("ProviderURL cannot be used with an inline WhiteList or BlackList")
+	case wlcfg.ProviderURL == "":
+		return nil
+	case wlcfg.RefreshIntervalSec <= 0:
+		return errors.New("RefreshIntervalSec must be positive")
 	}
-	return err
+	return mixologist.ValidateSourceURL(wlcfg.ProviderURL)
 }
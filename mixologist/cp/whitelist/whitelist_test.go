@@ -1,14 +1,21 @@
 package whitelist
 
 import (
+	"github.com/cloudendpoints/mixologist/mixologist"
 	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
 	sc "google/api/servicecontrol/v1"
 	"gopkg.in/yaml.v2"
+	"fmt"
+	"net"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"runtime"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func build(url string) (*checker, error) {
@@ -20,6 +27,7 @@ func build(url string) (*checker, error) {
 }
 
 func TestWhitelistFetch(t *testing.T) {
+	g.RegisterTestingT(t)
 	cfg := CfgList{
 		WhiteList: []string{"10.10.11.2", "10.10.11.3"},
 	}
@@ -34,11 +42,11 @@ func TestWhitelistFetch(t *testing.T) {
 		w.Write(out)
 	}))
 	defer ts.Close()
-	wl := &checker{
-		backend: ts.URL,
-	}
-	clnt := &http.Client{}
-	err := wl.updateConfig(clnt)
+	wl := &checker{}
+	var err error
+	wl.poller, err = mixologist.NewPoller(ts.URL, "", time.Minute, wl.load)
+	g.Expect(err).To(g.BeNil())
+	err = wl.poller.Poll()
 	if err != nil {
 		t.Errorf("Expected success, got %s", err)
 	}
@@ -53,7 +61,7 @@ func TestWhitelistFetch(t *testing.T) {
 	IPAddr := "202.54.10.2"
 
 	cfg.WhiteList[0] = IPAddr
-	err = wl.updateConfig(clnt)
+	err = wl.poller.Poll()
 	if err != nil {
 		t.Errorf("Expected success, got %s", err)
 	}
@@ -99,14 +107,14 @@ func checkRequest(ipaddr string) *sc.CheckRequest {
 
 func buildChecker(ipaddr ...string) *checker {
 	wl := &checker{}
-	wl.setWhitelist(buildWhiteList(ipaddr...))
+	wl.setWhitelist(buildFilter(&CfgList{WhiteList: ipaddr}))
 	return wl
 }
 
 func testcase(checkerAddrs []string, addr string, expectedErr error, expectedCheckErr *sc.CheckError, msg string) {
 	wl := buildChecker(checkerAddrs...)
 	cr := checkRequest(addr)
-	ce, err := wl.Check(cr)
+	ce, err := wl.Check(context.Background(), cr)
 	if expectedErr == nil {
 		g.Expect(err).To(g.BeNil())
 	} else {
@@ -135,7 +143,164 @@ func TestWhiteListBadRequest(t *testing.T) {
 	badcr := checkRequest("")
 	IPAddr := "9.9.9.9"
 	wl := buildChecker(IPAddr)
-	ce, err := wl.Check(badcr)
+	ce, err := wl.Check(context.Background(), badcr)
 	g.Expect(err).To(g.Equal(ErrClientIPMissing))
 	g.Expect(ce).To(g.BeNil(), IPAddr+" Should succeed")
 }
+
+func TestWhiteListIPv6(t *testing.T) {
+	g.RegisterTestingT(t)
+
+	testcase([]string{"2001:db8::1"}, "2001:db8::1", nil, nil, "IPv6 literal should succeed")
+	testcase([]string{"2001:db8::1"}, "2001:db8::2", nil, IPBlockedCheckError, "IPv6 literal is a /128")
+	testcase([]string{"2001:db8::/32"}, "2001:db8:ffff::1", nil, nil, "IPv6 prefix should succeed")
+	testcase([]string{"2001:db8::/32"}, "2001:db9::1", nil, IPBlockedCheckError, "outside IPv6 prefix")
+	testcase([]string{"10.0.0.0/8"}, "::ffff:10.1.2.3", nil, nil, "IPv4 mapped address should succeed")
+	testcase([]string{"10.0.0.0/8"}, "fe80::1", nil, IPBlockedCheckError, "IPv6 address is not in IPv4 prefix")
+	testcase([]string{"::/0"}, "9.9.9.9", nil, IPBlockedCheckError, "IPv4 address is not in IPv6 prefix")
+	testcase([]string{"9.9.9.9"}, "not-an-ip", nil, IPBlockedCheckError, "unparsable address")
+	testcase([]string{"::ffff:1.2.3.4"}, "1.2.3.4", nil, nil, "IPv4 mapped entry should succeed")
+	testcase([]string{"::ffff:1.2.3.4"}, "1.2.3.5", nil, IPBlockedCheckError, "IPv4 mapped entry is a /32")
+	testcase([]string{"::ffff:10.0.0.0/104"}, "10.1.2.3", nil, nil, "IPv4 mapped prefix should succeed")
+}
+
+func TestBlackListIPv4Mapped(t *testing.T) {
+	g.RegisterTestingT(t)
+
+	wl := &checker{}
+	wl.setWhitelist(buildFilter(&CfgList{BlackList: []string{"::ffff:1.2.3.4"}}))
+	g.Expect(wl.checkWhiteList("1.2.3.4")).To(g.BeFalse())
+	g.Expect(wl.checkWhiteList("::ffff:1.2.3.4")).To(g.BeFalse())
+	g.Expect(wl.checkWhiteList("1.2.3.5")).To(g.BeTrue())
+	g.Expect(wl.checkWhiteList("::1")).To(g.BeTrue(), "IPv6 addresses are not blocked")
+}
+
+func TestBlackList(t *testing.T) {
+	g.RegisterTestingT(t)
+
+	wl := &checker{}
+	wl.setWhitelist(buildFilter(&CfgList{
+		WhiteList: []string{"10.0.0.0/8", "2001:db8::/32"},
+		BlackList: []string{"10.1.0.0/16", "2001:db8::bad"},
+	}))
+	g.Expect(wl.checkWhiteList("10.2.0.1")).To(g.BeTrue())
+	g.Expect(wl.checkWhiteList("10.1.0.1")).To(g.BeFalse(), "deny is evaluated before allow")
+	g.Expect(wl.checkWhiteList("2001:db8::bad")).To(g.BeFalse())
+	g.Expect(wl.checkWhiteList("2001:db8::b0d")).To(g.BeTrue())
+	g.Expect(wl.checkWhiteList("11.0.0.1")).To(g.BeFalse())
+
+	// blacklist only
+	wl.setWhitelist(buildFilter(&CfgList{BlackList: []string{"10.1.0.0/16"}}))
+	g.Expect(wl.checkWhiteList("10.1.0.1")).To(g.BeFalse())
+	g.Expect(wl.checkWhiteList("11.0.0.1")).To(g.BeTrue())
+	g.Expect(wl.checkWhiteList("2001:db8::1")).To(g.BeTrue())
+}
+
+func TestTrie(t *testing.T) {
+	g.RegisterTestingT(t)
+
+	tr := buildWhiteList("10.0.0.0/8", "10.1.0.0/16", "192.168.1.1", "0.0.0.0/0")
+	g.Expect(tr.contains(net.ParseIP("8.8.8.8"))).To(g.BeTrue(), "/0 matches every IPv4 address")
+	g.Expect(tr.contains(net.ParseIP("::1"))).To(g.BeFalse())
+
+	tr = buildWhiteList("10.1.0.0/16", "10.0.0.0/8", "bad", "10.0.0.0/33")
+	g.Expect(tr.Len()).To(g.Equal(2))
+	g.Expect(tr.contains(net.ParseIP("10.200.0.1"))).To(g.BeTrue(), "shorter prefix inserted later")
+	g.Expect(tr.contains(net.ParseIP("11.0.0.1"))).To(g.BeFalse())
+	g.Expect(tr.contains(nil)).To(g.BeFalse())
+}
+
+func largeList(n int) []string {
+	l := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		l = append(l, fmt.Sprintf("%d.%d.%d.0/24", 1+i>>16, i>>8&0xff, i&0xff))
+	}
+	return l
+}
+
+func TestLargeWhiteList(t *testing.T) {
+	g.RegisterTestingT(t)
+	wl := &checker{}
+	wl.setWhitelist(buildFilter(&CfgList{WhiteList: largeList(50000)}))
+	g.Expect(wl.whitelist().allow.Len()).To(g.Equal(50000))
+	g.Expect(wl.checkWhiteList("1.195.79.7")).To(g.BeTrue())
+	g.Expect(wl.checkWhiteList("1.195.80.7")).To(g.BeFalse())
+}
+
+func BenchmarkWhiteList(b *testing.B) {
+	wl := &checker{}
+	wl.setWhitelist(buildFilter(&CfgList{WhiteList: largeList(50000)}))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wl.checkWhiteList("1.195.80.7")
+	}
+}
+
+func TestWhiteListInline(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	cfg := b.ConfigStruct().(*Config)
+	cfg.WhiteList = []string{"10.0.0.0/8"}
+	cfg.BlackList = []string{"10.1.0.0/16"}
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	defer c.Unload()
+
+	ce, err := c.Check(context.Background(), checkRequest("10.2.0.1"))
+	g.Expect(err).To(g.BeNil())
+	g.Expect(ce).To(g.BeNil())
+	ce, _ = c.Check(context.Background(), checkRequest("10.1.0.1"))
+	g.Expect(ce).To(g.Equal(IPBlockedCheckError))
+}
+
+func TestWhiteListFile(t *testing.T) {
+	g.RegisterTestingT(t)
+	f, err := ioutil.TempFile("", "whitelist")
+	g.Expect(err).To(g.BeNil())
+	defer os.Remove(f.Name())
+	g.Expect(ioutil.WriteFile(f.Name(), []byte("whitelist: [9.9.9.9]"), 0644)).To(g.Succeed())
+
+	b := new(builder)
+	cfg := b.ConfigStruct().(*Config)
+	cfg.ProviderURL = f.Name()
+	cfg.RefreshIntervalSec = 1
+	g.Expect(b.ValidateConfig(cfg)).To(g.Succeed())
+	c, err := b.BuildChecker(cfg)
+	g.Expect(err).To(g.BeNil())
+	defer c.Unload()
+	wl := c.(*checker)
+	g.Eventually(func() bool { return wl.checkWhiteList("9.9.9.9") }).Should(g.BeTrue())
+
+	// changes to the file are picked up on the next refresh
+	g.Expect(ioutil.WriteFile(f.Name(), []byte("whitelist: [9.9.9.1]"), 0644)).To(g.Succeed())
+	g.Eventually(func() bool { return wl.checkWhiteList("9.9.9.1") }, 3*time.Second).Should(g.BeTrue())
+	g.Expect(wl.checkWhiteList("9.9.9.9")).To(g.BeFalse())
+}
+
+func TestWhiteListValidateConfig(t *testing.T) {
+	g.RegisterTestingT(t)
+	b := new(builder)
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{ProviderURL: "https://example.com/wl", RefreshIntervalSec: 5}, true},
+		{Config{ProviderURL: "configmap://mixologist/whitelist", RefreshIntervalSec: 5}, true},
+		{Config{ProviderURL: "/etc/mixologist/whitelist.yml", RefreshIntervalSec: 5}, true},
+		{Config{WhiteList: []string{"9.9.9.9"}}, true},
+		{Config{BlackList: []string{"9.9.9.9"}}, true},
+		{Config{}, false},
+		{Config{ProviderURL: "https://example.com/wl", RefreshIntervalSec: 5, WhiteList: []string{"9.9.9.9"}}, false},
+		{Config{ProviderURL: "https://example.com/wl"}, false},
+		{Config{ProviderURL: "ftp://example.com/wl", RefreshIntervalSec: 5}, false},
+	} {
+		cfg := tc.cfg
+		err := b.ValidateConfig(&cfg)
+		if tc.valid {
+			g.Expect(err).To(g.BeNil(), "%#v", tc.cfg)
+		} else {
+			g.Expect(err).NotTo(g.BeNil(), "%#v", tc.cfg)
+		}
+	}
+}
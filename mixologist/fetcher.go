@@ -0,0 +1,214 @@
+package mixologist
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/tools/clientcmd"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// FileScheme -- scheme of local files, a url without scheme is also a file
+	FileScheme = "file"
+)
+
+// Fetcher -- reads a document from an http(s) url, a local file
+// or a kubernetes ConfigMap configmap://namespace/name
+type Fetcher struct {
+	url       *url.URL
+	clnt      *http.Client
+	k8sClient *kubernetes.Clientset
+}
+
+// NewFetcher -- kubeconfig is only used for ConfigMaps,
+// an empty kubeconfig uses the in cluster config
+func NewFetcher(curl string, kubeconfig string) (*Fetcher, error) {
+	u, err := url.Parse(curl)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fetcher{
+		url: u,
+		clnt: &http.Client{
+			Timeout: time.Second * 5,
+		},
+	}
+
+	if u.Scheme == ConfigMapScheme {
+		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		k8sClient, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		f.k8sClient = k8sClient
+	}
+	return f, nil
+}
+
+// ValidateSourceURL -- ensure curl can be fetched by a Fetcher
+func ValidateSourceURL(curl string) error {
+	u, err := url.Parse(curl)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Scheme == ConfigMapScheme:
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return fmt.Errorf("%s must be of the form %s://namespace/name", curl, ConfigMapScheme)
+		}
+	case strings.HasPrefix(u.Scheme, "http"):
+		if u.Host == "" {
+			return fmt.Errorf("%s has no host", curl)
+		}
+	case u.Scheme == "" || u.Scheme == FileScheme:
+		if u.Path == "" {
+			return fmt.Errorf("%s has no path", curl)
+		}
+	default:
+		return fmt.Errorf("%s has unsupported scheme %s", curl, u.Scheme)
+	}
+	return nil
+}
+
+func (f *Fetcher) String() string {
+	return f.url.String()
+}
+
+// Fetch -- read the document
+func (f *Fetcher) Fetch() ([]byte, error) {
+	var data []byte
+	var err error
+
+	switch {
+	case f.url.Scheme == ConfigMapScheme:
+		mapname := strings.TrimLeft(f.url.Path, "/")
+		cfg, err := f.k8sClient.ConfigMaps(f.url.Host).Get(mapname)
+		if err != nil {
+			return nil, err
+		}
+		if len(cfg.Data) > 1 {
+			glog.Warningf("map has multiple configs")
+		}
+		for _, v := range cfg.Data {
+			data = []byte(v)
+			break
+		}
+	case strings.HasPrefix(f.url.Scheme, "http"):
+		resp, err := f.clnt.Get(f.url.String())
+		if err != nil {
+			glog.Warning("Could not connect to ", f.url, " ", err)
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if data, err = ioutil.ReadAll(resp.Body); err != nil {
+			glog.Warning("Could not read from ", f.url, " ", err)
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("Could not get config %s %v", f.url, resp.Status)
+			glog.Warning(err)
+			return nil, err
+		}
+	default:
+		path := f.url.String()
+		if f.url.Scheme == FileScheme {
+			path = f.url.Path
+		}
+		if data, err = ioutil.ReadFile(path); err != nil {
+			glog.Errorf("Unable to read %s:  %s", f.url, err)
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Poller -- fetches a document every interval and hands it to load when it
+// changed. A document that load rejects is handed to it again on the next fetch
+type Poller struct {
+	fetcher  *Fetcher
+	interval time.Duration
+	load     func([]byte) error
+
+	// lock serializes polls
+	lock       sync.Mutex
+	fetchedSha [sha1.Size]byte
+	closing    chan bool
+}
+
+// NewPoller -- poll curl, see NewFetcher for kubeconfig
+func NewPoller(curl string, kubeconfig string, interval time.Duration, load func([]byte) error) (*Poller, error) {
+	f, err := NewFetcher(curl, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Poller{
+		fetcher:  f,
+		interval: interval,
+		load:     load,
+		closing:  make(chan bool),
+	}, nil
+}
+
+func (p *Poller) String() string {
+	return p.fetcher.String()
+}
+
+// Start -- poll now and every interval until Stop
+func (p *Poller) Start() {
+	go p.pollLoop()
+}
+
+// Stop -- stop polling
+func (p *Poller) Stop() {
+	close(p.closing)
+}
+
+func (p *Poller) pollLoop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	// nearly synchronous config fetch
+	p.Poll()
+	for {
+		select {
+		case <-ticker.C:
+			p.Poll()
+		case <-p.closing:
+			glog.V(2).Info("Stopped polling ", p)
+			return
+		}
+	}
+}
+
+// Poll -- fetch the document and load it if it changed
+func (p *Poller) Poll() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	buf, err := p.fetcher.Fetch()
+	if err != nil {
+		return err
+	}
+	newsha := sha1.Sum(buf)
+	if newsha == p.fetchedSha {
+		return nil
+	}
+	glog.Infoln("Fetched new config from ", p)
+	if err = p.load(buf); err != nil {
+		glog.Warning("Could not load ", p, " ", err)
+		return err
+	}
+	p.fetchedSha = newsha
+	return nil
+}
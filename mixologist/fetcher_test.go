@@ -0,0 +1,141 @@
+package mixologist
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFetcher(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cfg" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("http"))
+	}))
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("file")
+	f.Close()
+
+	tests := []struct {
+		url  string
+		data string
+		err  bool
+	}{
+		{ts.URL + "/cfg", "http", false},
+		{ts.URL + "/missing", "", true},
+		{f.Name(), "file", false},
+		{"file://" + f.Name(), "file", false},
+		{f.Name() + ".missing", "", true},
+	}
+	for _, tst := range tests {
+		fetcher, err := NewFetcher(tst.url, "")
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", tst.url, err)
+		}
+		data, err := fetcher.Fetch()
+		if (err != nil) != tst.err {
+			t.Errorf("%s: got error %v, want error %v", tst.url, err, tst.err)
+		}
+		if string(data) != tst.data {
+			t.Errorf("%s: got %q, want %q", tst.url, data, tst.data)
+		}
+	}
+}
+
+func TestValidateSourceURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/whitelist", true},
+		{"https://", false},
+		{"configmap://mixologist/whitelist", true},
+		{"configmap://mixologist", false},
+		{"/etc/mixologist/whitelist.yml", true},
+		{"file:///etc/mixologist/whitelist.yml", true},
+		{"file://", false},
+		{"", false},
+		{"ftp://example.com/whitelist", false},
+	}
+	for _, tst := range tests {
+		if err := ValidateSourceURL(tst.url); (err == nil) != tst.valid {
+			t.Errorf("%s: got %v, want valid=%t", tst.url, err, tst.valid)
+		}
+	}
+}
+
+func TestPoller(t *testing.T) {
+	f, err := ioutil.TempFile("", "poller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("v1")
+	f.Close()
+
+	var loaded []string
+	reject := false
+	p, err := NewPoller(f.Name(), "", time.Hour, func(buf []byte) error {
+		if reject {
+			return errors.New("rejected")
+		}
+		loaded = append(loaded, string(buf))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		data    string
+		reject  bool
+		err     bool
+		loaded  int
+		comment string
+	}{
+		{"v1", false, false, 1, "first fetch"},
+		{"v1", false, false, 1, "unchanged documents are not loaded"},
+		{"v2", true, true, 1, "rejected document"},
+		{"v2", false, false, 2, "rejected documents are loaded again"},
+	}
+	for _, s := range steps {
+		ioutil.WriteFile(f.Name(), []byte(s.data), 0644)
+		reject = s.reject
+		if err := p.Poll(); (err != nil) != s.err {
+			t.Errorf("%s: got error %v, want error %v", s.comment, err, s.err)
+		}
+		if len(loaded) != s.loaded {
+			t.Errorf("%s: got %d loads, want %d", s.comment, len(loaded), s.loaded)
+		}
+	}
+	os.Remove(f.Name())
+	if err := p.Poll(); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	// Start polls immediately, Stop ends the loop
+	ioutil.WriteFile(f.Name(), []byte("v1"), 0644)
+	done := make(chan bool, 1)
+	p, _ = NewPoller(f.Name(), "", time.Hour, func(buf []byte) error {
+		done <- true
+		return nil
+	})
+	p.Start()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Start did not poll")
+	}
+	p.Stop()
+}
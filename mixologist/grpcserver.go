@@ -0,0 +1,26 @@
+package mixologist
+
+import (
+	"log"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// NewGRPCServer -- return a grpc server with the ServiceController service registered
+// against the given server. Every unary call is access logged the same way as the http handler.
+func NewGRPCServer(server ServiceControllerServer, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.UnaryInterceptor(grpcAccessLog))
+	s := grpc.NewServer(opts...)
+	RegisterServiceControllerServer(s, server)
+	return s
+}
+
+// grpcAccessLog -- unary interceptor that logs method, status code and latency
+func grpcAccessLog(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	t := time.Now()
+	resp, err := handler(ctx, req)
+	log.Printf("AccessLog: %s %s %s", grpc.Code(err), info.FullMethod, time.Now().Sub(t).String())
+	return resp, err
+}
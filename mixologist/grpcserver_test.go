@@ -0,0 +1,87 @@
+package mixologist_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/cloudendpoints/mixologist/fakes"
+	. "github.com/cloudendpoints/mixologist/mixologist"
+	"github.com/cloudendpoints/mixologist/testutils"
+	"github.com/golang/protobuf/proto"
+	gn "github.com/onsi/ginkgo"
+	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+var _ = gn.Describe("GRPCServer", func() {
+	const (
+		serviceName = "service007"
+	)
+	var (
+		ctrl        = fakes.NewController()
+		srv         *grpc.Server
+		conn        *grpc.ClientConn
+		clnt        ServiceControllerClient
+		operationId string
+	)
+	gn.BeforeEach(func() {
+		ctrl = fakes.NewController()
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		g.Expect(err).Should(g.BeNil())
+		srv = NewGRPCServer(ctrl)
+		go srv.Serve(lis)
+		conn, err = grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		g.Expect(err).Should(g.BeNil())
+		clnt = NewServiceControllerClient(conn)
+		operationId = fakes.UUID()
+	})
+	gn.AfterEach(func() {
+		conn.Close()
+		srv.Stop()
+	})
+	gn.Describe("Given: NewGRPCServer()", func() {
+		gn.Context("when: called with Check rpc", func() {
+			gn.It("then: Should deliver the message to controller.Check() ", func() {
+				rqpb := testutils.CreateCheck(
+					&testutils.ExpectedCheck{
+						ServiceName:   serviceName,
+						OperationName: "getfiles",
+						OperationId:   operationId,
+					})
+				resp, err := clnt.Check(context.Background(), &rqpb)
+				g.Expect(err).Should(g.BeNil())
+				g.Expect(resp.OperationId).Should(g.Equal(operationId))
+				g.Expect(proto.Equal(&rqpb, ctrl.SpyCR)).To(g.BeTrue())
+			})
+		})
+		gn.Context("when: called with Report rpc", func() {
+			gn.It("then: Should deliver the message to controller.Report() ", func() {
+				rqpb := testutils.CreateReport(
+					&testutils.ExpectedReport{
+						ApiName:     serviceName,
+						ApiMethod:   "getfiles",
+						OperationId: operationId,
+					})
+				_, err := clnt.Report(context.Background(), &rqpb)
+				g.Expect(err).Should(g.BeNil())
+				g.Expect(proto.Equal(&rqpb, ctrl.SpyRR)).To(g.BeTrue())
+			})
+		})
+		gn.Context("when: controller.Check returns error", func() {
+			gn.It("then: returns the error to the client", func() {
+				rqpb := testutils.CreateCheck(
+					&testutils.ExpectedCheck{
+						ServiceName: serviceName,
+						OperationId: operationId,
+					})
+				ctrl.PlantedError = errors.New("Check Returned Error")
+				_, err := clnt.Check(context.Background(), &rqpb)
+				g.Expect(err).ShouldNot(g.BeNil())
+				g.Expect(grpc.Code(err)).Should(g.Equal(codes.Unknown))
+				g.Expect(grpc.ErrorDesc(err)).Should(g.Equal(ctrl.PlantedError.Error()))
+			})
+		})
+	})
+})
@@ -0,0 +1,109 @@
+package mixologist
+
+import (
+	sc "google/api/servicecontrol/v1"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// The vendored service_controller.pb.go is generated without the grpc plugin,
+// so the ServiceController service glue lives here instead of in vendor/.
+
+const (
+	// ServiceControllerService -- fully qualified grpc service name
+	ServiceControllerService = "google.api.servicecontrol.v1.ServiceController"
+	checkMethod              = "/" + ServiceControllerService + "/Check"
+	reportMethod             = "/" + ServiceControllerService + "/Report"
+)
+
+type (
+	// ServiceControllerClient -- grpc client of the ServiceController service
+	ServiceControllerClient interface {
+		Check(ctx context.Context, in *sc.CheckRequest, opts ...grpc.CallOption) (*sc.CheckResponse, error)
+		Report(ctx context.Context, in *sc.ReportRequest, opts ...grpc.CallOption) (*sc.ReportResponse, error)
+	}
+
+	serviceControllerClient struct {
+		cc *grpc.ClientConn
+	}
+)
+
+// NewServiceControllerClient -- return a ServiceController client using cc
+func NewServiceControllerClient(cc *grpc.ClientConn) ServiceControllerClient {
+	return &serviceControllerClient{cc}
+}
+
+func (c *serviceControllerClient) Check(ctx context.Context, in *sc.CheckRequest, opts ...grpc.CallOption) (*sc.CheckResponse, error) {
+	out := new(sc.CheckResponse)
+	if err := grpc.Invoke(ctx, checkMethod, in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serviceControllerClient) Report(ctx context.Context, in *sc.ReportRequest, opts ...grpc.CallOption) (*sc.ReportResponse, error) {
+	out := new(sc.ReportResponse)
+	if err := grpc.Invoke(ctx, reportMethod, in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RegisterServiceControllerServer -- register srv as the ServiceController service of s
+func RegisterServiceControllerServer(s *grpc.Server, srv ServiceControllerServer) {
+	s.RegisterService(&serviceControllerDesc, srv)
+}
+
+func checkHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(sc.CheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceControllerServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: checkMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceControllerServer).Check(ctx, req.(*sc.CheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func reportHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(sc.ReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceControllerServer).Report(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: reportMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceControllerServer).Report(ctx, req.(*sc.ReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var serviceControllerDesc = grpc.ServiceDesc{
+	ServiceName: ServiceControllerService,
+	HandlerType: (*ServiceControllerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Check",
+			Handler:    checkHandler,
+		},
+		{
+			MethodName: "Report",
+			Handler:    reportHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "google/api/servicecontrol/v1/service_controller.proto",
+}
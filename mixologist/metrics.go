@@ -1,5 +1,10 @@
 package mixologist
 
+import (
+	sc "google/api/servicecontrol/v1"
+	"strings"
+)
+
 const (
 	// Metrics names, etc. -- TODO(dougreid): refactor into metrics package
 	ProducerRequestCount           = "serviceruntime.googleapis.com/api/producer/request_count"
@@ -49,3 +54,21 @@ type ExponentialDistribution struct {
 	StartValue   float64
 	GrowthFactor float64
 }
+
+// MetricLabel -- label of a metric value, falling back to the label of its operation
+func MetricLabel(mv *sc.MetricValue, op *sc.Operation, key string) string {
+	if v, found := mv.GetLabels()[key]; found {
+		return v
+	}
+	return op.GetLabels()[key]
+}
+
+// MatchID -- id is in ids, a trailing * matches a prefix
+func MatchID(ids []string, id string) bool {
+	for _, e := range ids {
+		if e == id || (strings.HasSuffix(e, "*") && strings.HasPrefix(id, e[:len(e)-1])) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package mixologist
+
+import (
+	sc "google/api/servicecontrol/v1"
+	"testing"
+)
+
+func TestMetricLabel(t *testing.T) {
+	op := &sc.Operation{Labels: map[string]string{ResponseCode: "200", Protocol: "http"}}
+	mv := &sc.MetricValue{Labels: map[string]string{ResponseCode: "503"}}
+	for key, want := range map[string]string{ResponseCode: "503", Protocol: "http", StatusCode: ""} {
+		if got := MetricLabel(mv, op, key); got != want {
+			t.Errorf("MetricLabel(%s) = %#v, want %#v", key, got, want)
+		}
+	}
+}
+
+func TestMatchID(t *testing.T) {
+	ids := []string{"api_key:aaaa", "project:internal-*"}
+	for id, want := range map[string]bool{
+		"api_key:aaaa":           true,
+		"api_key:aaaab":          false,
+		"project:internal-":      true,
+		"project:internal-tools": true,
+		"project:other":          false,
+		"":                       false,
+	} {
+		if got := MatchID(ids, id); got != want {
+			t.Errorf("MatchID(%#v) = %v, want %v", id, got, want)
+		}
+	}
+}
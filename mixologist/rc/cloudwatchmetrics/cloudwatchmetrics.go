@@ -10,11 +10,18 @@
 // Then, one must create a kubernetes secret in the namespace that mixologist will be
 // run in. Then the mixologist RC must be modified to mount the volume to /etc/aws.
 //
-// In the future, there will likely be a better, more dynamic way of passing in creds for
-// use in this package.`
+// Every reporter instance may override the region, credentials file, profile and
+// metric namespace in its params. ex:
+//
+//	reporters:
+//	- kind: aws/cloudwatchmetrics
+//	  params:
+//	      region: us-east-1
+//	      credentialsfile: /etc/aws-east/credentials.ini
 package cloudwatchmetrics
 
 import (
+	"errors"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -32,14 +39,16 @@ const (
 	// Name is the unique identifier for this adapter
 	Name = "aws/cloudwatchmetrics"
 
-	// Region selects the AWS region (and endpoint) to send logs.
-	// TODO: make a configuration option
+	// Region selects the default AWS region (and endpoint) to send logs.
 	Region = "us-west-2" // US West (Oregon) us-west-2 logs.us-west-2.amazonaws.com HTTPS
 
-	// creds details (const for now -- could move into supplier)
+	// default creds details
 	svcAcctFile    = "/etc/aws/credentials.ini"
 	svcAcctProfile = "default"
 
+	// default namespace of published metrics
+	namespace = "mixologist.io"
+
 	// used for adding unit values to distribution metrics
 	// Valid Values: Seconds | Microseconds | Milliseconds | Bytes | Kilobytes | Megabytes | Gigabytes | Terabytes | Bits | Kilobits | Megabits | Gigabits | Terabits | Percent | Count | Bytes/Second | Kilobytes/Second | Megabytes/Second | Gigabytes/Second | Terabytes/Second | Bits/Second | Kilobits/Second | Megabits/Second | Gigabits/Second | Terabits/Second | Count/Second | None
 	timeUnit = "Seconds"
@@ -68,8 +77,21 @@ func init() {
 }
 
 type (
+	// Config -- per instance configuration
+	Config struct {
+		// Region -- AWS region. default: Region
+		Region string
+		// CredentialsFile -- shared credentials file
+		CredentialsFile string
+		// Profile -- profile within CredentialsFile
+		Profile string
+		// Namespace -- CloudWatch namespace of published metrics
+		Namespace string
+	}
+
 	consumer struct {
-		cw cloudwatchiface.CloudWatchAPI
+		cw        cloudwatchiface.CloudWatchAPI
+		namespace string
 	}
 
 	builder struct{}
@@ -174,7 +196,7 @@ func (c *consumer) Publish(m []*cloudwatch.MetricDatum) error {
 
 	params := &cloudwatch.PutMetricDataInput{
 		MetricData: m,
-		Namespace:  aws.String("mixologist.io"), // Required
+		Namespace:  aws.String(c.namespace), // Required
 	}
 
 	glog.Infof("publishing metrics to aws: %v", params)
@@ -227,12 +249,34 @@ func (c *consumer) GetPrefixAndHandler() *mixologist.PrefixAndHandler {
 	return nil
 }
 
+// ConfigStruct returns the default configuration.
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{
+		Region:          Region,
+		CredentialsFile: svcAcctFile,
+		Profile:         svcAcctProfile,
+		Namespace:       namespace,
+	}
+}
+
+// ValidateConfig ensures region and namespace are set.
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	c := cfg.(*Config)
+	if c.Region == "" {
+		return errors.New(Name + ": missing region")
+	}
+	if c.Namespace == "" {
+		return errors.New(Name + ": missing namespace")
+	}
+	return nil
+}
+
 // BuildConsumer builds the adapter based on the configuration options passed in via the
 // config struct.
-func (b *builder) BuildConsumer(c mixologist.Config) (cc mixologist.ReportConsumer, err error) {
-
-	creds := credentials.NewSharedCredentials(svcAcctFile, svcAcctProfile)
-	config := aws.NewConfig().WithCredentials(creds).WithRegion(Region)
+func (b *builder) BuildConsumer(c mixologist.Config, params interface{}) (cc mixologist.ReportConsumer, err error) {
+	cfg := params.(*Config)
+	creds := credentials.NewSharedCredentials(cfg.CredentialsFile, cfg.Profile)
+	config := aws.NewConfig().WithCredentials(creds).WithRegion(cfg.Region)
 	sess, err := session.NewSession(config)
 	if err != nil {
 		glog.Errorf("could not create aws cloudwatchlogs session: %v", err)
@@ -240,5 +284,5 @@ func (b *builder) BuildConsumer(c mixologist.Config) (cc mixologist.ReportConsum
 		return nil, err
 	}
 	svc := cloudwatch.New(sess)
-	return &consumer{cw: svc}, nil
+	return &consumer{cw: svc, namespace: cfg.Namespace}, nil
 }
@@ -200,7 +200,7 @@ func TestConsume(t *testing.T) {
 
 	for _, v := range consumeTests {
 		f := &fakeAPI{} //returnErr: v.reportErr}
-		consumer := &consumer{cw: f}
+		consumer := &consumer{cw: f, namespace: namespace}
 		consumer.Consume([]*servicecontrol.ReportRequest{v.report})
 
 		// predictable ordering of dimension data allows for better reflect.DeepEqual comparison.
@@ -213,3 +213,18 @@ func TestConsume(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateConfig(t *testing.T) {
+	b := &builder{}
+	cfg := b.ConfigStruct().(*Config)
+	if cfg.Region != Region || cfg.Namespace != namespace {
+		t.Errorf("bad default config: %v", *cfg)
+	}
+	if err := b.ValidateConfig(cfg); err != nil {
+		t.Errorf("default config should be valid: %v", err)
+	}
+	cfg.Region = ""
+	if err := b.ValidateConfig(cfg); err == nil {
+		t.Errorf("config without region should not be valid")
+	}
+}
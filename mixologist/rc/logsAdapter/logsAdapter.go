@@ -29,6 +29,15 @@ func RegisterLogsSink(name string, b mixologist.LoggerBuilder) {
 }
 
 type (
+	// Config -- per instance configuration
+	// Unset fields default to mixologist.Config.Logging
+	Config struct {
+		// Backends -- names of registered logs sinks
+		Backends []string `yaml:",omitempty"`
+		// UseDefault -- also log to std{out|err}
+		UseDefault *bool `yaml:",omitempty"`
+	}
+
 	consumer struct {
 		loggers []mixologist.Logger
 	}
@@ -151,6 +160,13 @@ func (c *consumer) Consume(reportMsgs []*sc.ReportRequest) (err error) {
 	return nil
 }
 
+// Close -- flush all loggers
+func (c *consumer) Close() {
+	for _, v := range c.loggers {
+		v.Flush()
+	}
+}
+
 // GetName interface method
 func (c *consumer) GetName() string {
 	return Name
@@ -161,7 +177,29 @@ func (c *consumer) GetPrefixAndHandler() *mixologist.PrefixAndHandler {
 	return nil
 }
 
-func (b *builder) BuildConsumer(c mixologist.Config) (mixologist.ReportConsumer, error) {
+// ConfigStruct -- defaults to global logging config
+func (b *builder) ConfigStruct() interface{} {
+	return &Config{}
+}
+
+// ValidateConfig -- unknown backends are skipped at build time
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	for _, be := range cfg.(*Config).Backends {
+		if _, ok := plugins[be]; !ok {
+			glog.Warningf("Unknown logs backend '%s'", be)
+		}
+	}
+	return nil
+}
+
+func (b *builder) BuildConsumer(c mixologist.Config, params interface{}) (mixologist.ReportConsumer, error) {
+	cfg := params.(*Config)
+	if cfg.Backends != nil {
+		c.Logging.Backends = cfg.Backends
+	}
+	if cfg.UseDefault != nil {
+		c.Logging.UseDefault = *cfg.UseDefault
+	}
 	glog.Infof("adding consumer with config: %v", c)
 	cons := &consumer{}
 	for _, be := range c.Logging.Backends {
@@ -125,7 +125,7 @@ func TestConsume(t *testing.T) {
 	}
 
 	b := &builder{}
-	c, _ := b.BuildConsumer(mixologist.Config{})
+	c, _ := b.BuildConsumer(mixologist.Config{}, b.ConfigStruct())
 
 	for _, v := range consumeTests {
 
@@ -0,0 +1,31 @@
+package prometheus
+
+import (
+	"github.com/cloudendpoints/mixologist/mixologist"
+	pc "github.com/prometheus/client_golang/prometheus"
+)
+
+var decisionDesc = pc.NewDesc(
+	"mixologist_check_decisions_total",
+	"Decisions of checkers with rollout params, by enforcement mode",
+	[]string{"service", "kind", "id", "mode", "decision"},
+	nil,
+)
+
+// decisionCollector -- exports the decision counts recorded by the CheckerManager
+// so that shadow decisions can be compared with enforced ones
+type decisionCollector struct {
+	decisions func() map[mixologist.DecisionKey]int64
+}
+
+// Describe -- Collector#Describe
+func (c *decisionCollector) Describe(ch chan<- *pc.Desc) {
+	ch <- decisionDesc
+}
+
+// Collect -- Collector#Collect
+func (c *decisionCollector) Collect(ch chan<- pc.Metric) {
+	for k, v := range c.decisions() {
+		ch <- pc.MustNewConstMetric(decisionDesc, pc.CounterValue, float64(v), k.Service, k.Kind, k.ID, k.Mode, k.Decision)
+	}
+}
@@ -56,12 +56,24 @@ func getMetricsMap(metricNames [][]string) map[string]*pc.SummaryVec {
 			},
 			[]string{"service", "api_method"},
 		)
-		mm[metricName[0]] = m
-		pc.MustRegister(m)
+		mm[metricName[0]] = register(m).(*pc.SummaryVec)
 	}
 	return mm
 }
 
+// register -- register c with the default registry.
+// All instances of this consumer share collectors, so if an equal collector
+// is already registered the existing one is returned.
+func register(c pc.Collector) pc.Collector {
+	if err := pc.Register(c); err != nil {
+		if are, ok := err.(pc.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
 func newCounterVec(name, desc string, labels []string) *pc.CounterVec {
 	c := pc.NewCounterVec(
 		pc.CounterOpts{
@@ -250,11 +262,24 @@ func (p *consumer) GetPrefixAndHandler() *mixologist.PrefixAndHandler {
 }
 
 /* Implements ReportConsumerBuilder */
+// ConfigStruct -- prometheus has no per instance configuration
+func (s *builder) ConfigStruct() interface{} {
+	return &Config{}
+}
+
+// ValidateConfig -- nothing to validate
+func (s *builder) ValidateConfig(cfg interface{}) error {
+	return nil
+}
+
 // New -- Returns a new prometheus consumer
-func (s *builder) BuildConsumer(c mixologist.Config) (mixologist.ReportConsumer, error) {
+func (s *builder) BuildConsumer(c mixologist.Config, params interface{}) (mixologist.ReportConsumer, error) {
 	// only register when actually built
 	for _, m := range metrics {
-		pc.MustRegister(m.(pc.Collector))
+		register(m.(pc.Collector))
+	}
+	if c.Decisions != nil {
+		register(&decisionCollector{decisions: c.Decisions.Decisions})
 	}
 	return &consumer{
 		MetricSummaryMap: getMetricsMap([][]string{
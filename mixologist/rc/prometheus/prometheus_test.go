@@ -202,3 +202,44 @@ func newHistogramMetricProto(counts []int64, sum float64, bounds []float64) *dto
 	}
 	return &dto.Metric{Histogram: newHistogramProto(count, sum, newBuckets(counts, bounds))}
 }
+
+func TestBuildConsumerTwice(t *testing.T) {
+	b := &builder{}
+	c0, err := b.BuildConsumer(mixologist.Config{}, b.ConfigStruct())
+	if err != nil {
+		t.Fatalf("first BuildConsumer() => %v", err)
+	}
+	c1, err := b.BuildConsumer(mixologist.Config{}, b.ConfigStruct())
+	if err != nil {
+		t.Fatalf("second BuildConsumer() => %v", err)
+	}
+	// instances share collectors
+	for k, m := range c0.(*consumer).MetricSummaryMap {
+		if c1.(*consumer).MetricSummaryMap[k] != m {
+			t.Errorf("%s: got a new collector, wanted the registered one", k)
+		}
+	}
+}
+
+func TestDecisionCollector(t *testing.T) {
+	c := &decisionCollector{decisions: func() map[mixologist.DecisionKey]int64 {
+		return map[mixologist.DecisionKey]int64{
+			{Service: testSvc, Kind: "whitelist", Mode: mixologist.ModeShadow, Decision: "IP_ADDRESS_BLOCKED"}: 3,
+		}
+	}}
+	ch := make(chan prometheus.Metric, 1)
+	c.Collect(ch)
+	m := &dto.Metric{}
+	if err := (<-ch).Write(m); err != nil {
+		t.Fatalf("Write() => %v", err)
+	}
+	if got := m.GetCounter().GetValue(); got != 3 {
+		t.Errorf("counter => %v, wanted 3", got)
+	}
+	want := map[string]string{"service": testSvc, "kind": "whitelist", "id": "", "mode": mixologist.ModeShadow, "decision": "IP_ADDRESS_BLOCKED"}
+	for _, lp := range m.GetLabel() {
+		if want[lp.GetName()] != lp.GetValue() {
+			t.Errorf("label %s => %s, wanted %s", lp.GetName(), lp.GetValue(), want[lp.GetName()])
+		}
+	}
+}
@@ -10,6 +10,10 @@ func init() {
 }
 
 type (
+	// Config -- per instance configuration
+	// metrics are served from the default registry, shared by all instances
+	Config struct{}
+
 	consumer struct {
 		MetricSummaryMap map[string]*pc.SummaryVec
 	}
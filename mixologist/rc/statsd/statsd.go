@@ -1,6 +1,7 @@
 package statsd
 
 import (
+	"errors"
 	sd "github.com/cactus/go-statsd-client/statsd"
 	"github.com/golang/glog"
 	sc "google/api/servicecontrol/v1"
@@ -11,7 +12,8 @@ import (
 )
 
 var (
-	// Config contains configuration for a statsd backend.
+	// Config contains the default configuration for a statsd backend.
+	// Reporter instances in ServicesConfig override it with their params.
 	Config ServerConfig
 
 	sizeHistogramBuckets = []float64{1, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7}
@@ -155,9 +157,24 @@ func (c *consumer) GetPrefixAndHandler() *mixologist.PrefixAndHandler {
 	return nil
 }
 
-func (b *builder) BuildConsumer(c mixologist.Config) (cc mixologist.ReportConsumer, err error) {
+// ConfigStruct -- defaults to Config
+func (b *builder) ConfigStruct() interface{} {
+	cfg := Config
+	return &cfg
+}
+
+// ValidateConfig -- an address is required
+func (b *builder) ValidateConfig(cfg interface{}) error {
+	if cfg.(*ServerConfig).Addr == "" {
+		return errors.New("statsd: missing addr")
+	}
+	return nil
+}
+
+func (b *builder) BuildConsumer(c mixologist.Config, params interface{}) (cc mixologist.ReportConsumer, err error) {
+	cfg := params.(*ServerConfig)
 	var client sd.Statter
-	if client, err = sd.NewClient(Config.Addr, ""); err == nil {
+	if client, err = sd.NewClient(cfg.Addr, cfg.Prefix); err == nil {
 		cc = &consumer{
 			client: client,
 		}
@@ -162,3 +162,26 @@ func TestConsume(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigStruct(t *testing.T) {
+	b := &builder{}
+	old := Config
+	defer func() { Config = old }()
+
+	Config = ServerConfig{Addr: "statsd:8125"}
+	cfg := b.ConfigStruct().(*ServerConfig)
+	if !reflect.DeepEqual(*cfg, Config) {
+		t.Errorf("ConfigStruct() => %v, wanted %v", *cfg, Config)
+	}
+	// instances do not share config
+	cfg.Addr = "other:8125"
+	if Config.Addr != "statsd:8125" {
+		t.Errorf("ConfigStruct() modified defaults: %v", Config)
+	}
+	if err := b.ValidateConfig(cfg); err != nil {
+		t.Errorf("ValidateConfig(%v) => %v, wanted nil", *cfg, err)
+	}
+	if err := b.ValidateConfig(&ServerConfig{}); err == nil {
+		t.Errorf("ValidateConfig() without addr => nil, wanted error")
+	}
+}
@@ -12,7 +12,10 @@ func init() {
 type (
 	// ServerConfig contains configuration info for a statsd backend
 	ServerConfig struct {
+		// Addr -- host:port of the statsd backend
 		Addr string
+		// Prefix -- prepended to every metric name
+		Prefix string
 	}
 	consumer struct {
 		client sd.Statter
@@ -2,16 +2,41 @@ package mixologist
 
 import (
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	sc "google/api/servicecontrol/v1"
 )
 
+type (
+	// reporterKey -- identifies a report consumer instance across config generations
+	reporterKey struct {
+		instanceKey
+		BatchParams BatchParams
+	}
+
+	// reporterState -- a config generation and the report consumers it references
+	reporterState struct {
+		cfg       *ServicesConfig
+		consumers map[reporterKey]ReportConsumer
+		// byParams -- consumers indexed by the AdapterParams that reference them
+		byParams map[*AdapterParams]ReportConsumer
+		// handlers -- served for the consumers configured by flags and the reporters of cfg
+		handlers []*PrefixAndHandler
+	}
+)
+
 // NewReportConsumerManager -- create a new report consumer manager with the configured list of consumers
 func NewReportConsumerManager(rq chan *sc.ReportRequest, registry map[string]ReportConsumerBuilder, c Config) *ReportConsumerManagerImpl {
 	glog.Infof("creating consumer manager with config: %v", c)
 	consumerImpls := make([]ReportConsumer, 0, len(c.ReportConsumers))
 	for _, consumerName := range c.ReportConsumers {
 		if cn, ok := registry[consumerName]; ok {
-			if cc, err := cn.BuildConsumer(c); cc != nil {
+			// consumers configured by flags use default params
+			params := cn.ConfigStruct()
+			if err := cn.ValidateConfig(params); err != nil {
+				glog.Error("Unable to build consumer: ", consumerName, " ", err)
+				continue
+			}
+			if cc, err := cn.BuildConsumer(c, params); cc != nil {
 				glog.Info("Built consumer: ", consumerName, " ", cc)
 				consumerImpls = append(consumerImpls, cc)
 			} else {
@@ -20,35 +45,212 @@ func NewReportConsumerManager(rq chan *sc.ReportRequest, registry map[string]Rep
 		}
 	}
 	glog.Info("Available Reporters: ", len(consumerImpls))
-	return &ReportConsumerManagerImpl{
+	s := &ReportConsumerManagerImpl{
 		reportQueue: rq,
 		consumers:   consumerImpls,
+		config:      c,
 	}
+	s.reporters.Store(&reporterState{
+		cfg:       &ServicesConfig{},
+		consumers: map[reporterKey]ReportConsumer{},
+		byParams:  map[*AdapterParams]ReportConsumer{},
+		handlers:  prefixAndHandlers(consumerImpls),
+	})
+	return s
 }
 
 // Start -- consumer loop. Start the specified number of threads of consumer manager
 func (s *ReportConsumerManagerImpl) Start(nConsumers int) {
 	glog.Infof("Starting %d ConsumerLoops", nConsumers)
+	s.loops.Add(nConsumers)
 	for i := 0; i < nConsumers; i++ {
 		go s.consumerLoop()
 	}
 }
 
-// ConsumerLoop -- Start consumer loop. This method does not exit
+// Drain -- wait for queued reports to be consumed and close consumers that buffer reports.
+// The report queue must be closed by its sender, see ControllerImpl.Close.
+// Returns ctx.Err() if ctx is done before draining completes.
+func (s *ReportConsumerManagerImpl) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.loops.Wait()
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		closeConsumers(s.consumers)
+		closeConsumers(s.reporterState().list())
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func closeConsumers(consumers []ReportConsumer) {
+	for _, cc := range consumers {
+		if c, ok := cc.(Closer); ok {
+			glog.V(1).Info("Closing consumer: ", cc.GetName())
+			c.Close()
+		}
+	}
+}
+
+// ConfigChange -- build report consumers referenced by cfg and close the ones
+// that are no longer referenced, once reports being consumed are delivered.
+// Consumers whose params did not change are reused.
+// Consumers configured by Config.ReportConsumers receive every report regardless of cfg.
+func (s *ReportConsumerManagerImpl) ConfigChange(cfg *ServicesConfig) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	old := s.reporterState()
+	rs := &reporterState{
+		cfg:       cfg,
+		consumers: make(map[reporterKey]ReportConsumer),
+		byParams:  make(map[*AdapterParams]ReportConsumer),
+	}
+	for _, ac := range cfg.AdapterConfigs() {
+		for _, rp := range validAdapterParams(&ResolveKey{RpcMethod: RPCReport}, ac) {
+			key := newReporterKey(rp)
+			cc, found := rs.consumers[key]
+			if !found {
+				if cc, found = old.consumers[key]; !found {
+					var err error
+					if cc, err = s.buildReporter(rp); err != nil {
+						glog.Error("Unable to build consumer: ", rp.Kind, " ", err)
+						continue
+					}
+				}
+				rs.consumers[key] = cc
+			}
+			rs.byParams[rp] = cc
+		}
+	}
+	rs.handlers = prefixAndHandlers(s.consumers, rs.list())
+	s.reporters.Store(rs)
+
+	var unused []ReportConsumer
+	for key, cc := range old.consumers {
+		if _, found := rs.consumers[key]; !found {
+			unused = append(unused, cc)
+		}
+	}
+	// consumer loops that loaded the old state are done with it once they release consuming
+	s.consuming.Lock()
+	s.consuming.Unlock()
+	closeConsumers(unused)
+	glog.Infof("Installed %d configured Reporters, closed %d", len(rs.consumers), len(unused))
+}
+
+func (s *ReportConsumerManagerImpl) buildReporter(rp *AdapterParams) (ReportConsumer, error) {
+	ru := rp.Params.(*RuntimeAdapterState)
+	cc, err := ru.Builder.(ReportConsumerBuilder).BuildConsumer(s.config, ru.TypedParams)
+	if cc == nil {
+		return nil, err
+	}
+	glog.Info("Built consumer: ", rp.Kind, " ", cc)
+	if rp.BatchParams.Enabled() {
+		glog.Infof("Batching consumer: %s %#v", rp.Kind, rp.BatchParams)
+		cc = BatchingConsumer(cc, rp.BatchParams.BatchingConfig())
+	}
+	return cc, nil
+}
+
+func newReporterKey(rp *AdapterParams) reporterKey {
+	return reporterKey{
+		instanceKey: rp.Params.(*RuntimeAdapterState).key,
+		BatchParams: rp.BatchParams,
+	}
+}
+
+func (s *ReportConsumerManagerImpl) reporterState() *reporterState {
+	return s.reporters.Load().(*reporterState)
+}
+
+// list -- all report consumers of this generation
+func (rs *reporterState) list() []ReportConsumer {
+	retval := make([]ReportConsumer, 0, len(rs.consumers))
+	for _, cc := range rs.consumers {
+		retval = append(retval, cc)
+	}
+	return retval
+}
+
+// resolve -- split reportMsg by consumer and return the report for every
+// configured report consumer. Operations are only sent to the report consumers
+// resolved for their consumer.
+func (rs *reporterState) resolve(reportMsg *sc.ReportRequest) map[ReportConsumer]*sc.ReportRequest {
+	retval := make(map[ReportConsumer]*sc.ReportRequest)
+	if len(rs.consumers) == 0 {
+		return retval
+	}
+	for _, op := range reportMsg.Operations {
+		var source string
+		if op != nil {
+			source = op.ConsumerId
+		}
+		reporters := rs.cfg.Resolve(&ResolveKey{
+			Source:      source,
+			Destination: reportMsg.ServiceName,
+			RpcMethod:   RPCReport,
+		})
+		for _, rp := range reporters {
+			cc, found := rs.byParams[rp]
+			if !found {
+				continue
+			}
+			req, found := retval[cc]
+			if !found {
+				req = &sc.ReportRequest{ServiceName: reportMsg.ServiceName}
+				retval[cc] = req
+			}
+			// the same consumer may be resolved more than once for an operation
+			if n := len(req.Operations); n == 0 || req.Operations[n-1] != op {
+				req.Operations = append(req.Operations, op)
+			}
+		}
+	}
+	return retval
+}
+
+// ConsumerLoop -- Start consumer loop. Exits once the report queue is closed
 func (s *ReportConsumerManagerImpl) consumerLoop() {
+	defer s.loops.Done()
 	for reportMsg := range s.reportQueue {
+		s.consuming.RLock()
 		for _, cc := range s.consumers {
-			cc.Consume([]*sc.ReportRequest{reportMsg})
+			if err := cc.Consume([]*sc.ReportRequest{reportMsg}); err != nil {
+				glog.Warning(cc.GetName(), " unable to consume report ", err)
+			}
+		}
+		for cc, req := range s.reporterState().resolve(reportMsg) {
+			if err := cc.Consume([]*sc.ReportRequest{req}); err != nil {
+				glog.Warning(cc.GetName(), " unable to consume report ", err)
+			}
 		}
+		s.consuming.RUnlock()
 	}
 }
 
-// GetPrefixAndHandlers -- Gather all the prefixes and handler from consumer, if any
+// GetPrefixAndHandlers -- prefixes and handlers of the consumers configured by flags
+// and of the reporters of the current config, see ReportHandlersFrom
 func (s *ReportConsumerManagerImpl) GetPrefixAndHandlers() []*PrefixAndHandler {
-	retval := make([]*PrefixAndHandler, 0, len(s.consumers))
-	for _, cc := range s.consumers {
-		if ph := cc.GetPrefixAndHandler(); ph != nil {
-			retval = append(retval, ph)
+	return s.reporterState().handlers
+}
+
+// prefixAndHandlers -- gather the prefixes and handlers of consumers, if any.
+// A prefix is served by the first consumer that claims it
+func prefixAndHandlers(consumers ...[]ReportConsumer) []*PrefixAndHandler {
+	retval := []*PrefixAndHandler{}
+	seen := make(map[string]bool)
+	for _, ccs := range consumers {
+		for _, cc := range ccs {
+			if ph := cc.GetPrefixAndHandler(); ph != nil && !seen[ph.Prefix] {
+				seen[ph.Prefix] = true
+				retval = append(retval, ph)
+			}
 		}
 	}
 	return retval
@@ -3,9 +3,14 @@ package mixologist_test
 import (
 	gn "github.com/onsi/ginkgo"
 	g "github.com/onsi/gomega"
+	"golang.org/x/net/context"
 	sc "google/api/servicecontrol/v1"
+	"sync"
+	"time"
+
 	"github.com/cloudendpoints/mixologist/fakes"
 	. "github.com/cloudendpoints/mixologist/mixologist"
+	"gopkg.in/yaml.v2"
 )
 
 var _ = gn.Describe("ReportConsumerManager", func() {
@@ -16,6 +21,13 @@ var _ = gn.Describe("ReportConsumerManager", func() {
 		rcbuilder1 = fakes.NewBuilder(name1, nil)
 		rqChan     chan *sc.ReportRequest
 		rcMgr      *ReportConsumerManagerImpl
+		newConfig  = func(yml string) *ServicesConfig {
+			cfg := ServicesConfig{}
+			g.Expect(yaml.Unmarshal([]byte(yml), &cfg)).To(g.Succeed())
+			cfg, erra := ConvertReporterParams(cfg, ReportConsumerRegistry)
+			g.Expect(erra).To(g.BeEmpty())
+			return &cfg
+		}
 	)
 	gn.Describe("Given: NewReportConsumerManager()", func() {
 		gn.BeforeEach(func() {
@@ -60,4 +72,268 @@ var _ = gn.Describe("ReportConsumerManager", func() {
 			})
 		})
 	})
+	gn.Describe("Given: ConfigChange() with BatchParams", func() {
+		gn.BeforeEach(func() {
+			rcbuilder0 = fakes.NewBuilder(name0, nil)
+			rcbuilder1 = fakes.NewBuilder(name1, nil)
+			rqChan = make(chan *sc.ReportRequest)
+			ReportConsumerRegistry = make(map[string]ReportConsumerBuilder)
+			RegisterReportConsumer(name0, rcbuilder0)
+			RegisterReportConsumer(name1, rcbuilder1)
+			rcMgr = NewReportConsumerManager(rqChan, ReportConsumerRegistry, Config{})
+			rcMgr.ConfigChange(newConfig("_EVERY_SERVICE_:\n  ingress:\n    reporters:\n    - kind: testRC0\n      batchparams:\n        size: 3\n        timeoutsec: 60\n    - kind: testRC1\n"))
+		})
+		gn.Context("when: messages are reported", func() {
+			gn.It("then: batched consumers receive batches, others receive single messages", func() {
+				req := []*sc.ReportRequest{
+					{ServiceName: "service1", Operations: []*sc.Operation{{ConsumerId: "api_key:aaaa"}}},
+					{ServiceName: "service1", Operations: []*sc.Operation{{ConsumerId: "api_key:bbbb"}}},
+					{ServiceName: "service2", Operations: []*sc.Operation{{ConsumerId: "api_key:aaaa"}}},
+				}
+				rcMgr.Start(1)
+				for i := 0; i < len(req); i++ {
+					rqChan <- req[i]
+				}
+				g.Eventually(func() []*sc.ReportRequest {
+					return rcbuilder0.Consumer.GetMessages()
+				}).Should(g.HaveLen(len(req)))
+				g.Eventually(func() []*sc.ReportRequest {
+					return rcbuilder1.Consumer.GetMessages()
+				}).Should(g.HaveLen(len(req)))
+				g.Expect(rcbuilder0.Consumer.GetBatches()).Should(g.Equal(1))
+				g.Expect(rcbuilder1.Consumer.GetBatches()).Should(g.Equal(len(req)))
+			})
+		})
+	})
+	gn.Describe("Given: Drain() after the report queue is closed", func() {
+		gn.BeforeEach(func() {
+			rcbuilder0 = fakes.NewBuilder(name0, nil)
+			rqChan = make(chan *sc.ReportRequest, 3)
+			ReportConsumerRegistry = make(map[string]ReportConsumerBuilder)
+			RegisterReportConsumer(name0, rcbuilder0)
+			rcMgr = NewReportConsumerManager(rqChan, ReportConsumerRegistry, Config{})
+			rcMgr.ConfigChange(newConfig("_EVERY_SERVICE_:\n  ingress:\n    reporters:\n    - kind: testRC0\n      batchparams:\n        size: 10\n        timeoutsec: 3600\n"))
+		})
+		gn.Context("when: reports are queued and buffered", func() {
+			gn.It("then: all reports are delivered and consumers are closed", func() {
+				req := []*sc.ReportRequest{
+					{ServiceName: "service1", Operations: []*sc.Operation{{ConsumerId: "api_key:aaaa"}}},
+					{ServiceName: "service1", Operations: []*sc.Operation{{ConsumerId: "api_key:bbbb"}}},
+					{ServiceName: "service2", Operations: []*sc.Operation{{ConsumerId: "api_key:aaaa"}}},
+				}
+				for i := 0; i < len(req); i++ {
+					rqChan <- req[i]
+				}
+				close(rqChan)
+				rcMgr.Start(2)
+				g.Expect(rcMgr.Drain(context.Background())).To(g.Succeed())
+				g.Expect(rcbuilder0.Consumer.GetMessages()).Should(g.HaveLen(len(req)))
+				g.Expect(rcbuilder0.Consumer.IsClosed()).Should(g.BeTrue())
+			})
+		})
+		gn.Context("when: ctx is done before draining completes", func() {
+			gn.It("then: returns ctx.Err()", func() {
+				release := make(chan struct{})
+				defer close(release)
+				ReportConsumerRegistry = map[string]ReportConsumerBuilder{
+					name0: &blockingBuilder{release: release},
+				}
+				rcMgr = NewReportConsumerManager(rqChan, ReportConsumerRegistry, Config{
+					ReportConsumers: []string{name0},
+				})
+				rqChan <- &sc.ReportRequest{}
+				close(rqChan)
+				rcMgr.Start(1)
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				g.Expect(rcMgr.Drain(ctx)).To(g.Equal(context.DeadlineExceeded))
+			})
+		})
+	})
+	gn.Describe("Given: ConfigChange()", func() {
+		var (
+			svc      = "service1"
+			opA      = &sc.Operation{ConsumerId: "api_key:aaaa"}
+			opB      = &sc.Operation{ConsumerId: "api_key:bbbb"}
+			everySvc = "_EVERY_SERVICE_:\n  ingress:\n    reporters:\n    - kind: testRC0\n"
+			bindingA = "service1:\n  consumers:\n    \"api_key:aaaa\":\n      adapters:\n        reporters:\n        - kind: testRC1\n"
+		)
+		gn.BeforeEach(func() {
+			rcbuilder0 = fakes.NewBuilder(name0, nil)
+			rcbuilder1 = fakes.NewBuilder(name1, nil)
+			rqChan = make(chan *sc.ReportRequest)
+			ReportConsumerRegistry = make(map[string]ReportConsumerBuilder)
+			RegisterReportConsumer(name0, rcbuilder0)
+			RegisterReportConsumer(name1, rcbuilder1)
+			rcMgr = NewReportConsumerManager(rqChan, ReportConsumerRegistry, Config{})
+		})
+		gn.Context("when: reporters are configured per service and consumer", func() {
+			gn.It("then: operations are delivered to the reporters resolved for their consumer", func() {
+				rcMgr.ConfigChange(newConfig(everySvc + bindingA))
+				rcMgr.Start(1)
+				rqChan <- &sc.ReportRequest{ServiceName: svc, Operations: []*sc.Operation{opA, opB}}
+
+				g.Eventually(func() []*sc.ReportRequest {
+					return rcbuilder0.Consumer.GetMessages()
+				}).Should(g.HaveLen(1))
+				g.Eventually(func() []*sc.ReportRequest {
+					return rcbuilder1.Consumer.GetMessages()
+				}).Should(g.HaveLen(1))
+				g.Expect(rcbuilder0.Consumer.GetMessages()[0].Operations).Should(g.Equal([]*sc.Operation{opA, opB}))
+				g.Expect(rcbuilder1.Consumer.GetMessages()[0].Operations).Should(g.Equal([]*sc.Operation{opA}))
+			})
+		})
+		gn.Context("when: a new config drops a reporter", func() {
+			gn.It("then: the dropped reporter is closed and the others are reused", func() {
+				rcMgr.ConfigChange(newConfig(everySvc + bindingA))
+				consumer0 := rcbuilder0.Consumer
+				consumer1 := rcbuilder1.Consumer
+				rcMgr.ConfigChange(newConfig(everySvc))
+
+				g.Expect(consumer1.IsClosed()).Should(g.BeTrue())
+				g.Expect(consumer0.IsClosed()).Should(g.BeFalse())
+				g.Expect(rcbuilder0.Consumer).Should(g.BeIdenticalTo(consumer0))
+
+				rcMgr.Start(1)
+				rqChan <- &sc.ReportRequest{ServiceName: svc, Operations: []*sc.Operation{opA}}
+				g.Eventually(func() []*sc.ReportRequest {
+					return consumer0.GetMessages()
+				}).Should(g.HaveLen(1))
+				g.Consistently(func() []*sc.ReportRequest {
+					return consumer1.GetMessages()
+				}, "100ms").Should(g.BeEmpty())
+			})
+		})
+		gn.Context("when: several instances of a kind have different params", func() {
+			gn.It("then: each instance is built with its params and reused by later configs", func() {
+				twoInstances := "_EVERY_SERVICE_:\n  ingress:\n    reporters:\n    - kind: testRC0\n      params:\n        addr: a:1\n    - kind: testRC0\n      params:\n        addr: b:1\n"
+				rcMgr.ConfigChange(newConfig(twoInstances))
+				g.Expect(rcbuilder0.Builds).Should(g.Equal(2))
+				g.Expect(rcbuilder0.Consumer.Params.Addr).Should(g.Equal("b:1"))
+
+				rcMgr.ConfigChange(newConfig(twoInstances))
+				g.Expect(rcbuilder0.Builds).Should(g.Equal(2))
+			})
+		})
+		gn.Context("when: consumers are also configured by flags", func() {
+			gn.It("then: they receive every report alongside the configured reporters", func() {
+				rcMgr = NewReportConsumerManager(rqChan, ReportConsumerRegistry, Config{ReportConsumers: []string{name0}})
+				static := rcbuilder0.Consumer
+				rcMgr.ConfigChange(newConfig(everySvc))
+				g.Expect(rcbuilder0.Consumer).ShouldNot(g.BeIdenticalTo(static))
+				configured := rcbuilder0.Consumer
+
+				rcMgr.Start(1)
+				rqChan <- &sc.ReportRequest{ServiceName: svc, Operations: []*sc.Operation{opA}}
+				g.Eventually(func() []*sc.ReportRequest {
+					return configured.GetMessages()
+				}).Should(g.HaveLen(1))
+				g.Eventually(func() []*sc.ReportRequest {
+					return static.GetMessages()
+				}).Should(g.HaveLen(1))
+
+				rcMgr.ConfigChange(newConfig(""))
+				rqChan <- &sc.ReportRequest{ServiceName: svc, Operations: []*sc.Operation{opA}}
+				g.Eventually(func() []*sc.ReportRequest {
+					return static.GetMessages()
+				}).Should(g.HaveLen(2))
+				g.Expect(configured.GetMessages()).Should(g.HaveLen(1))
+			})
+		})
+		gn.Context("when: reporters serve http", func() {
+			gn.It("then: their handlers are served while they are configured", func() {
+				rcMgr = NewReportConsumerManager(rqChan, ReportConsumerRegistry, Config{})
+				g.Expect(rcMgr.GetPrefixAndHandlers()).Should(g.BeEmpty())
+				rcMgr.ConfigChange(newConfig(everySvc))
+				g.Expect(rcMgr.GetPrefixAndHandlers()).Should(g.HaveLen(1))
+				g.Expect(rcMgr.GetPrefixAndHandlers()[0]).Should(g.BeIdenticalTo(rcbuilder0.Consumer.GetPrefixAndHandler()))
+				rcMgr.ConfigChange(newConfig(""))
+				g.Expect(rcMgr.GetPrefixAndHandlers()).Should(g.BeEmpty())
+			})
+		})
+		gn.Context("when: a dropped reporter is consuming a report", func() {
+			gn.It("then: it is closed once the report is consumed", func() {
+				blocking := &blockingBuilder{release: make(chan struct{})}
+				ReportConsumerRegistry[name0] = blocking
+				rcMgr.ConfigChange(newConfig(everySvc))
+				rcMgr.Start(1)
+				rqChan <- &sc.ReportRequest{ServiceName: svc, Operations: []*sc.Operation{opA}}
+				g.Eventually(blocking.isConsuming).Should(g.BeTrue())
+
+				changed := make(chan struct{})
+				go func() {
+					rcMgr.ConfigChange(newConfig(""))
+					close(changed)
+				}()
+				g.Consistently(changed, "100ms").ShouldNot(g.BeClosed())
+				close(blocking.release)
+				g.Eventually(changed).Should(g.BeClosed())
+				closed, whileConsuming := blocking.isClosed()
+				g.Expect(closed).Should(g.BeTrue())
+				g.Expect(whileConsuming).Should(g.BeFalse())
+			})
+		})
+	})
 })
+
+// blockingBuilder -- builds consumers that block in Consume until release is closed
+type blockingBuilder struct {
+	release chan struct{}
+
+	lock                 sync.Mutex
+	consuming            bool
+	closed               bool
+	closedWhileConsuming bool
+}
+
+func (b *blockingBuilder) ConfigStruct() interface{} {
+	return &struct{}{}
+}
+
+func (b *blockingBuilder) ValidateConfig(interface{}) error {
+	return nil
+}
+
+func (b *blockingBuilder) BuildConsumer(Config, interface{}) (ReportConsumer, error) {
+	return b, nil
+}
+
+func (b *blockingBuilder) GetName() string {
+	return "blocking"
+}
+
+func (b *blockingBuilder) Consume([]*sc.ReportRequest) error {
+	b.setConsuming(true)
+	<-b.release
+	b.setConsuming(false)
+	return nil
+}
+
+func (b *blockingBuilder) GetPrefixAndHandler() *PrefixAndHandler {
+	return nil
+}
+
+func (b *blockingBuilder) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	b.closedWhileConsuming = b.closedWhileConsuming || b.consuming
+}
+
+func (b *blockingBuilder) setConsuming(consuming bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.consuming = consuming
+}
+
+func (b *blockingBuilder) isConsuming() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.consuming
+}
+
+func (b *blockingBuilder) isClosed() (closed bool, whileConsuming bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.closed, b.closedWhileConsuming
+}
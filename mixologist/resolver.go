@@ -1,7 +1,9 @@
 package mixologist
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/golang/glog"
 )
@@ -10,34 +12,126 @@ type (
 	RuntimeAdapterState struct {
 		// Path to this node
 		Path string
+		// Service -- key of the ServicesConfig entry of this node
+		Service string
 		// error encountered during conversion if any
 		ConvertionError error
 		TypedParams     interface{}
 		Params          interface{}
 		Builder         interface{}
+		// key -- identifies the adapter instance built from TypedParams
+		key instanceKey
+	}
+
+	// instanceKey -- identifies an adapter instance by value across config generations
+	instanceKey struct {
+		Kind   string
+		Params string
 	}
 )
 
 // Resolve -- Given a services config resolve it to an array
 // of Adapters that should be dispatched.
+// AdapterConfigs are applied from the least to the most specific scope:
+// _EVERY_SERVICE_ Ingress, Egress and Self; Egress of the source;
+// Self and Ingress of the destination; Producers bindings of the source
+// to the destination; Consumers bindings of the destination to the source.
+// An adapter with an ID replaces, in place, an adapter of the same Kind and ID
+// applied before it. Disable drops adapters applied before it by ID.
 // Note: config (cfg) is readonly -- so no locking is needed
 // 	when Resolve runs concurrently
-// TODO Add treatment of AdapterParams which includes caching and batching
-func (cfg ServicesConfig) Resolve(msg *ResolveKey) (cp []*ConstructorParams) {
+func (cfg ServicesConfig) Resolve(msg *ResolveKey) (ap []*AdapterParams) {
+	var acs []*AdapterConfig
 	if all, found := cfg[EveryService]; found {
-		cp = append(cp, constructorParams(msg, all.Ingress, all.Egress, all.Self)...)
+		acs = append(acs, all.Ingress, all.Egress, all.Self)
+	}
+	src, srcFound := cfg[msg.Source]
+	srcFound = srcFound && msg.Source != EveryService
+	dest, destFound := cfg[msg.Destination]
+	destFound = destFound && msg.Destination != EveryService
+	if srcFound {
+		acs = append(acs, src.Egress)
+	}
+	if destFound {
+		acs = append(acs, dest.Self, dest.Ingress)
 	}
-	if src, found := cfg[msg.Source]; found {
-		cp = append(cp, constructorParams(msg, src.Egress)...)
+	if srcFound {
+		acs = append(acs, bindings(src.Producers, msg.Destination)...)
 	}
-	if dest, found := cfg[msg.Destination]; found {
-		cp = append(cp, constructorParams(msg, dest.Ingress)...)
-		if bnd, found := dest.Consumers[msg.Source]; found {
-			cp = append(cp, constructorParams(msg, bnd.Adapters)...)
+	if destFound {
+		acs = append(acs, bindings(dest.Consumers, msg.Source)...)
+	}
+	for _, ac := range acs {
+		ap = applyAdapterConfig(ap, msg, ac)
+	}
+	glog.V(2).Infof("Resolved: %#v ==> %#v", *msg, len(ap))
+	return ap
+}
+
+// bindings -- adapter configs of bindings with service, ordered by binding id.
+// A binding matches by its ServiceID or by its key
+func bindings(bnds map[string]*BindingConfig, service string) []*AdapterConfig {
+	var ids []string
+	for id, bnd := range bnds {
+		if bnd != nil && (id == service || bnd.ServiceID == service) {
+			ids = append(ids, id)
 		}
 	}
-	glog.V(2).Infof("Resolved: %#v ==> %#v", *msg, len(cp))
-	return cp
+	sort.Strings(ids)
+	acs := make([]*AdapterConfig, 0, len(ids))
+	for _, id := range ids {
+		acs = append(acs, bnds[id].Adapters)
+	}
+	return acs
+}
+
+// applyAdapterConfig -- apply ac on top of adapters ap resolved from less specific scopes
+func applyAdapterConfig(ap []*AdapterParams, msg *ResolveKey, ac *AdapterConfig) []*AdapterParams {
+	if ac == nil {
+		return ap
+	}
+	if len(ac.Disable) > 0 {
+		kept := ap[:0]
+		for _, a := range ap {
+			if a.ID != "" && contains(ac.Disable, a.ID) {
+				glog.V(2).Infof("%s %s disabled", a.Kind, a.ID)
+				continue
+			}
+			kept = append(kept, a)
+		}
+		ap = kept
+	}
+	for _, a := range validAdapterParams(msg, ac) {
+		if idx := indexOf(ap, a); idx >= 0 {
+			glog.V(2).Infof("%s %s overridden", a.Kind, a.ID)
+			ap[idx] = a
+			continue
+		}
+		ap = append(ap, a)
+	}
+	return ap
+}
+
+// indexOf -- index of the adapter in ap with the Kind and ID of a, -1 if a has no ID
+func indexOf(ap []*AdapterParams, a *AdapterParams) int {
+	if a.ID == "" {
+		return -1
+	}
+	for idx, b := range ap {
+		if b.ID == a.ID && b.Kind == a.Kind {
+			return idx
+		}
+	}
+	return -1
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
 }
 
 func adapterParams(ac *AdapterConfig, msg *ResolveKey) []*AdapterParams {
@@ -50,9 +144,9 @@ func adapterParams(ac *AdapterConfig, msg *ResolveKey) []*AdapterParams {
 	return nil
 }
 
-// constructorParams -- Filter adapterconfig and return valid constroctorParams
-func constructorParams(msg *ResolveKey, acs ...*AdapterConfig) []*ConstructorParams {
-	cp := []*ConstructorParams{}
+// validAdapterParams -- Filter adapterconfig and return valid AdapterParams
+func validAdapterParams(msg *ResolveKey, acs ...*AdapterConfig) []*AdapterParams {
+	ap := []*AdapterParams{}
 	for _, ac := range acs {
 		if ac == nil {
 			continue
@@ -67,55 +161,127 @@ func constructorParams(msg *ResolveKey, acs ...*AdapterConfig) []*ConstructorPar
 				glog.V(2).Infof("%s had conversion errors %s", cc.Kind, ru.ConvertionError)
 				continue
 			}
-			cp = append(cp, &(cc.ConstructorParams))
+			ap = append(ap, cc)
 		}
 	}
-	return cp
+	return ap
 }
 
 // ConvertParams -- traverses ServicesConfig and updates
-// UnTyped ConstructorParams.Params to typed versions
+// UnTyped ConstructorParams.Params of Checkers to typed versions
 func ConvertParams(cfg ServicesConfig, creg map[string]CheckerBuilder) (ServicesConfig, []error) {
+	return convertParams(cfg, RPCCheck, func(kind string) (AdapterBuilder, bool) {
+		cn, ok := creg[kind]
+		return cn, ok
+	})
+}
+
+// ConvertReporterParams -- traverses ServicesConfig and updates
+// UnTyped ConstructorParams.Params of Reporters to typed versions
+func ConvertReporterParams(cfg ServicesConfig, rreg map[string]ReportConsumerBuilder) (ServicesConfig, []error) {
+	return convertParams(cfg, RPCReport, func(kind string) (AdapterBuilder, bool) {
+		rn, ok := rreg[kind]
+		return rn, ok
+	})
+}
+
+// builderfn -- lookup a builder by adapter kind
+type builderfn func(kind string) (AdapterBuilder, bool)
+
+func convertParams(cfg ServicesConfig, method RPCMethod, lookup builderfn) (ServicesConfig, []error) {
 	var erra []error
 	for svcname, c := range cfg {
-		erra = append(erra, updateAdapterConfig(svcname, creg, c.Egress, c.Ingress, c.Self)...)
+		erra = append(erra, updateAdapterConfig(svcname, svcname, method, lookup, c.Egress, c.Ingress, c.Self)...)
 		for bndname, bnd := range c.Consumers {
-			erra = append(erra, updateAdapterConfig(svcname+".Consumers."+bndname, creg, bnd.Adapters)...)
+			erra = append(erra, updateAdapterConfig(svcname, svcname+".Consumers."+bndname, method, lookup, bnd.Adapters)...)
 		}
 		for bndname, bnd := range c.Producers {
-			erra = append(erra, updateAdapterConfig(svcname+".Producers."+bndname, creg, bnd.Adapters)...)
+			erra = append(erra, updateAdapterConfig(svcname, svcname+".Producers."+bndname, method, lookup, bnd.Adapters)...)
 		}
 	}
 	return cfg, erra
 }
 
-func updateAdapterConfig(name string, creg map[string]CheckerBuilder, ac ...*AdapterConfig) []error {
+// paramsKey -- identifies typed params by value across config generations
+func paramsKey(typedParams interface{}) string {
+	if b, err := json.Marshal(typedParams); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%#v", typedParams)
+}
+
+// AdapterConfigs -- all non nil AdapterConfigs in ServicesConfig
+func (cfg ServicesConfig) AdapterConfigs() []*AdapterConfig {
+	var acs []*AdapterConfig
+	add := func(ac ...*AdapterConfig) {
+		for _, a := range ac {
+			if a != nil {
+				acs = append(acs, a)
+			}
+		}
+	}
+	for _, c := range cfg {
+		add(c.Egress, c.Ingress, c.Self)
+		for _, bnd := range c.Consumers {
+			add(bnd.Adapters)
+		}
+		for _, bnd := range c.Producers {
+			add(bnd.Adapters)
+		}
+	}
+	return acs
+}
+
+func updateAdapterConfig(service string, name string, method RPCMethod, lookup builderfn, ac ...*AdapterConfig) []error {
 	var erra []error
 	for idx := range ac {
 		if ac[idx] == nil {
 			continue
 		}
-		erra = append(erra, updateAdapterParams(name+fmt.Sprintf("%s.%d", name, idx), creg, &(ac[idx].Checkers))...)
+		app := &(ac[idx].Checkers)
+		if method == RPCReport {
+			app = &(ac[idx].Reporters)
+		}
+		erra = append(erra, updateAdapterParams(service, name+fmt.Sprintf("%s.%d", name, idx), lookup, app)...)
 	}
 	return erra
 }
 
-func updateAdapterParams(name string, reg map[string]CheckerBuilder, app *[]*AdapterParams) []error {
+func updateAdapterParams(service string, name string, lookup builderfn, app *[]*AdapterParams) []error {
 	var erra []error
 	var badidx []int
 	ap := *app
 	for idx := range ap {
-		if cn, ok := reg[ap[idx].Kind]; ok {
-			ccfg := cn.ConfigStruct()
+		if cn, ok := lookup(ap[idx].Kind); ok {
 			ru, converted := ap[idx].Params.(*RuntimeAdapterState)
 			if !converted {
 				ru = &RuntimeAdapterState{
 					Params:  ap[idx].Params,
 					Builder: cn,
 					Path:    name,
+					Service: service,
 				}
 				ap[idx].Params = ru
 			}
+			if err := ap[idx].FailurePolicy.Validate(); err != nil {
+				erra = append(erra, err)
+				ru.ConvertionError = err
+				glog.Errorf("ERROR: Invalid FailurePolicy for Adapter Type '%s' in %s: %s", ap[idx].Kind, name, err)
+				continue
+			}
+			if err := ap[idx].Rollout.Validate(); err != nil {
+				erra = append(erra, err)
+				ru.ConvertionError = err
+				glog.Errorf("ERROR: Invalid Rollout for Adapter Type '%s' in %s: %s", ap[idx].Kind, name, err)
+				continue
+			}
+			if err := ap[idx].CacheParams.Validate(); err != nil {
+				erra = append(erra, err)
+				ru.ConvertionError = err
+				glog.Errorf("ERROR: Invalid CacheParams for Adapter Type '%s' in %s: %s", ap[idx].Kind, name, err)
+				continue
+			}
+			ccfg := cn.ConfigStruct()
 			if err := Decode(ru.Params, ccfg); err != nil {
 				erra = append(erra, err)
 				ru.ConvertionError = err
@@ -129,6 +295,10 @@ func updateAdapterParams(name string, reg map[string]CheckerBuilder, app *[]*Ada
 				continue
 			}
 			ru.TypedParams = ccfg
+			ru.key = instanceKey{
+				Kind:   ap[idx].Kind,
+				Params: paramsKey(ccfg),
+			}
 		} else {
 			badidx = append(badidx, idx)
 			glog.Warningf("Unknown adapter type %s", ap[idx].Kind)
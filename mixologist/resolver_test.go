@@ -0,0 +1,239 @@
+package mixologist_test
+
+import (
+	"testing"
+
+	"github.com/cloudendpoints/mixologist/fakes"
+	. "github.com/cloudendpoints/mixologist/mixologist"
+	g "github.com/onsi/gomega"
+)
+
+const (
+	resolveSrc  = "project:src"
+	resolveDest = "dest.appspot.com"
+)
+
+// scope -- returns the AdapterConfig of a scope in cfg, creating it if needed
+type scope struct {
+	name string
+	ac   func(cfg ServicesConfig) *AdapterConfig
+}
+
+func service(cfg ServicesConfig, name string) *ServiceConfig {
+	if cfg[name] == nil {
+		cfg[name] = &ServiceConfig{ServiceID: name}
+	}
+	return cfg[name]
+}
+
+func adapterConfig(acp **AdapterConfig) *AdapterConfig {
+	if *acp == nil {
+		*acp = &AdapterConfig{}
+	}
+	return *acp
+}
+
+func binding(bnds *map[string]*BindingConfig, id string, serviceID string) *AdapterConfig {
+	if *bnds == nil {
+		*bnds = map[string]*BindingConfig{}
+	}
+	if (*bnds)[id] == nil {
+		(*bnds)[id] = &BindingConfig{ServiceID: serviceID}
+	}
+	return adapterConfig(&(*bnds)[id].Adapters)
+}
+
+var (
+	// precedence -- scopes that apply from resolveSrc to resolveDest, least specific first
+	precedence = []scope{
+		{"every.ingress", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, EveryService).Ingress) }},
+		{"every.egress", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, EveryService).Egress) }},
+		{"every.self", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, EveryService).Self) }},
+		{"src.egress", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, resolveSrc).Egress) }},
+		{"dest.self", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, resolveDest).Self) }},
+		{"dest.ingress", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, resolveDest).Ingress) }},
+		{"src.producers", func(cfg ServicesConfig) *AdapterConfig {
+			return binding(&service(cfg, resolveSrc).Producers, "binding.1", resolveDest)
+		}},
+		{"dest.consumers", func(cfg ServicesConfig) *AdapterConfig {
+			return binding(&service(cfg, resolveDest).Consumers, "binding.1", resolveSrc)
+		}},
+	}
+
+	// unrelated -- scopes that do not apply from resolveSrc to resolveDest
+	unrelated = []scope{
+		{"src.ingress", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, resolveSrc).Ingress) }},
+		{"src.self", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, resolveSrc).Self) }},
+		{"dest.egress", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, resolveDest).Egress) }},
+		{"other.ingress", func(cfg ServicesConfig) *AdapterConfig { return adapterConfig(&service(cfg, "other").Ingress) }},
+		{"src.producers.other", func(cfg ServicesConfig) *AdapterConfig {
+			return binding(&service(cfg, resolveSrc).Producers, "binding.2", "other")
+		}},
+		{"dest.consumers.other", func(cfg ServicesConfig) *AdapterConfig {
+			return binding(&service(cfg, resolveDest).Consumers, "binding.2", "other")
+		}},
+		{"dest.producers.src", func(cfg ServicesConfig) *AdapterConfig {
+			return binding(&service(cfg, resolveDest).Producers, "binding.1", resolveSrc)
+		}},
+		{"src.consumers.dest", func(cfg ServicesConfig) *AdapterConfig {
+			return binding(&service(cfg, resolveSrc).Consumers, "binding.1", resolveDest)
+		}},
+	}
+
+	resolveKey = &ResolveKey{Source: resolveSrc, Destination: resolveDest, RpcMethod: RPCCheck}
+)
+
+// addChecker -- add a fakechecker of kind with id to ac
+func addChecker(ac *AdapterConfig, kind string, id string) *AdapterParams {
+	ap := &AdapterParams{
+		ID: id,
+		ConstructorParams: ConstructorParams{
+			Kind: kind,
+			Params: map[interface{}]interface{}{
+				"oncall": "supercoder@acme",
+				"flist":  map[interface{}]interface{}{"wl": "abcdefg"},
+			},
+		},
+	}
+	ac.Checkers = append(ac.Checkers, ap)
+	return ap
+}
+
+func resolveChecks(cfg ServicesConfig) []*AdapterParams {
+	reg := map[string]CheckerBuilder{
+		"fakechecker":  fakes.NewCheckerBuilder("fakechecker", nil),
+		"fakechecker2": fakes.NewCheckerBuilder("fakechecker2", nil),
+	}
+	cfg, erra := ConvertParams(cfg, reg)
+	g.Expect(erra).To(g.BeEmpty())
+	return cfg.Resolve(resolveKey)
+}
+
+func ids(ap []*AdapterParams) []string {
+	ids := []string{}
+	for _, a := range ap {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := ServicesConfig{}
+	want := []string{}
+	for _, s := range precedence {
+		addChecker(s.ac(cfg), "fakechecker", s.name)
+		want = append(want, s.name)
+	}
+	for _, s := range unrelated {
+		addChecker(s.ac(cfg), "fakechecker", s.name)
+	}
+	g.Expect(ids(resolveChecks(cfg))).To(g.Equal(want))
+}
+
+func TestResolveOverride(t *testing.T) {
+	g.RegisterTestingT(t)
+	for i, less := range precedence {
+		for _, more := range precedence[i+1:] {
+			cfg := ServicesConfig{}
+			addChecker(less.ac(cfg), "fakechecker", "before")
+			addChecker(less.ac(cfg), "fakechecker", "x")
+			addChecker(less.ac(cfg), "fakechecker", "after")
+			want := addChecker(more.ac(cfg), "fakechecker", "x")
+			other := addChecker(more.ac(cfg), "fakechecker2", "after")
+
+			ap := resolveChecks(cfg)
+			g.Expect(ids(ap)).To(g.Equal([]string{"before", "x", "after", "after"}), less.name+" < "+more.name)
+			g.Expect(ap[1]).To(g.BeIdenticalTo(want), "the override takes the place of the adapter")
+			g.Expect(ap[3]).To(g.BeIdenticalTo(other), "a different kind does not override")
+		}
+	}
+}
+
+func TestResolveDisable(t *testing.T) {
+	g.RegisterTestingT(t)
+	for i, less := range precedence {
+		for j, more := range precedence {
+			cfg := ServicesConfig{}
+			addChecker(less.ac(cfg), "fakechecker", "x")
+			addChecker(less.ac(cfg), "fakechecker2", "x")
+			addChecker(less.ac(cfg), "fakechecker", "")
+			more.ac(cfg).Disable = []string{"x", "unknown"}
+			addChecker(more.ac(cfg), "fakechecker", "y")
+
+			got := ids(resolveChecks(cfg))
+			switch {
+			case i < j:
+				g.Expect(got).To(g.Equal([]string{"", "y"}), more.name+" disables "+less.name)
+			case i == j:
+				g.Expect(got).To(g.Equal([]string{"x", "x", "", "y"}), "disable does not apply to its own scope "+less.name)
+			default:
+				g.Expect(got).To(g.ConsistOf("x", "x", "", "y"), less.name+" is more specific than "+more.name)
+			}
+		}
+	}
+}
+
+func TestResolveUnrelatedDisable(t *testing.T) {
+	g.RegisterTestingT(t)
+	for _, s := range precedence {
+		for _, u := range unrelated {
+			cfg := ServicesConfig{}
+			addChecker(s.ac(cfg), "fakechecker", "x")
+			u.ac(cfg).Disable = []string{"x"}
+			addChecker(u.ac(cfg), "fakechecker", "x")
+			g.Expect(ids(resolveChecks(cfg))).To(g.Equal([]string{"x"}), u.name+" does not apply")
+		}
+	}
+}
+
+func TestResolveBindingKey(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := ServicesConfig{}
+	// bindings without a ServiceID match by their key
+	addChecker(binding(&service(cfg, resolveDest).Consumers, resolveSrc, ""), "fakechecker", "consumers")
+	addChecker(binding(&service(cfg, resolveSrc).Producers, resolveDest, ""), "fakechecker", "producers")
+	g.Expect(ids(resolveChecks(cfg))).To(g.Equal([]string{"producers", "consumers"}))
+}
+
+func TestResolveInvalidOverride(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := ServicesConfig{}
+	want := addChecker(precedence[0].ac(cfg), "fakechecker", "x")
+	invalid := addChecker(precedence[len(precedence)-1].ac(cfg), "fakechecker", "x")
+	invalid.Params = map[interface{}]interface{}{"oncall": "supercoder@acme"}
+	reg := map[string]CheckerBuilder{
+		"fakechecker": fakes.NewCheckerBuilder("fakechecker", nil),
+	}
+	cfg, erra := ConvertParams(cfg, reg)
+	g.Expect(erra).To(g.HaveLen(1))
+	ap := cfg.Resolve(resolveKey)
+	g.Expect(ap).To(g.HaveLen(1))
+	g.Expect(ap[0]).To(g.BeIdenticalTo(want), "an invalid adapter does not override")
+}
+
+func TestResolveReporters(t *testing.T) {
+	g.RegisterTestingT(t)
+	cfg := ServicesConfig{}
+	every := precedence[0].ac(cfg)
+	every.Reporters = []*AdapterParams{
+		{ID: "logs", ConstructorParams: ConstructorParams{Kind: "fakereporter"}},
+		{ID: "metrics", ConstructorParams: ConstructorParams{Kind: "fakereporter"}},
+	}
+	dest := precedence[len(precedence)-1].ac(cfg)
+	dest.Disable = []string{"logs"}
+	override := &AdapterParams{ID: "metrics", ConstructorParams: ConstructorParams{Kind: "fakereporter"}}
+	dest.Reporters = []*AdapterParams{override}
+	cfg, erra := ConvertReporterParams(cfg, map[string]ReportConsumerBuilder{
+		"fakereporter": fakes.NewBuilder("fakereporter", nil),
+	})
+	g.Expect(erra).To(g.BeEmpty())
+
+	ap := cfg.Resolve(&ResolveKey{Source: resolveSrc, Destination: resolveDest, RpcMethod: RPCReport})
+	g.Expect(ap).To(g.HaveLen(1))
+	g.Expect(ap[0]).To(g.BeIdenticalTo(override))
+
+	// other consumers only see _EVERY_SERVICE_
+	ap = cfg.Resolve(&ResolveKey{Source: "project:other", Destination: "other", RpcMethod: RPCReport})
+	g.Expect(ids(ap)).To(g.Equal([]string{"logs", "metrics"}))
+}
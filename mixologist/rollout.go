@@ -0,0 +1,109 @@
+package mixologist
+
+import (
+	"errors"
+	sc "google/api/servicecontrol/v1"
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// ModeShadow -- the decision was recorded but not enforced
+	ModeShadow = "shadow"
+	// ModeEnforced -- the decision was enforced
+	ModeEnforced = "enforced"
+	// DecisionAllow -- the checker allowed the request
+	DecisionAllow = "ALLOW"
+	// DecisionError -- the checker failed, the failure policy applies only when enforced
+	DecisionError = "ERROR"
+)
+
+type (
+	// DecisionKey -- labels of a recorded checker decision
+	DecisionKey struct {
+		// Service -- key of the ServicesConfig entry the checker is configured under
+		Service string
+		Kind    string
+		ID      string
+		// Mode -- ModeShadow or ModeEnforced
+		Mode string
+		// Decision -- DecisionAllow, DecisionError or the name of the CheckError_Code
+		Decision string
+	}
+
+	// DecisionRecorder -- counts of decisions of staged checkers
+	DecisionRecorder struct {
+		lock   sync.Mutex
+		counts map[DecisionKey]int64
+	}
+)
+
+// NewDecisionRecorder -- an empty DecisionRecorder
+func NewDecisionRecorder() *DecisionRecorder {
+	return &DecisionRecorder{counts: make(map[DecisionKey]int64)}
+}
+
+// Validate -- ensure percent is in range
+func (p RolloutParams) Validate() error {
+	if p.Percent != nil && (*p.Percent < 0 || *p.Percent > 100) {
+		return errors.New("Rollout percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// Staged -- decisions of the checker are recorded
+func (p RolloutParams) Staged() bool {
+	return p.Shadow || p.Percent != nil
+}
+
+// Enforced -- the decision is enforced for consumerID
+// Consumers are bucketed by a hash of their id, so a consumer stays enforced as Percent grows
+func (p RolloutParams) Enforced(consumerID string) bool {
+	switch {
+	case p.Shadow:
+		return false
+	case p.Percent == nil:
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(consumerID))
+	return int(h.Sum32()%100) < *p.Percent
+}
+
+// record -- count a decision
+func (d *DecisionRecorder) record(key DecisionKey) {
+	d.lock.Lock()
+	d.counts[key]++
+	d.lock.Unlock()
+}
+
+// Decisions -- snapshot of the decision counts of checkers with rollout params
+func (d *DecisionRecorder) Decisions() map[DecisionKey]int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	counts := make(map[DecisionKey]int64, len(d.counts))
+	for k, v := range d.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// service -- key of the ServicesConfig entry ap is configured under.
+// Unlike request service names, these are bounded by the config
+func service(ap *AdapterParams) string {
+	if ru, converted := ap.Params.(*RuntimeAdapterState); converted {
+		return ru.Service
+	}
+	return ""
+}
+
+// decision -- label of a checker result
+func decision(ce *sc.CheckError, err error) string {
+	switch {
+	case err != nil:
+		return DecisionError
+	case ce != nil:
+		return ce.Code.String()
+	}
+	return DecisionAllow
+}
@@ -1,13 +1,16 @@
 package mixologist
 
 import (
+	"bytes"
 	sc "google/api/servicecontrol/v1"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"golang.org/x/net/context"
 )
@@ -20,6 +23,8 @@ func NewHandler(server ServiceControllerServer, hh []*PrefixAndHandler, opts ...
 		readf:          ioutil.ReadAll,
 		marshal:        proto.Marshal,
 		unmarshal:      proto.Unmarshal,
+		jsonMarshal:    jsonMarshal,
+		jsonUnmarshal:  jsonUnmarshal,
 	}
 	for _, opt := range opts {
 		opt(h)
@@ -34,6 +39,21 @@ func Marshal(marshal marshalfn) func(*Handler) {
 	}
 }
 
+// MarshalJSON -- specify an override fn for marshaling json responses default: jsonpb.Marshaler
+func MarshalJSON(marshal marshalfn) func(*Handler) {
+	return func(h *Handler) {
+		h.jsonMarshal = marshal
+	}
+}
+
+// ReportHandlersFrom -- serve the handlers returned by fn, looked up per request
+// so that handlers of report consumers built on config changes are served
+func ReportHandlersFrom(fn func() []*PrefixAndHandler) func(*Handler) {
+	return func(h *Handler) {
+		h.reportHandlers = fn
+	}
+}
+
 // ReadHTTPBody -- provide alternate implementation for reading http body. default: ioutil.ReadAll
 func ReadHTTPBody(readf readfn) func(*Handler) {
 	return func(h *Handler) {
@@ -41,13 +61,57 @@ func ReadHTTPBody(readf readfn) func(*Handler) {
 	}
 }
 
+// jsonMarshal -- encode using the canonical proto3 JSON mapping
+func jsonMarshal(pb proto.Message) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := (&jsonpb.Marshaler{}).Marshal(buf, pb); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonUnmarshal -- decode using the canonical proto3 JSON mapping
+func jsonUnmarshal(buf []byte, pb proto.Message) error {
+	return jsonpb.Unmarshal(bytes.NewReader(buf), pb)
+}
+
+// isJSON -- true if the given Content-Type or Accept entry is json
+func isJSON(mediaType string) bool {
+	mt, _, err := mime.ParseMediaType(mediaType)
+	return err == nil && mt == ContentTypeJSON
+}
+
+// requestIsJSON -- true if the request body is json encoded
+func requestIsJSON(r *http.Request) bool {
+	return isJSON(r.Header.Get("Content-Type"))
+}
+
+// responseIsJSON -- true if the response should be json encoded.
+// An explicit Accept header wins, otherwise the response mirrors the request encoding
+func responseIsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" || accept == "*/*" {
+		return requestIsJSON(r)
+	}
+	for _, mt := range strings.Split(accept, ",") {
+		if isJSON(mt) {
+			return true
+		}
+	}
+	return false
+}
+
 // Perform common preamble during message specific processing
 func (h *Handler) preambleProcess(w http.ResponseWriter, r *http.Request, msg proto.Message) (err error) {
 	body, err := h.readf(r.Body)
 	if err != nil {
 		return
 	}
-	err = h.unmarshal(body, msg)
+	if requestIsJSON(r) {
+		err = h.jsonUnmarshal(body, msg)
+	} else {
+		err = h.unmarshal(body, msg)
+	}
 	if err != nil {
 		return
 	}
@@ -100,7 +164,11 @@ func (h *Handler) getServerFn(w http.ResponseWriter, r *http.Request) serverFn {
 // Implement Handler API
 func (h *Handler) serveHTTP(w http.ResponseWriter, r *http.Request) bool {
 	// check for registered handlers
-	for _, ph := range h.ReportHandlers {
+	hh := h.ReportHandlers
+	if h.reportHandlers != nil {
+		hh = append(hh[:len(hh):len(hh)], h.reportHandlers()...)
+	}
+	for _, ph := range hh {
 		if strings.HasPrefix(r.RequestURI, ph.Prefix) {
 			ph.Handler.ServeHTTP(w, r)
 			return false
@@ -112,7 +180,7 @@ func (h *Handler) serveHTTP(w http.ResponseWriter, r *http.Request) bool {
 		return true
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 
 	resp, err := fn(w, r, ctx)
 
@@ -122,11 +190,16 @@ func (h *Handler) serveHTTP(w http.ResponseWriter, r *http.Request) bool {
 		glog.Error(err)
 		return true
 	}
-	if respb, err := h.marshal(resp); err != nil {
+	marshal, contentType := h.marshal, ContentTypeProtobuf
+	if responseIsJSON(r) {
+		marshal, contentType = h.jsonMarshal, ContentTypeJSON
+	}
+	if respb, err := marshal(resp); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
 		glog.Error(err)
 	} else {
+		w.Header().Set("Content-Type", contentType)
 		w.Write(respb)
 	}
 	return true
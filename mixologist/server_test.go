@@ -3,6 +3,7 @@ package mixologist_test
 import (
 	"bytes"
 	"errors"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	gn "github.com/onsi/ginkgo"
 	g "github.com/onsi/gomega"
@@ -81,6 +82,81 @@ var _ = gn.Describe("Server", func() {
 
 			})
 		})
+		gn.Context("when: called with json :check request", func() {
+			gn.It("then: Should decode json and reply with json", func() {
+				rqpb := testutils.CreateCheck(
+					&testutils.ExpectedCheck{
+						ServiceName:   serviceName,
+						OperationName: "getfiles",
+						OperationId:   operationId,
+					})
+				rqjson, err := (&jsonpb.Marshaler{}).MarshalToString(&rqpb)
+				g.Expect(err).Should(g.BeNil())
+				req := httptest.NewRequest("POST", servicePrefix+CheckSuffix, strings.NewReader(rqjson))
+				req.Header.Set("Content-Type", ContentTypeJSON)
+
+				hndlr.ServeHTTP(w, req)
+
+				g.Expect(w.Code).Should(g.Equal(http.StatusOK))
+				g.Expect(w.Header().Get("Content-Type")).Should(g.Equal(ContentTypeJSON))
+				resp := &sc.CheckResponse{}
+				g.Expect(jsonpb.Unmarshal(w.Body, resp)).Should(g.Succeed())
+				g.Expect(resp.OperationId).Should(g.Equal(operationId))
+				g.Expect(proto.Equal(&rqpb, ctrl.SpyCR)).To(g.BeTrue())
+			})
+		})
+		gn.Context("when: called with protobuf :report request that accepts json", func() {
+			gn.It("then: Should reply with json", func() {
+				rqpb := testutils.CreateReport(
+					&testutils.ExpectedReport{
+						ApiName:     serviceName,
+						ApiMethod:   "getfiles",
+						OperationId: operationId,
+					})
+				rqbytes, err := proto.Marshal(&rqpb)
+				g.Expect(err).Should(g.BeNil())
+				req := httptest.NewRequest("POST", servicePrefix+ReportSuffix, bytes.NewReader(rqbytes))
+				req.Header.Set("Accept", "text/plain, application/json; charset=utf-8")
+
+				hndlr.ServeHTTP(w, req)
+
+				g.Expect(w.Code).Should(g.Equal(http.StatusOK))
+				g.Expect(w.Header().Get("Content-Type")).Should(g.Equal(ContentTypeJSON))
+				resp := &sc.ReportResponse{}
+				g.Expect(jsonpb.Unmarshal(w.Body, resp)).Should(g.Succeed())
+				g.Expect(proto.Equal(&rqpb, ctrl.SpyRR)).To(g.BeTrue())
+			})
+		})
+		gn.Context("when: called with json :check request that accepts protobuf", func() {
+			gn.It("then: Should reply with protobuf", func() {
+				rqpb := testutils.CreateCheck(
+					&testutils.ExpectedCheck{
+						ServiceName: serviceName,
+						OperationId: operationId,
+					})
+				rqjson, err := (&jsonpb.Marshaler{}).MarshalToString(&rqpb)
+				g.Expect(err).Should(g.BeNil())
+				req := httptest.NewRequest("POST", servicePrefix+CheckSuffix, strings.NewReader(rqjson))
+				req.Header.Set("Content-Type", ContentTypeJSON+"; charset=utf-8")
+				req.Header.Set("Accept", ContentTypeProtobuf)
+
+				hndlr.ServeHTTP(w, req)
+
+				g.Expect(w.Code).Should(g.Equal(http.StatusOK))
+				g.Expect(w.Header().Get("Content-Type")).Should(g.Equal(ContentTypeProtobuf))
+				resp := &sc.CheckResponse{}
+				g.Expect(proto.Unmarshal(w.Body.Bytes(), resp)).Should(g.Succeed())
+				g.Expect(resp.OperationId).Should(g.Equal(operationId))
+			})
+		})
+		gn.Context("when: called with malformed json :check request", func() {
+			gn.It("then: returns StatusInternalServerError ", func() {
+				req := httptest.NewRequest("POST", servicePrefix+CheckSuffix, strings.NewReader("{BAD_DECODE"))
+				req.Header.Set("Content-Type", ContentTypeJSON)
+				hndlr.ServeHTTP(w, req)
+				g.Expect(w.Code).Should(g.Equal(http.StatusInternalServerError))
+			})
+		})
 		gn.Context("when: called with :check request and controller.Check returns error", func() {
 			gn.It("then: returns StatusInternalServerError ", func() {
 				rqpb := testutils.CreateCheck(
@@ -181,6 +257,20 @@ var _ = gn.Describe("Server", func() {
 				g.Expect(w.Code).Should(g.Equal(http.StatusOK))
 				g.Expect(w.Body.String()).Should(g.Equal(prefix))
 			})
+			gn.It("then: Should call handlers looked up per request", func() {
+				var dynamic []*PrefixAndHandler
+				hndlr = NewHandler(ctrl, phi, ReportHandlersFrom(func() []*PrefixAndHandler { return dynamic }))
+				hndlr.ServeHTTP(w, httptest.NewRequest("GET", "/dynamic", nil))
+				g.Expect(w.Code).Should(g.Equal(http.StatusMethodNotAllowed))
+
+				dynamic = []*PrefixAndHandler{fakes.BuildPrefixAndHandler("/dynamic")}
+				w = httptest.NewRecorder()
+				hndlr.ServeHTTP(w, httptest.NewRequest("GET", "/dynamic", nil))
+				g.Expect(w.Body.String()).Should(g.Equal("/dynamic"))
+				w = httptest.NewRecorder()
+				hndlr.ServeHTTP(w, httptest.NewRequest("GET", prefix, nil))
+				g.Expect(w.Body.String()).Should(g.Equal(prefix))
+			})
 
 		})
 		gn.Context("Error cases", func() {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"golang.org/x/net/context"
@@ -19,6 +20,8 @@ type (
 		Checkers         []string
 		Logging          LogsConfig
 		WhiteListBackEnd string
+		// Decisions -- decisions of staged checkers, exported by metrics consumers
+		Decisions *DecisionRecorder
 	}
 
 	LogsConfig struct {
@@ -52,6 +55,8 @@ type (
 	Controller interface {
 		ServiceControllerServer
 		ReportQueue() chan *sc.ReportRequest
+		// Close -- reject further reports and close the report queue
+		Close()
 	}
 
 	// Readfn -- used to read from http body. used for error injection
@@ -62,30 +67,80 @@ type (
 	Handler struct {
 		Server         ServiceControllerServer
 		ReportHandlers []*PrefixAndHandler
+		// reportHandlers -- looked up per request after ReportHandlers
+		reportHandlers func() []*PrefixAndHandler
 
 		// private type when alternate impl is provided at construction time
-		readf     readfn
-		marshal   marshalfn
-		unmarshal unmarshalfn
+		readf         readfn
+		marshal       marshalfn
+		unmarshal     unmarshalfn
+		jsonMarshal   marshalfn
+		jsonUnmarshal unmarshalfn
 	}
 
+	// CheckerManager -- resolves and runs checkers for every CheckRequest
 	CheckerManager struct {
 		cfg atomic.Value
+		// deadline -- upper bound on time spent in checkers per request
+		deadline time.Duration
+		// decisions -- records decisions of staged checkers
+		decisions *DecisionRecorder
 
 		lock     sync.RWMutex
-		checkers map[ConstructorParams]Checker
+		checkers map[instanceKey]*checkerRef
+		// building -- checkers being built outside the lock
+		building map[instanceKey]*pendingChecker
+		// refs -- checker instances referenced by the current config
+		refs map[instanceKey]bool
+		// caches -- check result caches, kept across config generations
+		// as long as the checker instance and its CacheParams are referenced
+		caches map[cacheKey]*checkCache
+		// cacheRefs -- caches referenced by the current config
+		cacheRefs map[cacheKey]bool
+	}
+	// checkerRef -- a checker and the checks using it
+	checkerRef struct {
+		Checker
+		lock sync.Mutex
+		// inflight -- checks using the checker
+		inflight int
+		// retired -- no longer referenced, unloaded once inflight drops to 0
+		retired bool
+	}
+	// pendingChecker -- a checker being built and the checks waiting for it
+	pendingChecker struct {
+		done chan struct{}
+		// waiters, published, ref and err are guarded by CheckerManager.lock
+		// waiters -- checks the ref is held for once published
+		waiters   int
+		published bool
+		ref       *checkerRef
+		err       error
 	}
 	// ControllerImpl -- The controller that is implemented by framework itself
 	// It delelegates the actual work to a the *real* ServiceControllerServer
 	ControllerImpl struct {
 		reportQueue    chan *sc.ReportRequest
 		checkerManager *CheckerManager
+		// lock -- held by Report while queueing, so Close does not race a send
+		lock   sync.RWMutex
+		closed bool
 	}
 
 	// ReportConsumerManagerImpl -- store consumer manager config/state
 	ReportConsumerManagerImpl struct {
 		reportQueue chan *sc.ReportRequest
-		consumers   []ReportConsumer
+		// consumers -- configured by flags, receive every report
+		consumers []ReportConsumer
+		loops     sync.WaitGroup
+		config    Config
+
+		// reporters -- *reporterState resolved from ServicesConfig
+		reporters atomic.Value
+		// lock -- serializes ConfigChange and Drain
+		lock sync.Mutex
+		// consuming -- held for reading by consumer loops while they consume a report
+		consuming sync.RWMutex
 	}
 	// PrefixAndHandler -- as the name suggests, returned by consumers if they wish to have
 	// a listener
@@ -106,11 +161,21 @@ type (
 		//FIXME change to PrefixAndHandler
 		GetPrefixAndHandler() *PrefixAndHandler
 	}
+	// Closer -- optionally implemented by ReportConsumers that buffer reports.
+	// Called once at shutdown after the last Consume.
+	Closer interface {
+		// Close -- flush buffered reports and release resources
+		Close()
+	}
+
 	//ReportConsumerBuilder -- Every report consumer should register its builder
 	// in the init method
 	ReportConsumerBuilder interface {
-		// Given an arbitrary map create a new consumer
-		BuildConsumer(Config) (ReportConsumer, error)
+		// AdapterBuilder -- embedded
+		AdapterBuilder
+		// BuildConsumer -- given global config and a pointer to a properly filled struct
+		// obtained from ConfigStruct(), return an initialized consumer
+		BuildConsumer(Config, interface{}) (ReportConsumer, error)
 	}
 
 	Unloader interface {
@@ -123,8 +188,9 @@ type (
 		// Name -- name of this checker
 		Name() string
 		// Check -- check if the current request should go thru
-		// per this checker
-		Check(*sc.CheckRequest) (*sc.CheckError, error)
+		// per this checker. Checkers that block on remote calls
+		// should give up when ctx is done.
+		Check(context.Context, *sc.CheckRequest) (*sc.CheckError, error)
 		// Unload -- called when this adapter is no longer needed
 		Unloader
 	}